@@ -0,0 +1,218 @@
+// Command migrate copies links to new storage while shortener writes to both of them.
+//
+// Steps of moving links from storage to migration.target:
+//  1. Set migration.enabled with target in config, deploy all instances.
+//     New links are written to both storages, reads come from storage.
+//  2. With memory storage take its snapshot by POST /admin/snapshot.
+//  3. migrate -c etc/shortener.yaml copy
+//     copies old links, it is resumed from -checkpoint file if interrupted.
+//  4. migrate ... verify checks that all links of storage are in target.
+//  5. Set migration.primary to target, deploy all instances. Reads come from target,
+//     storage is still written and shadow-read, so it's possible to switch back.
+//  6. Replace storage with target, remove migration, deploy all instances.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/amanakin/shortener/internal/repository/migrate"
+	"github.com/amanakin/shortener/internal/repository/postgres"
+	"github.com/amanakin/shortener/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	commandCopy   = "copy"
+	commandVerify = "verify"
+)
+
+type Config struct {
+	StorageConfig   storage.Config          `yaml:"storage"`
+	PgConfig        postgres.Config         `yaml:"postgres"`
+	MigrationConfig storage.MigrationConfig `yaml:"migration"`
+}
+
+func main() {
+	configFile := flag.String("c", "etc/shortener.yaml", "Path to the YAML configuration file of shortener")
+	batch := flag.Int("batch", 1000, "Links copied or verified at once")
+	workers := flag.Int("workers", 8, "Links of batch copied or verified concurrently")
+	checkpointFile := flag.String("checkpoint", "migrate.checkpoint", "Path to the progress of copy")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] copy|verify\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	err := run(ctx, flag.Arg(0), *configFile, *batch, *workers, *checkpointFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, command, configFile string, batch, workers int, checkpointFile string) error {
+	if flag.NArg() != 1 || batch < 1 || workers < 1 {
+		flag.Usage()
+		return errors.New("wrong arguments")
+	}
+	if command != commandCopy && command != commandVerify {
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	cfg, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if err = checkConfig(cfg); err != nil {
+		return err
+	}
+
+	source, err := storage.Open(ctx, cfg.StorageConfig, cfg.PgConfig)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	// Memory storage writes its snapshot on close, and the snapshot belongs to running shortener.
+	if cfg.StorageConfig.Kind(cfg.PgConfig) != storage.Memory {
+		defer source.Close(context.Background())
+	}
+	scanner, err := newScanner(source)
+	if err != nil {
+		return err
+	}
+
+	target, err := storage.Open(ctx, cfg.MigrationConfig.Target, cfg.MigrationConfig.Postgres)
+	if err != nil {
+		return fmt.Errorf("target: %w", err)
+	}
+	defer target.Close(context.Background())
+
+	if command == commandVerify {
+		return verify(ctx, scanner, target, batch, workers)
+	}
+
+	checkpoint, err := readCheckpoint(checkpointFile)
+	if err != nil {
+		return err
+	}
+	err = migrate.Copy(ctx, scanner, target, batch, workers, &checkpoint, func(c migrate.Checkpoint) error {
+		fmt.Printf("copied %d links, %d conflicts\n", c.Copied, c.Conflicts)
+		return writeCheckpoint(checkpointFile, c)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("copy is done")
+	return nil
+}
+
+func readConfig(path string) (Config, error) {
+	cfg := Config{
+		StorageConfig:   storage.DefaultConfig(),
+		PgConfig:        postgres.DefaultConfig(),
+		MigrationConfig: storage.DefaultMigrationConfig(),
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("open config file: %w", err)
+	}
+	defer file.Close()
+
+	if err = yaml.NewDecoder(file).Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("decode config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// checkConfig allows copy and verify only while shortener writes to both storages,
+// source must be scanned from outside of shortener and target must be shared with it.
+func checkConfig(cfg Config) error {
+	if !cfg.MigrationConfig.Enabled {
+		return errors.New("migration must be enabled in config and deployed, so new links are written to target")
+	}
+
+	switch kind := cfg.StorageConfig.Kind(cfg.PgConfig); kind {
+	case storage.Postgres:
+	case storage.Memory:
+		if cfg.StorageConfig.Memory.Snapshot == "" {
+			return errors.New("memory storage is copied from its snapshot, storage.memory.snapshot must be set")
+		}
+	default:
+		return fmt.Errorf("links of %s storage can't be copied", kind)
+	}
+
+	switch kind := cfg.MigrationConfig.Target.Kind(cfg.MigrationConfig.Postgres); kind {
+	case storage.Memory, storage.File:
+		return fmt.Errorf("%s storage belongs to shortener process, it can't be target of copy", kind)
+	}
+	return nil
+}
+
+// newScanner sorts links of memory storage once, its repository isn't ordered.
+func newScanner(source repository.ShortenerRepo) (migrate.Scanner, error) {
+	switch source := source.(type) {
+	case *maprepo.Repo:
+		return migrate.NewSortedLinks(source.Links(), source), nil
+	case migrate.Scanner:
+		return source, nil
+	default:
+		return nil, errors.New("links of source storage can't be scanned")
+	}
+}
+
+func verify(ctx context.Context, source migrate.Scanner, target repository.ShortenerRepo, batch, workers int) error {
+	result, err := migrate.Verify(ctx, source, target, batch, workers)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("checked %d links: %d missing, %d mismatched\n", result.Checked, result.Missing, result.Mismatched)
+	if !result.OK() {
+		return errors.New("verify failed, remove checkpoint and run copy again")
+	}
+	return nil
+}
+
+func readCheckpoint(path string) (migrate.Checkpoint, error) {
+	var checkpoint migrate.Checkpoint
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// writeCheckpoint replaces checkpoint file atomically.
+func writeCheckpoint(path string, checkpoint migrate.Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,242 @@
+// Command reshard moves buckets of sharded storage between shards online.
+//
+// Steps of moving buckets from shard "s1" to new shard "s2":
+//  1. Add s2 to storage.sharded.shards and move {buckets: "0-511", from: s1, to: s2}
+//     to storage.sharded.moves, deploy all instances. New links go to s1 and then s2,
+//     reads go to s2 and then s1.
+//  2. reshard -c etc/shortener.yaml -buckets 0-511 -from s1 -to s2 copy
+//     copies old rows, it is resumed from -checkpoint file if interrupted.
+//  3. reshard ... verify checks that all rows of s1 are on s2.
+//  4. Assign buckets to s2 in shard map, remove move, deploy all instances.
+//  5. reshard ... cleanup verifies and deletes moved rows from s1.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/amanakin/shortener/internal/repository/shardrepo"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	commandCopy    = "copy"
+	commandVerify  = "verify"
+	commandCleanup = "cleanup"
+)
+
+type Config struct {
+	StorageConfig struct {
+		Sharded shardrepo.Config `yaml:"sharded"`
+	} `yaml:"storage"`
+}
+
+func main() {
+	configFile := flag.String("c", "etc/shortener.yaml", "Path to the YAML configuration file of shortener")
+	buckets := flag.String("buckets", "", "Buckets to move, e.g. 0-511")
+	from := flag.String("from", "", "Shard to move buckets from")
+	to := flag.String("to", "", "Shard to move buckets to")
+	batch := flag.Int("batch", 1000, "Rows copied at once")
+	checkpointFile := flag.String("checkpoint", "reshard.checkpoint", "Path to the progress of copy")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] copy|verify|cleanup\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	err := run(ctx, flag.Arg(0), *configFile, *buckets, *from, *to, *batch, *checkpointFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reshard:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, command, configFile, buckets, from, to string, batch int, checkpointFile string) error {
+	if flag.NArg() != 1 || from == "" || to == "" || batch < 1 {
+		flag.Usage()
+		return errors.New("wrong arguments")
+	}
+
+	ranges, err := shardrepo.ParseBuckets(buckets)
+	if err != nil {
+		return err
+	}
+	if len(ranges) != 1 {
+		return errors.New("one range of buckets is moved at once")
+	}
+	bucketRange := ranges[0]
+
+	cfg, err := readConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if err = checkConfig(cfg, command, bucketRange, from, to); err != nil {
+		return err
+	}
+
+	fromShard, err := connect(ctx, cfg, from)
+	if err != nil {
+		return err
+	}
+	defer fromShard.Close()
+	toShard, err := connect(ctx, cfg, to)
+	if err != nil {
+		return err
+	}
+	defer toShard.Close()
+
+	switch command {
+	case commandCopy:
+		checkpoint, err := readCheckpoint(checkpointFile)
+		if err != nil {
+			return err
+		}
+		err = shardrepo.Copy(ctx, fromShard, toShard, bucketRange, batch, &checkpoint, func(c shardrepo.Checkpoint) error {
+			fmt.Printf("copied %d rows\n", c.Copied)
+			return writeCheckpoint(checkpointFile, c)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println("copy is done")
+		return nil
+	case commandVerify:
+		_, err = verify(ctx, fromShard, toShard, bucketRange, batch)
+		return err
+	case commandCleanup:
+		if _, err = verify(ctx, fromShard, toShard, bucketRange, batch); err != nil {
+			return err
+		}
+		deleted, err := fromShard.DeleteBuckets(ctx, bucketRange)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("deleted %d rows from %s\n", deleted, from)
+		return nil
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func readConfig(path string) (Config, error) {
+	var cfg Config
+
+	file, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("open config file: %w", err)
+	}
+	defer file.Close()
+
+	if err = yaml.NewDecoder(file).Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("decode config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// checkConfig allows copy and verify only while buckets are moved,
+// and cleanup only after they are assigned to destination shard.
+func checkConfig(cfg Config, command string, buckets shardrepo.BucketRange, from, to string) error {
+	sharded := cfg.StorageConfig.Sharded
+
+	owners, err := shardrepo.Owners(sharded)
+	if err != nil {
+		return err
+	}
+
+	if command == commandCleanup {
+		for bucket := buckets.Lo; bucket <= buckets.Hi; bucket++ {
+			if owners[bucket] != to {
+				return fmt.Errorf("bucket %d must be assigned to %s before cleanup", bucket, to)
+			}
+		}
+		for _, move := range sharded.Moves {
+			if move.From == from && move.To == to {
+				return errors.New("move must be removed from config before cleanup")
+			}
+		}
+		return nil
+	}
+
+	for _, move := range sharded.Moves {
+		if move.From != from || move.To != to {
+			continue
+		}
+		ranges, err := shardrepo.ParseBuckets(move.Buckets)
+		if err != nil {
+			return err
+		}
+		for _, r := range ranges {
+			if r.Lo <= buckets.Lo && buckets.Hi <= r.Hi {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("config must have move of buckets %s from %s to %s", buckets, from, to)
+}
+
+func connect(ctx context.Context, cfg Config, name string) (*shardrepo.PgShard, error) {
+	for _, shardConfig := range cfg.StorageConfig.Sharded.Shards {
+		if shardConfig.Name == name {
+			shard, err := shardrepo.NewPgShard(ctx, shardConfig.Postgres)
+			if err != nil {
+				return nil, fmt.Errorf("shard %s: %w", name, err)
+			}
+			return shard, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown shard %q", name)
+}
+
+func verify(ctx context.Context, from, to shardrepo.Shard, buckets shardrepo.BucketRange, batch int) (shardrepo.VerifyResult, error) {
+	result, err := shardrepo.Verify(ctx, from, to, buckets, batch)
+	if err != nil {
+		return result, err
+	}
+
+	fmt.Printf("checked %d rows: %d missing, %d mismatched\n", result.Checked, result.Missing, result.Mismatched)
+	if !result.OK() {
+		return result, errors.New("verify failed, run copy again")
+	}
+	return result, nil
+}
+
+func readCheckpoint(path string) (shardrepo.Checkpoint, error) {
+	var checkpoint shardrepo.Checkpoint
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("decode checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// writeCheckpoint replaces checkpoint file atomically.
+func writeCheckpoint(path string, checkpoint shardrepo.Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
 	"fmt"
 	"os"
@@ -10,27 +11,40 @@ import (
 
 	"github.com/amanakin/shortener/internal/handler/grpc"
 	"github.com/amanakin/shortener/internal/handler/http"
-	"github.com/amanakin/shortener/internal/repository"
-	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/amanakin/shortener/internal/handler/http/handler"
+	"github.com/amanakin/shortener/internal/repository/bloom"
+	"github.com/amanakin/shortener/internal/repository/cache"
+	"github.com/amanakin/shortener/internal/repository/degraded"
 	"github.com/amanakin/shortener/internal/repository/postgres"
 	"github.com/amanakin/shortener/internal/service"
 	"github.com/amanakin/shortener/internal/service/shortener"
+	"github.com/amanakin/shortener/internal/storage"
 	"golang.org/x/exp/slog"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	HttpConfig      http.Config      `yaml:"http"`
-	GrpcConfig      grpc.Config      `yaml:"grpc"`
-	PgConfig        postgres.Config  `yaml:"postgres"`
-	ShortenerConfig shortener.Config `yaml:"shortener"`
+	HttpConfig      http.Config             `yaml:"http"`
+	GrpcConfig      grpc.Config             `yaml:"grpc"`
+	StorageConfig   storage.Config          `yaml:"storage"`
+	MigrationConfig storage.MigrationConfig `yaml:"migration"`
+	PgConfig        postgres.Config         `yaml:"postgres"`
+	DegradedConfig  degraded.Config         `yaml:"degraded"`
+	CacheConfig     cache.Config            `yaml:"cache"`
+	BloomConfig     bloom.Config            `yaml:"bloom"`
+	ShortenerConfig shortener.Config        `yaml:"shortener"`
 }
 
 func getConfig() (*Config, error) {
 	cfg := &Config{
 		HttpConfig:      http.DefaultConfig(),
 		GrpcConfig:      grpc.DefaultConfig(),
+		StorageConfig:   storage.DefaultConfig(),
+		MigrationConfig: storage.DefaultMigrationConfig(),
 		PgConfig:        postgres.DefaultConfig(),
+		DegradedConfig:  degraded.DefaultConfig(),
+		CacheConfig:     cache.DefaultConfig(),
+		BloomConfig:     bloom.DefaultConfig(),
 		ShortenerConfig: shortener.DefaultConfig(),
 	}
 
@@ -59,19 +73,17 @@ type Server interface {
 	Stop()
 }
 
-func StartServers(logger *slog.Logger, shortenerService service.Shortener, cfg *Config) {
+// StartServers serves until ctx is done.
+func StartServers(ctx context.Context, logger *slog.Logger, shortenerService service.Shortener,
+	admin map[string]handler.AdminAction, cfg *Config) {
 	var servers []Server
 	if cfg.HttpConfig.Enabled {
-		servers = append(servers, http.New(logger, shortenerService, cfg.HttpConfig))
+		servers = append(servers, http.New(logger, shortenerService, cfg.HttpConfig, admin))
 	}
 	if cfg.GrpcConfig.Enabled {
 		servers = append(servers, grpc.New(logger, shortenerService, cfg.GrpcConfig))
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(),
-		syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	defer cancel()
-
 	for _, server := range servers {
 		go func(server Server) {
 			err := server.ListenAndServe(ctx)
@@ -97,17 +109,57 @@ func main() {
 		os.Exit(1)
 	}
 
-	var repo repository.ShortenerRepo
-	if cfg.PgConfig.Enabled {
-		repo, err = postgres.New(cfg.PgConfig)
+	ctx, cancel := signal.NotifyContext(context.Background(),
+		syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer cancel()
+
+	repo, err := newRepo(ctx, cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if cfg.DegradedConfig.Enabled {
+		degradedRepo, err := degraded.New(repo, cfg.DegradedConfig)
 		if err != nil {
 			logger.Error(err.Error())
 			os.Exit(1)
 		}
-	} else {
-		repo = maprepo.New()
+		expvar.Publish("degraded", degradedRepo.Metrics())
+		go degradedRepo.Run(ctx)
+		repo = degradedRepo
+	}
+	if cfg.BloomConfig.Enabled {
+		bloomRepo, err := bloom.New(repo, cfg.BloomConfig)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		expvar.Publish("bloom", bloomRepo.Metrics())
+		go bloomRepo.Run(ctx)
+		repo = bloomRepo
+	}
+	if cfg.CacheConfig.Enabled {
+		cacheRepo, err := cache.New(repo, cfg.CacheConfig)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		expvar.Publish("cache", cacheRepo.Metrics())
+		go cacheRepo.Run(ctx)
+		repo = cacheRepo
+	}
+	defer repo.Close(context.Background())
+
+	shortenerService, err := shortener.NewService(repo, cfg.ShortenerConfig)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if metrics := shortenerService.Metrics(); metrics != nil {
+		expvar.Publish("generator", metrics)
 	}
 
-	shortenerService := shortener.NewService(repo, cfg.ShortenerConfig)
-	StartServers(logger, shortenerService, cfg)
+	go shortenerService.Run(ctx)
+	StartServers(ctx, logger, shortenerService, adminActions(repo), cfg)
 }
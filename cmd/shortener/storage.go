@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+
+	"github.com/amanakin/shortener/internal/handler/http/handler"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/migrate"
+	"github.com/amanakin/shortener/internal/repository/postgres"
+	"github.com/amanakin/shortener/internal/storage"
+)
+
+// Runner is implemented by repositories which do background work.
+type Runner interface {
+	// Run blocks until ctx is done.
+	Run(ctx context.Context)
+}
+
+// newRepo creates repository, with migration it writes to source and target storages.
+// Background work of storages runs until ctx is done.
+func newRepo(ctx context.Context, cfg *Config) (repository.ShortenerRepo, error) {
+	source, err := openStorage(ctx, cfg.StorageConfig, cfg.PgConfig, "postgres")
+	if err != nil {
+		return nil, err
+	}
+	migration := cfg.MigrationConfig
+	if !migration.Enabled {
+		return source, nil
+	}
+
+	target, err := openStorage(ctx, migration.Target, migration.Postgres, "migration_postgres")
+	if err != nil {
+		source.Close(context.Background())
+		return nil, fmt.Errorf("migration target: %w", err)
+	}
+
+	primary, secondary := source, target
+	switch migration.Primary {
+	case storage.PrimarySource:
+	case storage.PrimaryTarget:
+		primary, secondary = target, source
+	default:
+		err = fmt.Errorf("unknown migration primary %q", migration.Primary)
+	}
+	var repo *migrate.Repo
+	if err == nil {
+		repo, err = migrate.New(primary, secondary, migration.Config)
+	}
+	if err != nil {
+		source.Close(context.Background())
+		target.Close(context.Background())
+		return nil, fmt.Errorf("migration: %w", err)
+	}
+	expvar.Publish("migration", repo.Metrics())
+	return repo, nil
+}
+
+// openStorage opens storage and starts its background work, Postgres metrics are published as pgMetrics.
+func openStorage(ctx context.Context, config storage.Config, pg postgres.Config, pgMetrics string) (repository.ShortenerRepo, error) {
+	repo, err := storage.Open(ctx, config, pg)
+	if err != nil {
+		return nil, err
+	}
+	if pgRepo, ok := repo.(*postgres.Repo); ok {
+		expvar.Publish(pgMetrics, pgRepo.Metrics())
+	}
+	if runner, ok := repo.(Runner); ok {
+		go runner.Run(ctx)
+	}
+	return repo, nil
+}
+
+// Snapshotter is implemented by repositories which save links on demand.
+type Snapshotter interface {
+	Snapshot() error
+}
+
+// ReadOnlySwitch is implemented by repositories which can be switched to read-only mode.
+type ReadOnlySwitch interface {
+	SetReadOnly(readOnly bool)
+}
+
+// adminActions returns actions available on HTTP /admin for repo.
+func adminActions(repo repository.ShortenerRepo) map[string]handler.AdminAction {
+	actions := make(map[string]handler.AdminAction)
+	if snapshotter, ok := repository.As[Snapshotter](repo); ok {
+		actions["snapshot"] = func(context.Context) error {
+			return snapshotter.Snapshot()
+		}
+	}
+	if readOnlySwitch, ok := repository.As[ReadOnlySwitch](repo); ok {
+		actions["read-only"] = func(context.Context) error {
+			readOnlySwitch.SetReadOnly(true)
+			return nil
+		}
+		actions["read-write"] = func(context.Context) error {
+			readOnlySwitch.SetReadOnly(false)
+			return nil
+		}
+	}
+	return actions
+}
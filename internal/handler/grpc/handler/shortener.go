@@ -2,10 +2,13 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/amanakin/shortener/internal/handler/grpc/api"
 	"github.com/amanakin/shortener/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ShortenerHandler struct {
@@ -22,6 +25,12 @@ func NewShortener(shortener service.Shortener) *ShortenerHandler {
 
 func (s *ShortenerHandler) Shorten(ctx context.Context, req *api.ShortenRequest) (*api.ShortenResponse, error) {
 	link, created, err := s.Shortener.Shorten(ctx, req.Url)
+	if errors.Is(err, service.ErrInvalidURL) || errors.Is(err, service.ErrURLTooLong) {
+		return nil, status.Errorf(codes.InvalidArgument, "shorten: %s", err)
+	}
+	if errors.Is(err, service.ErrUnavailable) || errors.Is(err, service.ErrReadOnly) {
+		return nil, status.Errorf(codes.Unavailable, "shorten: %s", err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("shorten: %w", err)
 	}
@@ -35,6 +44,12 @@ func (s *ShortenerHandler) Shorten(ctx context.Context, req *api.ShortenRequest)
 
 func (s *ShortenerHandler) Resolve(ctx context.Context, req *api.ResolveRequest) (*api.ResolveResponse, error) {
 	original, err := s.Shortener.Resolve(ctx, req.Shortened)
+	if errors.Is(err, service.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "resolve: %s", err)
+	}
+	if errors.Is(err, service.ErrUnavailable) {
+		return nil, status.Errorf(codes.Unavailable, "resolve: %s", err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("resolve: %w", err)
 	}
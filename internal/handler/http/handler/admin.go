@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"golang.org/x/exp/slog"
+)
+
+const adminAction = "/admin/{action}"
+
+// AdminAction is operation triggered by POST /admin/{action}.
+type AdminAction func(ctx context.Context) error
+
+// AdminHandler runs admin actions for requests with bearer token.
+type AdminHandler struct {
+	token   string
+	actions map[string]AdminAction
+	logger  *slog.Logger
+}
+
+func NewAdmin(logger *slog.Logger, token string, actions map[string]AdminAction) *AdminHandler {
+	return &AdminHandler{
+		token:   token,
+		actions: actions,
+		logger:  logger,
+	}
+}
+
+func (h *AdminHandler) errorLogger(f errorHandleFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := f(w, r)
+		if err != nil {
+			h.logger.Error("admin handler", slog.String("error", err.Error()))
+		}
+	}
+}
+
+func (h *AdminHandler) Register(r chi.Router) {
+	r.Get("/admin", h.errorLogger(h.List))
+	r.Post(adminAction, h.errorLogger(h.Run))
+}
+
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// AdminListResponse is a response with names of admin actions.
+type AdminListResponse struct {
+	Actions []string `json:"actions"`
+}
+
+func (h *AdminHandler) List(w http.ResponseWriter, r *http.Request) error {
+	if !h.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	resp := AdminListResponse{Actions: make([]string, 0, len(h.actions))}
+	for name := range h.actions {
+		resp.Actions = append(resp.Actions, name)
+	}
+	sort.Strings(resp.Actions)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+	return nil
+}
+
+func (h *AdminHandler) Run(w http.ResponseWriter, r *http.Request) error {
+	if !h.authorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	name := chi.URLParam(r, "action")
+	action, ok := h.actions[name]
+	if !ok {
+		http.Error(w, "Unknown action", http.StatusNotFound)
+		return nil
+	}
+
+	if err := action(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	h.logger.Info("admin action done", slog.String("action", name))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"html/template"
+)
+
+// interstitialData is rendered instead of redirect when original host looks suspicious.
+type interstitialData struct {
+	Original    string
+	Host        string
+	UnicodeHost string
+	LooksLike   string
+	Reason      string
+}
+
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Check the link before you continue</title>
+</head>
+<body>
+<h1>Check the link before you continue</h1>
+<p>This short link leads to <strong>{{.UnicodeHost}}</strong> ({{.Host}}).</p>
+{{if .LooksLike}}<p>Its address looks like <strong>{{.LooksLike}}</strong>, but it is a different site.</p>{{end}}
+<p>Reason: {{.Reason}}</p>
+<p><a href="{{.Original}}" rel="noreferrer noopener">Continue to {{.Host}}</a></p>
+</body>
+</html>
+`))
+
+// launchData is rendered for non-web schemes (mailto, tel, app schemes),
+// browsers open external handlers reliably only on user click.
+type launchData struct {
+	Original template.URL
+	Scheme   string
+}
+
+var launchTemplate = template.Must(template.New("launch").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Open link</title>
+</head>
+<body>
+<h1>Open link</h1>
+<p>This short link opens an external {{.Scheme}} application.</p>
+<p><a href="{{.Original}}">Open {{.Original}}</a></p>
+</body>
+</html>
+`))
+
+// mistypedData is rendered when short link has wrong check symbol and existing one was probably meant.
+type mistypedData struct {
+	Suggestion string
+}
+
+var mistypedTemplate = template.Must(template.New("mistyped").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link not found</title>
+</head>
+<body>
+<h1>Link not found</h1>
+<p>Did you mean <a href="/{{.Suggestion}}">{{.Suggestion}}</a>?</p>
+</body>
+</html>
+`))
@@ -1,19 +1,25 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
 
 	"github.com/amanakin/shortener/internal/service"
+	"github.com/amanakin/shortener/internal/service/shortener/homograph"
+	"github.com/amanakin/shortener/internal/service/shortener/scheme"
 	"github.com/go-chi/chi"
 	"golang.org/x/exp/slog"
 )
 
 const (
-	setLink = "/setlink"
-	getLink = "/getlink/{shortened}"
+	setLink  = "/setlink"
+	getLink  = "/getlink/{shortened}"
+	redirect = "/{shortened}"
 )
 
 type ShortenerHandler struct {
@@ -30,6 +36,19 @@ func NewShortener(logger *slog.Logger, shortener service.Shortener, readLimit in
 	}
 }
 
+// retryAfter is seconds to wait before retry of request failed with 503.
+const retryAfter = "5"
+
+func unavailable(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", retryAfter)
+	http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+}
+
+func readOnly(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", retryAfter)
+	http.Error(w, "Service is read-only", http.StatusServiceUnavailable)
+}
+
 type errorHandleFunc func(w http.ResponseWriter, r *http.Request) error
 
 func (h *ShortenerHandler) errorLogger(f errorHandleFunc) http.HandlerFunc {
@@ -44,6 +63,7 @@ func (h *ShortenerHandler) errorLogger(f errorHandleFunc) http.HandlerFunc {
 func (h *ShortenerHandler) Register(r chi.Router) {
 	r.Post(setLink, h.errorLogger(h.SetLink))
 	r.Get(getLink, h.errorLogger(h.GetLink))
+	r.Get(redirect, h.errorLogger(h.Redirect))
 }
 
 // SetLinkRequest is a request for setting link.
@@ -71,6 +91,18 @@ func (h *ShortenerHandler) SetLink(w http.ResponseWriter, r *http.Request) error
 	}
 
 	link, created, err := h.shortener.Shorten(r.Context(), req.Original)
+	if errors.Is(err, service.ErrInvalidURL) || errors.Is(err, service.ErrURLTooLong) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return fmt.Errorf("shorten: %w", err)
+	}
+	if errors.Is(err, service.ErrReadOnly) {
+		readOnly(w)
+		return fmt.Errorf("shorten: %w", err)
+	}
+	if errors.Is(err, service.ErrUnavailable) {
+		unavailable(w)
+		return fmt.Errorf("shorten: %w", err)
+	}
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return fmt.Errorf("shorten: %w", err)
@@ -109,10 +141,19 @@ func (h *ShortenerHandler) GetLink(w http.ResponseWriter, r *http.Request) error
 	shortened := chi.URLParam(r, "shortened")
 
 	original, err := h.shortener.Resolve(r.Context(), shortened)
+	var mistyped *service.MistypedError
+	if errors.As(err, &mistyped) {
+		http.Error(w, fmt.Sprintf("Not found, did you mean %s?", mistyped.Suggestion), http.StatusNotFound)
+		return fmt.Errorf("resolve: %w", err)
+	}
 	if errors.Is(err, service.ErrNotFound) {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return fmt.Errorf("resolve: %w", err)
 	}
+	if errors.Is(err, service.ErrUnavailable) {
+		unavailable(w)
+		return fmt.Errorf("resolve: %w", err)
+	}
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return fmt.Errorf("resolve: %w", err)
@@ -134,3 +175,93 @@ func (h *ShortenerHandler) GetLink(w http.ResponseWriter, r *http.Request) error
 
 	return nil
 }
+
+// unicodeHost returns Unicode form of host kept with link,
+// or converted from punycode for links created before it was kept.
+func (h *ShortenerHandler) unicodeHost(ctx context.Context, shortened, host string) string {
+	if hosts, ok := h.shortener.(service.HostResolver); ok {
+		stored, err := hosts.UnicodeHost(ctx, shortened)
+		if err == nil {
+			return stored
+		}
+		if !errors.Is(err, service.ErrNotFound) {
+			h.logger.Warn("unicode host", slog.String("shortened", shortened), slog.String("error", err.Error()))
+		}
+	}
+	return homograph.Unicode(host)
+}
+
+// Redirect sends client to original URL.
+// If original host looks like homograph of another one, it shows interstitial page with warning.
+// Non-web schemes (mailto, tel, app schemes) get page with link, denied schemes are never followed.
+// Mistyped short link gets "did you mean" page.
+func (h *ShortenerHandler) Redirect(w http.ResponseWriter, r *http.Request) error {
+	shortened := chi.URLParam(r, "shortened")
+
+	original, err := h.shortener.Resolve(r.Context(), shortened)
+	var mistyped *service.MistypedError
+	if errors.As(err, &mistyped) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		if execErr := mistypedTemplate.Execute(w, mistypedData{Suggestion: mistyped.Suggestion}); execErr != nil {
+			return fmt.Errorf("execute mistyped: %w", execErr)
+		}
+		return fmt.Errorf("resolve: %w", err)
+	}
+	if errors.Is(err, service.ErrNotFound) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return fmt.Errorf("resolve: %w", err)
+	}
+	if errors.Is(err, service.ErrUnavailable) {
+		unavailable(w)
+		return fmt.Errorf("resolve: %w", err)
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return fmt.Errorf("resolve: %w", err)
+	}
+
+	u, err := url.Parse(original)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return fmt.Errorf("parse original: %w", err)
+	}
+
+	switch {
+	case scheme.IsDenied(u.Scheme):
+		http.Error(w, "Link is blocked", http.StatusForbidden)
+		return fmt.Errorf("redirect to denied scheme %q", u.Scheme)
+	case !scheme.IsWeb(u.Scheme):
+		// template/html checks scheme of href, trusted URL was validated before storing.
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = launchTemplate.Execute(w, launchData{
+			Original: template.URL(original),
+			Scheme:   u.Scheme,
+		})
+		if err != nil {
+			return fmt.Errorf("execute launch: %w", err)
+		}
+		return nil
+	}
+
+	res := homograph.Check(u.Hostname())
+	if !res.Suspicious {
+		http.Redirect(w, r, original, http.StatusFound)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	err = interstitialTemplate.Execute(w, interstitialData{
+		Original:    original,
+		Host:        u.Hostname(),
+		UnicodeHost: h.unicodeHost(r.Context(), shortened, u.Hostname()),
+		LooksLike:   res.LooksLike,
+		Reason:      res.Reason,
+	})
+	if err != nil {
+		return fmt.Errorf("execute interstitial: %w", err)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
@@ -23,6 +24,7 @@ const (
 	defaultRateLimit = 100
 	defaultReadLimit = 1024 * 1024
 	defaultTimeout   = 5 * time.Second
+	defaultMetrics   = false
 )
 
 type Config struct {
@@ -34,6 +36,11 @@ type Config struct {
 	RateLimit int           `yaml:"rate_limit"`
 	ReadLimit int64         `yaml:"read_limit"`
 	Timeout   time.Duration `yaml:"timeout"`
+
+	// Metrics enables expvar metrics on /debug/vars, they include command line and memory stats.
+	Metrics bool `yaml:"metrics"`
+	// AdminToken enables admin actions on /admin for requests with "Authorization: Bearer <token>".
+	AdminToken string `yaml:"admin_token"`
 }
 
 func DefaultConfig() Config {
@@ -44,6 +51,7 @@ func DefaultConfig() Config {
 		RateLimit: defaultRateLimit,
 		ReadLimit: defaultReadLimit,
 		Timeout:   defaultTimeout,
+		Metrics:   defaultMetrics,
 	}
 }
 
@@ -52,6 +60,7 @@ type Server struct {
 
 	srv       *http.Server
 	shortener *handler.ShortenerHandler
+	admin     *handler.AdminHandler
 	logger    *slog.Logger
 }
 
@@ -79,19 +88,24 @@ func loggerMiddleware(logger *slog.Logger) func(next http.Handler) http.Handler
 	}
 }
 
-func New(logger *slog.Logger, shortener service.Shortener, config Config) *Server {
+// New creates server, admin actions are served only if config.AdminToken is set.
+func New(logger *slog.Logger, shortener service.Shortener, config Config, admin map[string]handler.AdminAction) *Server {
 	logger = logger.WithGroup("http")
 
 	srv := &http.Server{
 		Addr: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
 	}
 
-	return &Server{
+	s := &Server{
 		config:    config,
 		srv:       srv,
 		shortener: handler.NewShortener(logger, shortener, config.ReadLimit),
 		logger:    logger,
 	}
+	if config.AdminToken != "" {
+		s.admin = handler.NewAdmin(logger, config.AdminToken, admin)
+	}
+	return s
 }
 
 func (s *Server) ListenAndServe(ctx context.Context) error {
@@ -113,6 +127,12 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 		http.Error(w, "Not found", http.StatusNotFound)
 	})
 
+	if s.config.Metrics {
+		router.Get("/debug/vars", expvar.Handler().ServeHTTP)
+	}
+	if s.admin != nil {
+		s.admin.Register(router)
+	}
 	s.shortener.Register(router)
 
 	s.srv.Handler = router
@@ -0,0 +1,112 @@
+// Package lru implements size-bounded cache which evicts least recently used entries.
+package lru
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is safe for concurrent use.
+type Cache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	items   map[string]*list.Element
+	order   *list.List
+	evicted uint64
+}
+
+type entry[V any] struct {
+	key   string
+	value V
+}
+
+// New creates cache of size entries, zero size cache keeps nothing.
+func New[V any](size int) *Cache[V] {
+	return &Cache[V]{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*entry[V]).value, true
+}
+
+func (c *Cache[V]) Add(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*entry[V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[V]{key: key, value: value})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[V]).key)
+		c.evicted++
+	}
+}
+
+func (c *Cache[V]) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// Purge removes all entries.
+func (c *Cache[V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Evicted returns number of entries evicted because of size.
+func (c *Cache[V]) Evicted() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evicted
+}
+
+// Entries calls fn for entries from least to most recently used,
+// so adding them in this order restores the cache. fn must not call cache.
+func (c *Cache[V]) Entries(fn func(key string, value V)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.order.Back(); elem != nil; elem = elem.Prev() {
+		e := elem.Value.(*entry[V])
+		fn(e.key, e.value)
+	}
+}
@@ -0,0 +1,56 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	c := New[int](2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	_, ok := c.Get("a")
+	require.True(t, ok)
+
+	// "b" is least recently used.
+	c.Add("c", 3)
+	_, ok = c.Get("b")
+	require.False(t, ok)
+	require.Equal(t, uint64(1), c.Evicted())
+
+	c.Add("a", 10)
+	value, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 10, value)
+	require.Equal(t, 2, c.Len())
+
+	c.Remove("a")
+	_, ok = c.Get("a")
+	require.False(t, ok)
+
+	c.Purge()
+	require.Equal(t, 0, c.Len())
+}
+
+func TestLRUZeroSize(t *testing.T) {
+	c := New[int](0)
+	c.Add("a", 1)
+	_, ok := c.Get("a")
+	require.False(t, ok)
+}
+
+func TestLRUEntries(t *testing.T) {
+	c := New[int](3)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Add("c", 3)
+	c.Get("a")
+
+	var keys []string
+	c.Entries(func(key string, _ int) {
+		keys = append(keys, key)
+	})
+	require.Equal(t, []string{"b", "c", "a"}, keys)
+}
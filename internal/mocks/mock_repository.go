@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 
 	domain "github.com/amanakin/shortener/internal/domain"
+	repository "github.com/amanakin/shortener/internal/repository"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -76,3 +77,162 @@ func (mr *MockShortenerRepoMockRecorder) Store(ctx, link interface{}) *gomock.Ca
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Store", reflect.TypeOf((*MockShortenerRepo)(nil).Store), ctx, link)
 }
+
+// MockUnicodeHosts is a mock of UnicodeHosts interface.
+type MockUnicodeHosts struct {
+	ctrl     *gomock.Controller
+	recorder *MockUnicodeHostsMockRecorder
+}
+
+// MockUnicodeHostsMockRecorder is the mock recorder for MockUnicodeHosts.
+type MockUnicodeHostsMockRecorder struct {
+	mock *MockUnicodeHosts
+}
+
+// NewMockUnicodeHosts creates a new mock instance.
+func NewMockUnicodeHosts(ctrl *gomock.Controller) *MockUnicodeHosts {
+	mock := &MockUnicodeHosts{ctrl: ctrl}
+	mock.recorder = &MockUnicodeHostsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUnicodeHosts) EXPECT() *MockUnicodeHostsMockRecorder {
+	return m.recorder
+}
+
+// StoreUnicodeHost mocks base method.
+func (m *MockUnicodeHosts) StoreUnicodeHost(ctx context.Context, shortened, host string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreUnicodeHost", ctx, shortened, host)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreUnicodeHost indicates an expected call of StoreUnicodeHost.
+func (mr *MockUnicodeHostsMockRecorder) StoreUnicodeHost(ctx, shortened, host interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreUnicodeHost", reflect.TypeOf((*MockUnicodeHosts)(nil).StoreUnicodeHost), ctx, shortened, host)
+}
+
+// UnicodeHost mocks base method.
+func (m *MockUnicodeHosts) UnicodeHost(ctx context.Context, shortened string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnicodeHost", ctx, shortened)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UnicodeHost indicates an expected call of UnicodeHost.
+func (mr *MockUnicodeHostsMockRecorder) UnicodeHost(ctx, shortened interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnicodeHost", reflect.TypeOf((*MockUnicodeHosts)(nil).UnicodeHost), ctx, shortened)
+}
+
+// MockWrapper is a mock of Wrapper interface.
+type MockWrapper struct {
+	ctrl     *gomock.Controller
+	recorder *MockWrapperMockRecorder
+}
+
+// MockWrapperMockRecorder is the mock recorder for MockWrapper.
+type MockWrapperMockRecorder struct {
+	mock *MockWrapper
+}
+
+// NewMockWrapper creates a new mock instance.
+func NewMockWrapper(ctrl *gomock.Controller) *MockWrapper {
+	mock := &MockWrapper{ctrl: ctrl}
+	mock.recorder = &MockWrapperMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWrapper) EXPECT() *MockWrapperMockRecorder {
+	return m.recorder
+}
+
+// Unwrap mocks base method.
+func (m *MockWrapper) Unwrap() repository.ShortenerRepo {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unwrap")
+	ret0, _ := ret[0].(repository.ShortenerRepo)
+	return ret0
+}
+
+// Unwrap indicates an expected call of Unwrap.
+func (mr *MockWrapperMockRecorder) Unwrap() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unwrap", reflect.TypeOf((*MockWrapper)(nil).Unwrap))
+}
+
+// MockNotifier is a mock of Notifier interface.
+type MockNotifier struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotifierMockRecorder
+}
+
+// MockNotifierMockRecorder is the mock recorder for MockNotifier.
+type MockNotifierMockRecorder struct {
+	mock *MockNotifier
+}
+
+// NewMockNotifier creates a new mock instance.
+func NewMockNotifier(ctrl *gomock.Controller) *MockNotifier {
+	mock := &MockNotifier{ctrl: ctrl}
+	mock.recorder = &MockNotifierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotifier) EXPECT() *MockNotifierMockRecorder {
+	return m.recorder
+}
+
+// Listen mocks base method.
+func (m *MockNotifier) Listen(ctx context.Context, evict func(string), flush func()) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Listen", ctx, evict, flush)
+}
+
+// Listen indicates an expected call of Listen.
+func (mr *MockNotifierMockRecorder) Listen(ctx, evict, flush interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Listen", reflect.TypeOf((*MockNotifier)(nil).Listen), ctx, evict, flush)
+}
+
+// MockShared is a mock of Shared interface.
+type MockShared struct {
+	ctrl     *gomock.Controller
+	recorder *MockSharedMockRecorder
+}
+
+// MockSharedMockRecorder is the mock recorder for MockShared.
+type MockSharedMockRecorder struct {
+	mock *MockShared
+}
+
+// NewMockShared creates a new mock instance.
+func NewMockShared(ctrl *gomock.Controller) *MockShared {
+	mock := &MockShared{ctrl: ctrl}
+	mock.recorder = &MockSharedMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockShared) EXPECT() *MockSharedMockRecorder {
+	return m.recorder
+}
+
+// Shared mocks base method.
+func (m *MockShared) Shared() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Shared")
+}
+
+// Shared indicates an expected call of Shared.
+func (mr *MockSharedMockRecorder) Shared() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shared", reflect.TypeOf((*MockShared)(nil).Shared))
+}
@@ -0,0 +1,251 @@
+// Package bloom implements repository.ShortenerRepo decorator, which answers
+// definitely unknown shortened URLs from in-memory Bloom filter.
+package bloom
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultEnabled           = false
+	defaultFalsePositiveRate = 0.01
+	defaultGrowth            = 1
+	defaultRebuildInterval   = time.Hour
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// FalsePositiveRate is share of unknown shortened URLs passed to repository.
+	FalsePositiveRate float64 `yaml:"false_positive_rate"`
+	// Growth is capacity for links stored until next rebuild, relative to number of links.
+	Growth float64 `yaml:"growth"`
+	// RebuildInterval is period of filter rebuilds, they drop deleted links and resize filter.
+	RebuildInterval time.Duration `yaml:"rebuild_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:           defaultEnabled,
+		FalsePositiveRate: defaultFalsePositiveRate,
+		Growth:            defaultGrowth,
+		RebuildInterval:   defaultRebuildInterval,
+	}
+}
+
+// Scanner is implemented by repositories which can list all links.
+type Scanner interface {
+	// CountLinks returns number of links.
+	CountLinks(ctx context.Context) (int, error)
+	// ScanShortened calls fn for every shortened URL, it stops on first error.
+	ScanShortened(ctx context.Context, fn func(shortened string) error) error
+}
+
+// Repo implements repository.ShortenerRepo.
+// Until filter is built (see Run), all calls go to repository.
+type Repo struct {
+	repo     repository.ShortenerRepo
+	scanner  Scanner
+	notifier repository.Notifier
+	config   Config
+
+	mu sync.RWMutex
+	// current is nil until it's built or after missed notifications.
+	current *filter
+	// building gets links stored while it's being built.
+	building  *filter
+	rebuildMu sync.Mutex
+	rebuild   chan struct{}
+
+	metrics        *expvar.Map
+	definiteMisses *expvar.Int
+	falsePositives *expvar.Int
+	rebuilds       *expvar.Int
+}
+
+// New wraps repo, it must implement Scanner. Links stored by other replicas
+// are added to filter with notifications, so repository.Shared repo must implement repository.Notifier.
+func New(repo repository.ShortenerRepo, config Config) (*Repo, error) {
+	if config.FalsePositiveRate <= 0 || config.FalsePositiveRate >= 1 {
+		return nil, errors.New("false positive rate must be in (0, 1)")
+	}
+	if config.Growth < 0 {
+		return nil, errors.New("growth must not be negative")
+	}
+	if config.RebuildInterval <= 0 {
+		return nil, errors.New("rebuild interval must be positive")
+	}
+
+	scanner, ok := repository.As[Scanner](repo)
+	if !ok {
+		return nil, fmt.Errorf("repository %T can't scan links", repo)
+	}
+	notifier, _ := repository.As[repository.Notifier](repo)
+	// Links of other replicas would be answered as definitely unknown until rebuild.
+	if _, shared := repository.As[repository.Shared](repo); shared && notifier == nil {
+		return nil, fmt.Errorf("repository %T is shared, but doesn't notify of changes", repo)
+	}
+
+	r := &Repo{
+		repo:           repo,
+		scanner:        scanner,
+		notifier:       notifier,
+		config:         config,
+		rebuild:        make(chan struct{}, 1),
+		metrics:        new(expvar.Map).Init(),
+		definiteMisses: new(expvar.Int),
+		falsePositives: new(expvar.Int),
+		rebuilds:       new(expvar.Int),
+	}
+	r.metrics.Set("definite_misses", r.definiteMisses)
+	r.metrics.Set("false_positives", r.falsePositives)
+	r.metrics.Set("rebuilds", r.rebuilds)
+	r.metrics.Set("size_bytes", expvar.Func(func() any {
+		if f := r.filter(); f != nil {
+			return f.SizeBytes()
+		}
+		return 0
+	}))
+	r.metrics.Set("ready", expvar.Func(func() any { return r.filter() != nil }))
+
+	return r, nil
+}
+
+func (r *Repo) filter() *filter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.current
+}
+
+// add adds shortened URL to current filter and one being built.
+func (r *Repo) add(shortened string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.current != nil {
+		r.current.Add(shortened)
+	}
+	if r.building != nil {
+		r.building.Add(shortened)
+	}
+}
+
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	stored, err := r.repo.Store(ctx, link)
+	if err == nil {
+		r.add(stored.ShortenedURL)
+	}
+	return stored, err
+}
+
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	f := r.filter()
+	if f != nil && !f.Has(shortened) {
+		r.definiteMisses.Add(1)
+		return "", service.ErrNotFound
+	}
+
+	original, err := r.repo.Get(ctx, shortened)
+	if f != nil && errors.Is(err, service.ErrNotFound) {
+		r.falsePositives.Add(1)
+	}
+	return original, err
+}
+
+// Run builds filter and rebuilds it periodically until ctx is done.
+func (r *Repo) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	if r.notifier != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.notifier.Listen(ctx, r.add, r.invalidate)
+		}()
+	}
+
+	ticker := time.NewTicker(r.config.RebuildInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Rebuild(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("bloom filter rebuild", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.rebuild:
+		}
+	}
+}
+
+// invalidate stops using filter, which may miss links, until it's rebuilt.
+func (r *Repo) invalidate() {
+	r.mu.Lock()
+	r.current = nil
+	r.mu.Unlock()
+
+	select {
+	case r.rebuild <- struct{}{}:
+	default:
+	}
+}
+
+// Rebuild builds filter sized for current number of links by scanning repository.
+func (r *Repo) Rebuild(ctx context.Context) error {
+	r.rebuildMu.Lock()
+	defer r.rebuildMu.Unlock()
+
+	count, err := r.scanner.CountLinks(ctx)
+	if err != nil {
+		return fmt.Errorf("count links: %w", err)
+	}
+
+	f := newFilter(int(float64(count)*(1+r.config.Growth)), r.config.FalsePositiveRate)
+	r.mu.Lock()
+	r.building = f
+	r.mu.Unlock()
+
+	err = r.scanner.ScanShortened(ctx, func(shortened string) error {
+		f.Add(shortened)
+		return nil
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.building = nil
+	if err != nil {
+		return fmt.Errorf("scan links: %w", err)
+	}
+	r.current = f
+	r.rebuilds.Add(1)
+	return nil
+}
+
+// Metrics returns definite misses, false positives, rebuilds, filter size and readiness.
+func (r *Repo) Metrics() expvar.Var {
+	return r.metrics
+}
+
+// Unwrap returns filtered repository.
+func (r *Repo) Unwrap() repository.ShortenerRepo {
+	return r.repo
+}
+
+func (r *Repo) Close(ctx context.Context) {
+	r.repo.Close(ctx)
+}
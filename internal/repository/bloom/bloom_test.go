@@ -0,0 +1,97 @@
+package bloom
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/amanakin/shortener/internal/repository/repotest"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloom(t *testing.T) {
+	ctx := context.Background()
+	inner := maprepo.New()
+	stored := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err := inner.Store(ctx, stored)
+	require.NoError(t, err)
+
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+
+	// Not built filter passes everything to repository.
+	_, err = repo.Get(ctx, "unknown")
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.Equal(t, int64(0), repo.definiteMisses.Value())
+
+	require.NoError(t, repo.Rebuild(ctx))
+	original, err := repo.Get(ctx, stored.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, stored.OriginalURL, original)
+
+	_, err = repo.Get(ctx, "unknown")
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.Equal(t, int64(1), repo.definiteMisses.Value())
+
+	link := domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"}
+	_, err = repo.Store(ctx, link)
+	require.NoError(t, err)
+	original, err = repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+}
+
+func TestBloomNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner := repotest.NewNotifyingRepo(maprepo.New())
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		repo.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return repo.rebuilds.Value() == 1
+	}, time.Second, time.Millisecond)
+
+	// Link stored by another replica.
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err = inner.Store(ctx, link)
+	require.NoError(t, err)
+	inner.Changes <- link.ShortenedURL
+
+	require.Eventually(t, func() bool {
+		original, err := repo.Get(ctx, link.ShortenedURL)
+		return err == nil && original == link.OriginalURL
+	}, time.Second, time.Millisecond)
+
+	inner.Flushes <- struct{}{}
+	require.Eventually(t, func() bool {
+		return repo.rebuilds.Value() == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+// sharedRepo is shared by replicas, but doesn't notify of changes.
+type sharedRepo struct {
+	*maprepo.Repo
+}
+
+func (sharedRepo) Shared() {}
+
+func TestBloomShared(t *testing.T) {
+	_, err := New(sharedRepo{maprepo.New()}, DefaultConfig())
+	require.Error(t, err)
+
+	_, err = New(repotest.NewNotifyingRepo(sharedRepo{maprepo.New()}), DefaultConfig())
+	require.NoError(t, err)
+}
@@ -0,0 +1,77 @@
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// minCapacity keeps filter useful for empty repository.
+const minCapacity = 1024
+
+// filter is Bloom filter of strings, it is safe for concurrent use.
+type filter struct {
+	seed   maphash.Seed
+	bits   []atomic.Uint64
+	m      uint64
+	hashes uint64
+}
+
+// newFilter creates filter of capacity items with false positive rate p.
+func newFilter(capacity int, p float64) *filter {
+	if capacity < minCapacity {
+		capacity = minCapacity
+	}
+
+	n := float64(capacity)
+	m := math.Ceil(-n * math.Log(p) / (math.Ln2 * math.Ln2))
+	hashes := math.Max(1, math.Round(m/n*math.Ln2))
+
+	words := (uint64(m) + 63) / 64
+	return &filter{
+		seed:   maphash.MakeSeed(),
+		bits:   make([]atomic.Uint64, words),
+		m:      words * 64,
+		hashes: uint64(hashes),
+	}
+}
+
+// locations uses double hashing: i-th bit is h1 + i*h2.
+func (f *filter) locations(s string) (uint64, uint64) {
+	h := maphash.String(f.seed, s)
+	h1 := h & math.MaxUint32
+	h2 := h>>32 | 1
+	return h1, h2
+}
+
+func (f *filter) Add(s string) {
+	h1, h2 := f.locations(s)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		word := &f.bits[bit/64]
+		mask := uint64(1) << (bit % 64)
+		for {
+			old := word.Load()
+			if old&mask != 0 || word.CompareAndSwap(old, old|mask) {
+				break
+			}
+		}
+	}
+}
+
+// Has reports false if s was definitely not added.
+func (f *filter) Has(s string) bool {
+	h1, h2 := f.locations(s)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64].Load()&(uint64(1)<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SizeBytes returns memory used by bits.
+func (f *filter) SizeBytes() int {
+	return len(f.bits) * 8
+}
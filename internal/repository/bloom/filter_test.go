@@ -0,0 +1,31 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	const (
+		n = 10000
+		p = 0.01
+	)
+	f := newFilter(n, p)
+
+	for i := 0; i < n; i++ {
+		f.Add("in" + strconv.Itoa(i))
+	}
+	for i := 0; i < n; i++ {
+		require.True(t, f.Has("in"+strconv.Itoa(i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.Has("out" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	require.Less(t, float64(falsePositives)/n, 2*p)
+}
@@ -0,0 +1,345 @@
+// Package cache implements read-through caching decorator of repository.ShortenerRepo.
+package cache
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/lru"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/exp/slog"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultEnabled       = false
+	defaultSize          = 10000
+	defaultNegativeSize  = 10000
+	defaultNegativeTTL   = 5 * time.Second
+	defaultWarmUp        = 1000
+	defaultFlushInterval = time.Minute
+	defaultLoadTimeout   = 5 * time.Second
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// Size is max number of cached links.
+	Size int `yaml:"size"`
+	// NegativeSize is max number of cached unknown shortened URLs, zero disables negative cache.
+	NegativeSize int `yaml:"negative_size"`
+	// NegativeTTL is time unknown shortened URL is answered from cache.
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+	// WarmUp is number of most clicked links loaded on start.
+	WarmUp int `yaml:"warm_up"`
+	// FlushInterval is period of saving click counters to repository.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// LoadTimeout limits loading of missed link, it's shared by concurrent callers
+	// and doesn't stop when one of them leaves.
+	LoadTimeout time.Duration `yaml:"load_timeout"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:       defaultEnabled,
+		Size:          defaultSize,
+		NegativeSize:  defaultNegativeSize,
+		NegativeTTL:   defaultNegativeTTL,
+		WarmUp:        defaultWarmUp,
+		FlushInterval: defaultFlushInterval,
+		LoadTimeout:   defaultLoadTimeout,
+	}
+}
+
+// Clicks is implemented by repositories which count resolves of links.
+type Clicks interface {
+	// AddClicks adds numbers of resolves to counters of shortened URLs.
+	AddClicks(ctx context.Context, clicks map[string]uint64) error
+	// MostClicked returns up to limit links with most clicks.
+	MostClicked(ctx context.Context, limit int) ([]domain.Link, error)
+}
+
+// Expiring is implemented by repositories which expire links.
+type Expiring interface {
+	// LinkTTL returns lifetime of links, zero if they don't expire.
+	LinkTTL() time.Duration
+}
+
+// Repo implements repository.ShortenerRepo.
+// It caches resolved links in LRU cache and unknown shortened URLs for short TTL,
+// concurrent misses of one shortened URL make single repository call.
+// Stored links are added to cache, so they never stay negatively cached.
+type Repo struct {
+	repo     repository.ShortenerRepo
+	clicks   Clicks
+	notifier repository.Notifier
+	config   Config
+
+	positive *lru.Cache[string]
+	// negative keeps expiration time of unknown shortened URLs.
+	negative *lru.Cache[time.Time]
+	group    singleflight.Group
+	// generation changes on every eviction, so values loaded before it are not cached.
+	generation atomic.Uint64
+
+	mu      sync.Mutex
+	counted map[string]uint64
+
+	metrics      *expvar.Map
+	hits         *expvar.Int
+	misses       *expvar.Int
+	negativeHits *expvar.Int
+	coalesced    *expvar.Int
+	notified     *expvar.Int
+	flushes      *expvar.Int
+}
+
+// New wraps repo with cache, click counters are kept if repo implements Clicks,
+// changes made by other replicas are evicted if repo implements repository.Notifier.
+func New(repo repository.ShortenerRepo, config Config) (*Repo, error) {
+	if config.Size <= 0 {
+		return nil, errors.New("cache size must be positive")
+	}
+	if config.NegativeSize > 0 && config.NegativeTTL <= 0 {
+		return nil, errors.New("negative TTL must be positive")
+	}
+	if config.FlushInterval <= 0 {
+		return nil, errors.New("flush interval must be positive")
+	}
+	if config.LoadTimeout <= 0 {
+		return nil, errors.New("load timeout must be positive")
+	}
+
+	// Cached links have no TTL, expired ones would be resolved until they're evicted.
+	if expiring, ok := repository.As[Expiring](repo); ok && expiring.LinkTTL() > 0 {
+		return nil, fmt.Errorf("repository %T expires links, they can't be cached", repo)
+	}
+
+	clicks, _ := repository.As[Clicks](repo)
+	notifier, _ := repository.As[repository.Notifier](repo)
+	r := &Repo{
+		repo:         repo,
+		clicks:       clicks,
+		notifier:     notifier,
+		config:       config,
+		positive:     lru.New[string](config.Size),
+		negative:     lru.New[time.Time](config.NegativeSize),
+		counted:      make(map[string]uint64),
+		metrics:      new(expvar.Map).Init(),
+		hits:         new(expvar.Int),
+		misses:       new(expvar.Int),
+		negativeHits: new(expvar.Int),
+		coalesced:    new(expvar.Int),
+		notified:     new(expvar.Int),
+		flushes:      new(expvar.Int),
+	}
+	r.metrics.Set("hits", r.hits)
+	r.metrics.Set("misses", r.misses)
+	r.metrics.Set("negative_hits", r.negativeHits)
+	r.metrics.Set("coalesced", r.coalesced)
+	r.metrics.Set("notified", r.notified)
+	r.metrics.Set("flushes", r.flushes)
+	r.metrics.Set("size", expvar.Func(func() any { return r.positive.Len() }))
+	r.metrics.Set("negative_size", expvar.Func(func() any { return r.negative.Len() }))
+	r.metrics.Set("evicted", expvar.Func(func() any { return r.positive.Evicted() }))
+
+	return r, nil
+}
+
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	stored, err := r.repo.Store(ctx, link)
+	if err != nil {
+		return stored, err
+	}
+
+	r.negative.Remove(stored.ShortenedURL)
+	r.positive.Add(stored.ShortenedURL, stored.OriginalURL)
+	return stored, nil
+}
+
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	if original, ok := r.positive.Get(shortened); ok {
+		r.hits.Add(1)
+		r.count(shortened)
+		return original, nil
+	}
+
+	if expires, ok := r.negative.Get(shortened); ok {
+		if time.Now().Before(expires) {
+			r.negativeHits.Add(1)
+			return "", service.ErrNotFound
+		}
+		r.negative.Remove(shortened)
+	}
+
+	r.misses.Add(1)
+	loaded := r.group.DoChan(shortened, func() (any, error) {
+		// Canceled request of the first caller must not fail the others.
+		ctx, cancel := context.WithTimeout(context.Background(), r.config.LoadTimeout)
+		defer cancel()
+
+		generation := r.generation.Load()
+		original, err := r.repo.Get(ctx, shortened)
+		switch {
+		case generation != r.generation.Load():
+			// Link changed while it was loaded, next Get loads it again.
+		case err == nil:
+			r.positive.Add(shortened, original)
+		case errors.Is(err, service.ErrNotFound):
+			r.negative.Add(shortened, time.Now().Add(r.config.NegativeTTL))
+		}
+		return original, err
+	})
+
+	var res singleflight.Result
+	select {
+	case res = <-loaded:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if res.Shared {
+		r.coalesced.Add(1)
+	}
+	if res.Err != nil {
+		return "", res.Err
+	}
+
+	r.count(shortened)
+	return res.Val.(string), nil
+}
+
+func (r *Repo) count(shortened string) {
+	if r.clicks == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counted[shortened]++
+}
+
+// Run listens for changes made by other replicas, loads most clicked links
+// and saves click counters periodically until ctx is done.
+func (r *Repo) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	if r.notifier != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.notifier.Listen(ctx, r.evict, r.Purge)
+		}()
+	}
+
+	if r.clicks == nil {
+		return
+	}
+
+	if err := r.WarmUp(ctx); err != nil {
+		slog.Error("cache warm up", slog.String("error", err.Error()))
+	}
+
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.flush(ctx); err != nil {
+				slog.Error("cache flush clicks", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Evict removes shortened URL from cache.
+func (r *Repo) Evict(shortened string) {
+	r.generation.Add(1)
+	r.positive.Remove(shortened)
+	r.negative.Remove(shortened)
+}
+
+func (r *Repo) evict(shortened string) {
+	r.notified.Add(1)
+	r.Evict(shortened)
+}
+
+// Purge removes everything from cache.
+func (r *Repo) Purge() {
+	r.flushes.Add(1)
+	r.generation.Add(1)
+	r.positive.Purge()
+	r.negative.Purge()
+}
+
+// WarmUp adds most clicked links to cache.
+func (r *Repo) WarmUp(ctx context.Context) error {
+	if r.clicks == nil || r.config.WarmUp <= 0 {
+		return nil
+	}
+
+	links, err := r.clicks.MostClicked(ctx, r.config.WarmUp)
+	if err != nil {
+		return fmt.Errorf("most clicked: %w", err)
+	}
+
+	// Most clicked are added last, so they are evicted last.
+	for i := len(links) - 1; i >= 0; i-- {
+		r.positive.Add(links[i].ShortenedURL, links[i].OriginalURL)
+	}
+	return nil
+}
+
+// flush saves click counters to repository, they are kept on error.
+func (r *Repo) flush(ctx context.Context) error {
+	r.mu.Lock()
+	counted := r.counted
+	r.counted = make(map[string]uint64)
+	r.mu.Unlock()
+
+	if len(counted) == 0 {
+		return nil
+	}
+
+	err := r.clicks.AddClicks(ctx, counted)
+	if err == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	for shortened, clicks := range counted {
+		r.counted[shortened] += clicks
+	}
+	r.mu.Unlock()
+	return fmt.Errorf("add clicks: %w", err)
+}
+
+// Metrics returns hits, misses, negative hits, coalesced misses, evicted and sizes of caches.
+func (r *Repo) Metrics() expvar.Var {
+	return r.metrics
+}
+
+// Unwrap returns cached repository.
+func (r *Repo) Unwrap() repository.ShortenerRepo {
+	return r.repo
+}
+
+// Close saves click counters and closes cached repository.
+func (r *Repo) Close(ctx context.Context) {
+	if r.clicks != nil {
+		if err := r.flush(ctx); err != nil {
+			slog.Error("cache flush clicks", slog.String("error", err.Error()))
+		}
+	}
+	r.repo.Close(ctx)
+}
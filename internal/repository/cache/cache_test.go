@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/amanakin/shortener/internal/repository/repotest"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepo counts Get calls, they block until release is closed.
+type countingRepo struct {
+	*maprepo.Repo
+	gets    atomic.Int64
+	release chan struct{}
+}
+
+func (r *countingRepo) Get(ctx context.Context, shortened string) (string, error) {
+	r.gets.Add(1)
+	if r.release != nil {
+		<-r.release
+	}
+	return r.Repo.Get(ctx, shortened)
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{Repo: maprepo.New()}
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err := inner.Store(ctx, link)
+	require.NoError(t, err)
+
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		original, err := repo.Get(ctx, link.ShortenedURL)
+		require.NoError(t, err)
+		require.Equal(t, link.OriginalURL, original)
+	}
+	require.Equal(t, int64(1), inner.gets.Load())
+	require.Equal(t, int64(2), repo.hits.Value())
+	require.Equal(t, int64(1), repo.misses.Value())
+}
+
+func TestCacheNegative(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{Repo: maprepo.New()}
+	config := DefaultConfig()
+	config.NegativeTTL = 50 * time.Millisecond
+	repo, err := New(inner, config)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err = repo.Get(ctx, "abc")
+		require.ErrorIs(t, err, service.ErrNotFound)
+	}
+	require.Equal(t, int64(1), inner.gets.Load())
+	require.Equal(t, int64(2), repo.negativeHits.Value())
+
+	// Expired entries go to repository again.
+	time.Sleep(config.NegativeTTL)
+	_, err = repo.Get(ctx, "abc")
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.Equal(t, int64(2), inner.gets.Load())
+
+	// Stored link replaces negative entry.
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err = repo.Store(ctx, link)
+	require.NoError(t, err)
+	original, err := repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+	require.Equal(t, int64(2), inner.gets.Load())
+}
+
+func TestCacheCoalesce(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingRepo{Repo: maprepo.New(), release: make(chan struct{})}
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err := inner.Store(ctx, link)
+	require.NoError(t, err)
+
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			original, err := repo.Get(ctx, link.ShortenedURL)
+			require.NoError(t, err)
+			require.Equal(t, link.OriginalURL, original)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return repo.misses.Value() == callers
+	}, time.Second, time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	require.Equal(t, int64(1), inner.gets.Load())
+	require.Equal(t, int64(callers), repo.coalesced.Value())
+}
+
+func TestCacheCoalesceCanceled(t *testing.T) {
+	inner := &countingRepo{Repo: maprepo.New(), release: make(chan struct{})}
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err := inner.Store(context.Background(), link)
+	require.NoError(t, err)
+
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := repo.Get(ctx, link.ShortenedURL)
+		first <- err
+	}()
+	require.Eventually(t, func() bool { return inner.gets.Load() == 1 }, time.Second, time.Millisecond)
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := repo.Get(context.Background(), link.ShortenedURL)
+		second <- err
+	}()
+	require.Eventually(t, func() bool { return repo.misses.Value() == 2 }, time.Second, time.Millisecond)
+
+	// The first caller leaves, the shared load goes on for the second one.
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+	close(inner.release)
+	require.NoError(t, <-second)
+	require.Equal(t, int64(1), inner.gets.Load())
+}
+
+func TestCacheClicks(t *testing.T) {
+	ctx := context.Background()
+	inner := maprepo.New()
+	links := []domain.Link{
+		{OriginalURL: "https://google.com", ShortenedURL: "abc"},
+		{OriginalURL: "https://ya.ru", ShortenedURL: "def"},
+	}
+	for _, link := range links {
+		_, err := inner.Store(ctx, link)
+		require.NoError(t, err)
+	}
+
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = repo.Get(ctx, "def")
+		require.NoError(t, err)
+	}
+	_, err = repo.Get(ctx, "abc")
+	require.NoError(t, err)
+	repo.Close(ctx)
+
+	mostClicked, err := inner.MostClicked(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, []domain.Link{links[1]}, mostClicked)
+
+	config := DefaultConfig()
+	config.WarmUp = 1
+	repo, err = New(inner, config)
+	require.NoError(t, err)
+	require.NoError(t, repo.WarmUp(ctx))
+	_, ok := repo.positive.Get("def")
+	require.True(t, ok)
+	_, ok = repo.positive.Get("abc")
+	require.False(t, ok)
+}
+
+func TestCacheUnwrap(t *testing.T) {
+	repo, err := New(maprepo.New(), DefaultConfig())
+	require.NoError(t, err)
+
+	_, ok := repository.As[*maprepo.Repo](repo)
+	require.True(t, ok)
+	_, ok = repository.As[Clicks](repo)
+	require.True(t, ok)
+}
+
+// expiringRepo expires links after ttl.
+type expiringRepo struct {
+	*maprepo.Repo
+	ttl time.Duration
+}
+
+func (r expiringRepo) LinkTTL() time.Duration {
+	return r.ttl
+}
+
+func TestCacheExpiring(t *testing.T) {
+	_, err := New(expiringRepo{Repo: maprepo.New(), ttl: time.Hour}, DefaultConfig())
+	require.Error(t, err)
+
+	_, err = New(expiringRepo{Repo: maprepo.New()}, DefaultConfig())
+	require.NoError(t, err)
+}
+
+func TestCacheNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner := repotest.NewNotifyingRepo(maprepo.New())
+	links := []domain.Link{
+		{OriginalURL: "https://google.com", ShortenedURL: "abc"},
+		{OriginalURL: "https://ya.ru", ShortenedURL: "def"},
+	}
+	for _, link := range links {
+		_, err := inner.Store(ctx, link)
+		require.NoError(t, err)
+	}
+
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		repo.Run(ctx)
+		close(done)
+	}()
+
+	for _, link := range links {
+		_, err = repo.Get(ctx, link.ShortenedURL)
+		require.NoError(t, err)
+	}
+	_, err = repo.Get(ctx, "unknown")
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	inner.Changes <- "abc"
+	inner.Changes <- "unknown"
+	require.Eventually(t, func() bool {
+		return repo.notified.Value() == 2
+	}, time.Second, time.Millisecond)
+	_, ok := repo.positive.Get("abc")
+	require.False(t, ok)
+	_, ok = repo.negative.Get("unknown")
+	require.False(t, ok)
+	_, ok = repo.positive.Get("def")
+	require.True(t, ok)
+
+	inner.Flushes <- struct{}{}
+	require.Eventually(t, func() bool {
+		return repo.flushes.Value() == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, 0, repo.positive.Len())
+
+	cancel()
+	<-done
+}
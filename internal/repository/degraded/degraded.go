@@ -0,0 +1,260 @@
+// Package degraded implements read-only mode of repository.ShortenerRepo,
+// which keeps recently resolved links available while storage is down.
+package degraded
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/lru"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultEnabled          = false
+	defaultSize             = 100000
+	defaultSnapshotInterval = time.Minute
+	defaultCheckInterval    = 5 * time.Second
+	defaultCheckTimeout     = time.Second
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// ReadOnly starts service in read-only mode, it's left only by admin.
+	ReadOnly bool `yaml:"read_only"`
+	// Size is max number of recently resolved links served in read-only mode.
+	Size int `yaml:"size"`
+	// Snapshot is path of file recently resolved links are kept in, empty disables it.
+	Snapshot string `yaml:"snapshot"`
+	// SnapshotInterval is period of snapshots, zero takes them only on shutdown.
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+	// CheckInterval is period of repository health checks.
+	CheckInterval time.Duration `yaml:"check_interval"`
+	// CheckTimeout limits single health check.
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:          defaultEnabled,
+		Size:             defaultSize,
+		SnapshotInterval: defaultSnapshotInterval,
+		CheckInterval:    defaultCheckInterval,
+		CheckTimeout:     defaultCheckTimeout,
+	}
+}
+
+// Pinger is implemented by repositories which can check their health.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Repo implements repository.ShortenerRepo.
+// It remembers recently resolved and stored links. In read-only mode Store
+// returns service.ErrReadOnly and Get answers remembered links without repository,
+// it also answers them when repository returns service.ErrUnavailable.
+// Read-only mode is set by admin or automatically while repository health check fails.
+type Repo struct {
+	repo   repository.ShortenerRepo
+	pinger Pinger
+	config Config
+
+	recent *lru.Cache[string]
+	// manual is set by admin, unhealthy is set by health checks.
+	manual    atomic.Bool
+	unhealthy atomic.Bool
+
+	snapshotMu sync.Mutex
+
+	metrics  *expvar.Map
+	hits     *expvar.Int
+	misses   *expvar.Int
+	rejected *expvar.Int
+}
+
+// New wraps repo and loads config.Snapshot if it exists.
+// Mode is switched automatically only if repo implements Pinger.
+func New(repo repository.ShortenerRepo, config Config) (*Repo, error) {
+	if config.Size <= 0 {
+		return nil, errors.New("size must be positive")
+	}
+	if config.CheckInterval <= 0 {
+		return nil, errors.New("check interval must be positive")
+	}
+	if config.CheckTimeout <= 0 {
+		return nil, errors.New("check timeout must be positive")
+	}
+
+	pinger, _ := repository.As[Pinger](repo)
+	r := &Repo{
+		repo:     repo,
+		pinger:   pinger,
+		config:   config,
+		recent:   lru.New[string](config.Size),
+		metrics:  new(expvar.Map).Init(),
+		hits:     new(expvar.Int),
+		misses:   new(expvar.Int),
+		rejected: new(expvar.Int),
+	}
+	r.manual.Store(config.ReadOnly)
+	r.metrics.Set("mode", expvar.Func(func() any { return r.mode() }))
+	r.metrics.Set("manual", expvar.Func(func() any { return r.manual.Load() }))
+	r.metrics.Set("unhealthy", expvar.Func(func() any { return r.unhealthy.Load() }))
+	r.metrics.Set("hits", r.hits)
+	r.metrics.Set("misses", r.misses)
+	r.metrics.Set("rejected", r.rejected)
+	r.metrics.Set("size", expvar.Func(func() any { return r.recent.Len() }))
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadOnly reports whether links can't be stored now.
+func (r *Repo) ReadOnly() bool {
+	return r.manual.Load() || r.unhealthy.Load()
+}
+
+// SetReadOnly switches read-only mode set by admin,
+// mode set by health checks stays until repository is healthy.
+func (r *Repo) SetReadOnly(readOnly bool) {
+	if r.manual.Swap(readOnly) != readOnly {
+		slog.Warn("read-only mode switched by admin", slog.Bool("read_only", readOnly))
+	}
+}
+
+func (r *Repo) mode() string {
+	if r.ReadOnly() {
+		return "read-only"
+	}
+	return "read-write"
+}
+
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	if r.ReadOnly() {
+		r.rejected.Add(1)
+		return link, service.ErrReadOnly
+	}
+
+	stored, err := r.repo.Store(ctx, link)
+	if err != nil {
+		r.failed(err)
+		return stored, err
+	}
+
+	r.recent.Add(stored.ShortenedURL, stored.OriginalURL)
+	return stored, nil
+}
+
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	if r.ReadOnly() {
+		if original, ok := r.recent.Get(shortened); ok {
+			r.hits.Add(1)
+			return original, nil
+		}
+	}
+
+	original, err := r.repo.Get(ctx, shortened)
+	if err == nil {
+		r.recent.Add(shortened, original)
+		return original, nil
+	}
+	if !errors.Is(err, service.ErrUnavailable) {
+		return "", err
+	}
+
+	r.failed(err)
+	if original, ok := r.recent.Get(shortened); ok {
+		r.hits.Add(1)
+		return original, nil
+	}
+	r.misses.Add(1)
+	return "", err
+}
+
+// failed switches to read-only mode without waiting for health check,
+// if repository is unavailable and the check will switch it back.
+func (r *Repo) failed(err error) {
+	if r.pinger != nil && errors.Is(err, service.ErrUnavailable) {
+		r.setUnhealthy(true, err)
+	}
+}
+
+func (r *Repo) setUnhealthy(unhealthy bool, err error) {
+	if r.unhealthy.Swap(unhealthy) == unhealthy {
+		return
+	}
+	if unhealthy {
+		slog.Warn("repository is unavailable, switched to read-only mode", slog.String("error", err.Error()))
+	} else {
+		slog.Info("repository is healthy, switched to read-write mode")
+	}
+}
+
+// Check pings repository and switches mode by result.
+func (r *Repo) Check(ctx context.Context) {
+	if r.pinger == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.CheckTimeout)
+	defer cancel()
+
+	err := r.pinger.Ping(ctx)
+	r.setUnhealthy(err != nil, err)
+}
+
+// Run checks repository health and takes snapshots periodically until ctx is done.
+func (r *Repo) Run(ctx context.Context) {
+	check := time.NewTicker(r.config.CheckInterval)
+	defer check.Stop()
+
+	var snapshot <-chan time.Time
+	if r.config.Snapshot != "" && r.config.SnapshotInterval > 0 {
+		ticker := time.NewTicker(r.config.SnapshotInterval)
+		defer ticker.Stop()
+		snapshot = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-check.C:
+			r.Check(ctx)
+		case <-snapshot:
+			if err := r.SaveRecent(); err != nil {
+				slog.Error("save recent links", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Metrics returns mode, hits and misses of recent links in read-only mode,
+// rejected stores and number of recent links.
+func (r *Repo) Metrics() expvar.Var {
+	return r.metrics
+}
+
+// Unwrap returns wrapped repository.
+func (r *Repo) Unwrap() repository.ShortenerRepo {
+	return r.repo
+}
+
+// Close saves recent links and closes wrapped repository.
+func (r *Repo) Close(ctx context.Context) {
+	if r.config.Snapshot != "" {
+		if err := r.SaveRecent(); err != nil {
+			slog.Error("save recent links", slog.String("error", err.Error()))
+		}
+	}
+	r.repo.Close(ctx)
+}
@@ -0,0 +1,190 @@
+package degraded
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyRepo returns service.ErrUnavailable from all calls while it's down.
+type flakyRepo struct {
+	*maprepo.Repo
+	down atomic.Bool
+	gets atomic.Int64
+}
+
+func (r *flakyRepo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	if r.down.Load() {
+		return link, service.ErrUnavailable
+	}
+	return r.Repo.Store(ctx, link)
+}
+
+func (r *flakyRepo) Get(ctx context.Context, shortened string) (string, error) {
+	r.gets.Add(1)
+	if r.down.Load() {
+		return "", service.ErrUnavailable
+	}
+	return r.Repo.Get(ctx, shortened)
+}
+
+// pingingRepo is flakyRepo with health check.
+type pingingRepo struct {
+	*flakyRepo
+}
+
+func (r pingingRepo) Ping(context.Context) error {
+	if r.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+var link = domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+
+func TestDegradedUnavailable(t *testing.T) {
+	ctx := context.Background()
+	inner := &flakyRepo{Repo: maprepo.New()}
+	_, err := inner.Store(ctx, link)
+	require.NoError(t, err)
+	_, err = inner.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"})
+	require.NoError(t, err)
+
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+
+	original, err := repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+
+	inner.down.Store(true)
+	original, err = repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+
+	// Link wasn't resolved before.
+	_, err = repo.Get(ctx, "def")
+	require.ErrorIs(t, err, service.ErrUnavailable)
+
+	// Without health check repository errors don't switch mode.
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://go.dev", ShortenedURL: "ghi"})
+	require.ErrorIs(t, err, service.ErrUnavailable)
+	require.False(t, repo.ReadOnly())
+	require.Equal(t, int64(1), repo.hits.Value())
+	require.Equal(t, int64(1), repo.misses.Value())
+}
+
+func TestDegradedHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	inner := pingingRepo{&flakyRepo{Repo: maprepo.New()}}
+	repo, err := New(inner, DefaultConfig())
+	require.NoError(t, err)
+
+	_, err = repo.Store(ctx, link)
+	require.NoError(t, err)
+
+	// Failed call switches mode before health check.
+	inner.down.Store(true)
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"})
+	require.ErrorIs(t, err, service.ErrUnavailable)
+	require.True(t, repo.ReadOnly())
+
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"})
+	require.ErrorIs(t, err, service.ErrReadOnly)
+
+	// Stored links are resolved without repository.
+	gets := inner.gets.Load()
+	original, err := repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+	require.Equal(t, gets, inner.gets.Load())
+
+	repo.Check(ctx)
+	require.True(t, repo.ReadOnly())
+
+	inner.down.Store(false)
+	repo.Check(ctx)
+	require.False(t, repo.ReadOnly())
+
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"})
+	require.NoError(t, err)
+}
+
+func TestDegradedManual(t *testing.T) {
+	ctx := context.Background()
+	inner := pingingRepo{&flakyRepo{Repo: maprepo.New()}}
+	config := DefaultConfig()
+	config.ReadOnly = true
+	repo, err := New(inner, config)
+	require.NoError(t, err)
+	require.True(t, repo.ReadOnly())
+
+	_, err = repo.Store(ctx, link)
+	require.ErrorIs(t, err, service.ErrReadOnly)
+
+	// Healthy repository doesn't leave mode set by admin.
+	repo.Check(ctx)
+	require.True(t, repo.ReadOnly())
+
+	repo.SetReadOnly(false)
+	require.False(t, repo.ReadOnly())
+	_, err = repo.Store(ctx, link)
+	require.NoError(t, err)
+
+	// Admin doesn't leave mode set by health check.
+	inner.down.Store(true)
+	repo.Check(ctx)
+	repo.SetReadOnly(true)
+	repo.SetReadOnly(false)
+	require.True(t, repo.ReadOnly())
+}
+
+func TestDegradedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Size = 2
+	config.Snapshot = filepath.Join(t.TempDir(), "recent")
+
+	inner := &flakyRepo{Repo: maprepo.New()}
+	links := []domain.Link{
+		{OriginalURL: "https://google.com", ShortenedURL: "abc"},
+		{OriginalURL: "https://ya.ru", ShortenedURL: "def"},
+		{OriginalURL: "https://go.dev", ShortenedURL: "ghi"},
+	}
+	for _, link := range links {
+		_, err := inner.Store(ctx, link)
+		require.NoError(t, err)
+	}
+
+	repo, err := New(inner, config)
+	require.NoError(t, err)
+	for _, shortened := range []string{"abc", "def", "ghi", "def"} {
+		_, err = repo.Get(ctx, shortened)
+		require.NoError(t, err)
+	}
+	repo.Close(ctx)
+
+	// Restarted while repository is down, recent links are kept in order of use.
+	inner = &flakyRepo{Repo: maprepo.New()}
+	inner.down.Store(true)
+	repo, err = New(inner, config)
+	require.NoError(t, err)
+	defer repo.Close(ctx)
+
+	original, err := repo.Get(ctx, "ghi")
+	require.NoError(t, err)
+	require.Equal(t, "https://go.dev", original)
+	repo.recent.Add("jkl", "https://example.com")
+
+	_, err = repo.Get(ctx, "abc")
+	require.ErrorIs(t, err, service.ErrUnavailable)
+	_, err = repo.Get(ctx, "def")
+	require.ErrorIs(t, err, service.ErrUnavailable)
+}
@@ -0,0 +1,79 @@
+package degraded
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/snapfile"
+)
+
+const snapshotVersion = 1
+
+// snapshot is gob encoded in gzip stream,
+// links go from least to most recently used, so reading it keeps their order.
+type snapshot struct {
+	Version int
+	Links   []domain.Link
+}
+
+// WriteRecent writes recent links to w.
+func (r *Repo) WriteRecent(w io.Writer) error {
+	snap := snapshot{Version: snapshotVersion}
+	r.recent.Entries(func(shortened, original string) {
+		snap.Links = append(snap.Links, domain.Link{OriginalURL: original, ShortenedURL: shortened})
+	})
+
+	return snapfile.Encode(w, snap)
+}
+
+// ReadRecent adds links from snapshot to recent ones.
+func (r *Repo) ReadRecent(rd io.Reader) error {
+	var snap snapshot
+	if err := snapfile.Decode(rd, &snap); err != nil {
+		return err
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unknown snapshot version %d", snap.Version)
+	}
+
+	for _, link := range snap.Links {
+		r.recent.Add(link.ShortenedURL, link.OriginalURL)
+	}
+	return nil
+}
+
+// SaveRecent writes recent links to configured snapshot file atomically.
+func (r *Repo) SaveRecent() error {
+	if r.config.Snapshot == "" {
+		return errors.New("snapshot path is not configured")
+	}
+
+	r.snapshotMu.Lock()
+	defer r.snapshotMu.Unlock()
+
+	return snapfile.Write(r.config.Snapshot, r.WriteRecent)
+}
+
+// load reads configured snapshot file if it exists.
+func (r *Repo) load() error {
+	if r.config.Snapshot == "" {
+		return nil
+	}
+
+	file, err := os.Open(r.config.Snapshot)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	if err = r.ReadRecent(file); err != nil {
+		return fmt.Errorf("read snapshot %s: %w", r.config.Snapshot, err)
+	}
+	return nil
+}
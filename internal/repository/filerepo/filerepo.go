@@ -0,0 +1,458 @@
+// Package filerepo implements durable repository.ShortenerRepo in files.
+//
+// Every change is appended to log segment and fsync'ed before it's visible.
+// Snapshot of all links is written periodically, then log segments
+// included in it are removed. On start snapshot is loaded and newer
+// segments are replayed, torn tail of the last segment is truncated.
+package filerepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/amanakin/shortener/internal/snapfile"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultDir              = "data"
+	defaultSnapshotInterval = 10 * time.Minute
+
+	snapshotName = "snapshot"
+	segmentGlob  = "wal-*.log"
+	segmentName  = "wal-%010d.log"
+)
+
+type Config struct {
+	// Dir keeps snapshot and log segments.
+	Dir string `yaml:"dir"`
+	// SnapshotInterval is period of snapshots, log is replayed on start only since the last one.
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Dir:              defaultDir,
+		SnapshotInterval: defaultSnapshotInterval,
+	}
+}
+
+type Repo struct {
+	config Config
+
+	mu        sync.RWMutex
+	redirects map[string]string
+	originals map[string]string
+	nextID    uint64
+	// wal is current log segment, its number is segment.
+	wal     *os.File
+	segment uint64
+	// walSize is size of acknowledged records in wal.
+	walSize int64
+	closed  bool
+
+	snapshotMu sync.Mutex
+}
+
+// New recovers repository from config.Dir, it is created if it doesn't exist.
+func New(config Config) (*Repo, error) {
+	if config.SnapshotInterval <= 0 {
+		return nil, errors.New("snapshot interval must be positive")
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
+	}
+
+	r := &Repo{
+		config:    config,
+		redirects: make(map[string]string),
+		originals: make(map[string]string),
+	}
+
+	firstSegment, err := r.loadSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot: %w", err)
+	}
+
+	lastSegment, err := r.replay(firstSegment)
+	if err != nil {
+		return nil, fmt.Errorf("replay log: %w", err)
+	}
+
+	// New segment is started, so torn tail of previous one is never appended to.
+	segment := firstSegment
+	if lastSegment >= segment {
+		segment = lastSegment + 1
+	}
+	if r.wal, err = r.createSegment(segment); err != nil {
+		return nil, err
+	}
+	r.segment = segment
+
+	return r, nil
+}
+
+func (r *Repo) path(name string) string {
+	return filepath.Join(r.config.Dir, name)
+}
+
+func (r *Repo) segmentPath(segment uint64) string {
+	return r.path(fmt.Sprintf(segmentName, segment))
+}
+
+// loadSnapshot loads links and returns first log segment not included in snapshot.
+func (r *Repo) loadSnapshot() (uint64, error) {
+	data, err := os.ReadFile(r.path(snapshotName))
+	if errors.Is(err, os.ErrNotExist) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var firstSegment uint64
+	meta := true
+	// Snapshot is renamed into place after fsync, so it's never torn.
+	_, err = readRecords(bytes.NewReader(data), func(payload []byte) error {
+		if meta {
+			meta = false
+			if len(payload) == 0 || payload[0] != opMeta {
+				return errors.New("snapshot doesn't start with meta record")
+			}
+			d := decoder{b: payload[1:]}
+			firstSegment, r.nextID = d.uint(), d.uint()
+			return d.err
+		}
+		return r.apply(payload)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if meta {
+		return 0, errors.New("snapshot is empty")
+	}
+	return firstSegment, nil
+}
+
+// segments returns sorted numbers of log segments.
+func (r *Repo) segments() ([]uint64, error) {
+	paths, err := filepath.Glob(r.path(segmentGlob))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]uint64, 0, len(paths))
+	for _, path := range paths {
+		var segment uint64
+		if _, err = fmt.Sscanf(filepath.Base(path), segmentName, &segment); err != nil {
+			return nil, fmt.Errorf("parse segment name %q: %w", path, err)
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// replay applies log segments starting with firstSegment and returns number of the last one.
+// Older segments are already in snapshot, they are removed.
+func (r *Repo) replay(firstSegment uint64) (uint64, error) {
+	segments, err := r.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	var last uint64
+	for i, segment := range segments {
+		path := r.segmentPath(segment)
+		if segment < firstSegment {
+			if err = os.Remove(path); err != nil {
+				return 0, fmt.Errorf("remove segment in snapshot: %w", err)
+			}
+			continue
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		valid, err := readRecords(file, r.apply)
+		file.Close()
+
+		switch {
+		case errors.Is(err, errTorn) && i == len(segments)-1:
+			// Crash in the middle of append leaves torn record, it was never acknowledged.
+			slog.Warn("truncating torn tail of log",
+				slog.String("segment", path), slog.Int64("valid_bytes", valid))
+			if err = os.Truncate(path, valid); err != nil {
+				return 0, fmt.Errorf("truncate torn tail: %w", err)
+			}
+		case err != nil:
+			return 0, fmt.Errorf("segment %s: %w", path, err)
+		}
+		last = segment
+	}
+	return last, nil
+}
+
+// apply applies record to state.
+func (r *Repo) apply(payload []byte) error {
+	if len(payload) == 0 {
+		return errMalformed
+	}
+
+	d := decoder{b: payload[1:]}
+	switch payload[0] {
+	case opStore:
+		original, shortened := d.string(), d.string()
+		if d.err == nil {
+			r.redirects[shortened] = original
+			r.originals[original] = shortened
+		}
+	case opAllocate:
+		if nextID := d.uint(); d.err == nil && nextID > r.nextID {
+			r.nextID = nextID
+		}
+	default:
+		return fmt.Errorf("%w: unknown operation %d", errMalformed, payload[0])
+	}
+	return d.err
+}
+
+func (r *Repo) createSegment(segment uint64) (*os.File, error) {
+	file, err := os.OpenFile(r.segmentPath(segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create segment: %w", err)
+	}
+	if err = r.syncDir(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// syncDir makes created, renamed and removed files durable.
+func (r *Repo) syncDir() error {
+	return snapfile.SyncDir(r.config.Dir)
+}
+
+// append writes record to log and waits for fsync, r.mu must be locked.
+func (r *Repo) append(payload []byte) error {
+	if r.closed {
+		return errors.New("repository is closed")
+	}
+	record := encodeRecord(payload)
+	_, err := r.wal.Write(record)
+	if err == nil {
+		err = r.wal.Sync()
+	}
+	if err != nil {
+		// Partial record must not stay in the middle of log.
+		if truncErr := r.wal.Truncate(r.walSize); truncErr != nil {
+			slog.Error("truncate failed append", slog.String("error", truncErr.Error()))
+		}
+		return fmt.Errorf("append to log: %w", err)
+	}
+	r.walSize += int64(len(record))
+	return nil
+}
+
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return link, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if shortened, ok := r.originals[link.OriginalURL]; ok {
+		return domain.Link{
+			OriginalURL:  link.OriginalURL,
+			ShortenedURL: shortened,
+		}, nil
+	}
+
+	if _, ok := r.redirects[link.ShortenedURL]; ok {
+		return domain.Link{}, service.ErrExist
+	}
+
+	payload := appendString([]byte{opStore}, link.OriginalURL)
+	payload = appendString(payload, link.ShortenedURL)
+	// Larger record would be taken for corrupt one on restart.
+	if len(payload) > maxRecordSize {
+		return domain.Link{}, fmt.Errorf("%w: link takes %d bytes, file storage keeps up to %d",
+			service.ErrURLTooLong, len(payload), maxRecordSize)
+	}
+	if err := r.append(payload); err != nil {
+		return domain.Link{}, err
+	}
+
+	r.redirects[link.ShortenedURL] = link.OriginalURL
+	r.originals[link.OriginalURL] = link.ShortenedURL
+
+	return link, nil
+}
+
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if original, ok := r.redirects[shortened]; ok {
+		return original, nil
+	}
+
+	return "", service.ErrNotFound
+}
+
+// AllocateRange leases IDs from counter kept in log, so they are never reused after restart.
+func (r *Repo) AllocateRange(_ context.Context, size uint64) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := r.nextID
+	if err := r.append(appendUint([]byte{opAllocate}, start+size)); err != nil {
+		return 0, err
+	}
+	r.nextID = start + size
+	return start, nil
+}
+
+func (r *Repo) CountLinks(_ context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.redirects), nil
+}
+
+// ScanShortened calls fn for all shortened URLs, fn must not call repository.
+func (r *Repo) ScanShortened(_ context.Context, fn func(shortened string) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for shortened := range r.redirects {
+		if err := fn(shortened); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run takes snapshots periodically until ctx is done.
+func (r *Repo) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Snapshot(); err != nil {
+				slog.Error("file repository snapshot", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Snapshot writes all links to snapshot and removes log segments included in it.
+// Stores wait only while log is switched to new segment and links are copied.
+func (r *Repo) Snapshot() error {
+	r.snapshotMu.Lock()
+	defer r.snapshotMu.Unlock()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return errors.New("repository is closed")
+	}
+	wal, err := r.createSegment(r.segment + 1)
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	prev := r.wal
+	r.wal = wal
+	r.walSize = 0
+	r.segment++
+	segment, nextID := r.segment, r.nextID
+	redirects := make(map[string]string, len(r.redirects))
+	for shortened, original := range r.redirects {
+		redirects[shortened] = original
+	}
+	r.mu.Unlock()
+
+	if err = prev.Close(); err != nil {
+		return fmt.Errorf("close segment: %w", err)
+	}
+
+	if err = r.writeSnapshot(segment, nextID, redirects); err != nil {
+		return err
+	}
+
+	segments, err := r.segments()
+	if err != nil {
+		return err
+	}
+	for _, old := range segments {
+		if old >= segment {
+			break
+		}
+		if err = os.Remove(r.segmentPath(old)); err != nil {
+			return fmt.Errorf("remove segment in snapshot: %w", err)
+		}
+	}
+	return r.syncDir()
+}
+
+func (r *Repo) writeSnapshot(segment, nextID uint64, redirects map[string]string) error {
+	return snapfile.Write(r.path(snapshotName), func(w io.Writer) error {
+		var buf bytes.Buffer
+		meta := appendUint([]byte{opMeta}, segment)
+		buf.Write(encodeRecord(appendUint(meta, nextID)))
+		for shortened, original := range redirects {
+			payload := appendString([]byte{opStore}, original)
+			buf.Write(encodeRecord(appendString(payload, shortened)))
+
+			if buf.Len() >= 1<<20 {
+				if _, err := buf.WriteTo(w); err != nil {
+					return fmt.Errorf("write snapshot: %w", err)
+				}
+			}
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return fmt.Errorf("write snapshot: %w", err)
+		}
+		return nil
+	})
+}
+
+// Close takes snapshot, so next start doesn't replay log, and closes log.
+func (r *Repo) Close(_ context.Context) {
+	if err := r.Snapshot(); err != nil {
+		slog.Error("file repository snapshot", slog.String("error", err.Error()))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+	r.closed = true
+	if err := r.wal.Close(); err != nil {
+		slog.Error("close log", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,250 @@
+package filerepo
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/repotest"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func newRepo(t *testing.T, dir string) *Repo {
+	t.Helper()
+
+	repo, err := New(Config{Dir: dir, SnapshotInterval: time.Hour})
+	require.NoError(t, err)
+	return repo
+}
+
+func storeLinks(t *testing.T, repo *Repo, from, to int) {
+	t.Helper()
+
+	for i := from; i < to; i++ {
+		_, err := repo.Store(context.Background(), domain.Link{
+			OriginalURL:  "https://example.com/" + strconv.Itoa(i),
+			ShortenedURL: strconv.Itoa(i),
+		})
+		require.NoError(t, err)
+	}
+}
+
+func requireLinks(t *testing.T, repo *Repo, from, to int) {
+	t.Helper()
+
+	count, err := repo.CountLinks(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, to-from, count)
+	for i := from; i < to; i++ {
+		original, err := repo.Get(context.Background(), strconv.Itoa(i))
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/"+strconv.Itoa(i), original)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.ShortenerRepo {
+		return newRepo(t, t.TempDir())
+	})
+}
+
+func TestFileRepo(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t, t.TempDir())
+	defer repo.Close(ctx)
+
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	stored, err := repo.Store(ctx, link)
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+
+	stored, err = repo.Store(ctx, domain.Link{OriginalURL: link.OriginalURL, ShortenedURL: "def"})
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: link.ShortenedURL})
+	require.ErrorIs(t, err, service.ErrExist)
+
+	_, err = repo.Get(ctx, "def")
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestTooLargeRecord(t *testing.T) {
+	dir := t.TempDir()
+	repo := newRepo(t, dir)
+	storeLinks(t, repo, 0, 10)
+
+	_, err := repo.Store(context.Background(), domain.Link{
+		OriginalURL:  "https://example.com/" + strings.Repeat("a", maxRecordSize),
+		ShortenedURL: "large",
+	})
+	require.ErrorIs(t, err, service.ErrURLTooLong)
+	storeLinks(t, repo, 10, 20)
+	repo.wal.Close()
+
+	repo = newRepo(t, dir)
+	defer repo.Close(context.Background())
+	requireLinks(t, repo, 0, 20)
+}
+
+func TestRecoverFromLog(t *testing.T) {
+	dir := t.TempDir()
+	repo := newRepo(t, dir)
+	storeLinks(t, repo, 0, 100)
+	first, err := repo.AllocateRange(context.Background(), 10)
+	require.NoError(t, err)
+	// Crash: log is not closed and there is no snapshot.
+	repo.wal.Close()
+
+	repo = newRepo(t, dir)
+	defer repo.Close(context.Background())
+	requireLinks(t, repo, 0, 100)
+
+	second, err := repo.AllocateRange(context.Background(), 10)
+	require.NoError(t, err)
+	require.Equal(t, first+10, second)
+}
+
+func TestRecoverFromSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	repo := newRepo(t, dir)
+	storeLinks(t, repo, 0, 50)
+	require.NoError(t, repo.Snapshot())
+	storeLinks(t, repo, 50, 100)
+	repo.wal.Close()
+
+	// Only segment started by snapshot is left.
+	segments, err := repo.segments()
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+
+	repo = newRepo(t, dir)
+	requireLinks(t, repo, 0, 100)
+	repo.Close(context.Background())
+
+	// Close takes snapshot, so log is empty on the next start.
+	repo = newRepo(t, dir)
+	defer repo.Close(context.Background())
+	requireLinks(t, repo, 0, 100)
+}
+
+func TestTornTail(t *testing.T) {
+	cases := []struct {
+		name    string
+		corrupt func(t *testing.T, path string)
+	}{
+		{
+			name: "partial record",
+			corrupt: func(t *testing.T, path string) {
+				info, err := os.Stat(path)
+				require.NoError(t, err)
+				require.NoError(t, os.Truncate(path, info.Size()-3))
+			},
+		},
+		{
+			name: "damaged record",
+			corrupt: func(t *testing.T, path string) {
+				file, err := os.OpenFile(path, os.O_RDWR, 0)
+				require.NoError(t, err)
+				defer file.Close()
+
+				info, err := file.Stat()
+				require.NoError(t, err)
+				_, err = file.WriteAt([]byte{0xff}, info.Size()-1)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "garbage after records",
+			corrupt: func(t *testing.T, path string) {
+				file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+				require.NoError(t, err)
+				defer file.Close()
+
+				_, err = file.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9})
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			repo := newRepo(t, dir)
+			storeLinks(t, repo, 0, 11)
+			repo.wal.Close()
+			tCase.corrupt(t, repo.segmentPath(repo.segment))
+
+			// The last link is lost only if its record is damaged.
+			repo = newRepo(t, dir)
+			count, err := repo.CountLinks(context.Background())
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, count, 10)
+			requireLinks(t, repo, 0, count)
+
+			// Links stored after recovery survive next restart.
+			storeLinks(t, repo, 100, 101)
+			repo.wal.Close()
+			repo = newRepo(t, dir)
+			defer repo.Close(context.Background())
+			_, err = repo.Get(context.Background(), "100")
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestCorruptLog(t *testing.T) {
+	cases := []struct {
+		name    string
+		corrupt func(t *testing.T, path string)
+	}{
+		{
+			name: "damaged record followed by records",
+			corrupt: func(t *testing.T, path string) {
+				file, err := os.OpenFile(path, os.O_RDWR, 0)
+				require.NoError(t, err)
+				defer file.Close()
+
+				_, err = file.WriteAt([]byte{0xff}, recordHeaderSize)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown operation",
+			corrupt: func(t *testing.T, path string) {
+				file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+				require.NoError(t, err)
+				defer file.Close()
+
+				_, err = file.Write(encodeRecord([]byte{0xff, 1, 2}))
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			repo := newRepo(t, dir)
+			storeLinks(t, repo, 0, 11)
+			repo.wal.Close()
+			path := repo.segmentPath(repo.segment)
+			tCase.corrupt(t, path)
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+
+			// Acknowledged links are never cut off, start fails instead.
+			_, err = New(Config{Dir: dir, SnapshotInterval: time.Hour})
+			require.Error(t, err)
+			after, err := os.Stat(path)
+			require.NoError(t, err)
+			require.Equal(t, info.Size(), after.Size())
+		})
+	}
+}
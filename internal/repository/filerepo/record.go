@@ -0,0 +1,139 @@
+package filerepo
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Record is length and CRC-32C of payload followed by payload:
+//
+//	| length uint32 LE | crc uint32 LE | payload |
+//
+// Payload is operation byte followed by uvarint numbers and
+// uvarint-length-prefixed strings.
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 1 << 20
+)
+
+// Operations of records.
+const (
+	// opMeta starts snapshot: first log segment not included, next ID.
+	opMeta byte = iota + 1
+	// opStore is stored link: original, shortened.
+	opStore
+	// opAllocate is next ID after allocated range.
+	opAllocate
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// errTorn means damage runs to the end of data, as after crash in the middle of append.
+	errTorn = errors.New("torn record")
+	// errCorrupt means damaged record is followed by other data.
+	errCorrupt = errors.New("corrupt record")
+	// errMalformed means record is intact, but its payload can't be decoded.
+	errMalformed = errors.New("malformed record")
+)
+
+func encodeRecord(payload []byte) []byte {
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+	return buf
+}
+
+// readRecords calls fn for every record of r. It returns size of valid records,
+// and errTorn or errCorrupt if they are followed by torn or damaged data.
+func readRecords(r io.Reader, fn func(payload []byte) error) (int64, error) {
+	var (
+		valid  int64
+		header [recordHeaderSize]byte
+	)
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err == io.EOF {
+			return valid, nil
+		}
+		if err != nil {
+			return valid, errTorn
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:])
+		if size > maxRecordSize {
+			// Damaged length, data after it is torn record only if it's shorter.
+			if n, _ := io.CopyN(io.Discard, r, int64(size)); n < int64(size) {
+				return valid, errTorn
+			}
+			return valid, errCorrupt
+		}
+		payload := make([]byte, size)
+		if _, err = io.ReadFull(r, payload); err != nil {
+			return valid, errTorn
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+			if atEOF(r) {
+				return valid, errTorn
+			}
+			return valid, errCorrupt
+		}
+
+		if err = fn(payload); err != nil {
+			return valid, err
+		}
+		valid += recordHeaderSize + int64(size)
+	}
+}
+
+// atEOF reports whether r has no more data.
+func atEOF(r io.Reader) bool {
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return err == io.EOF
+}
+
+func appendUint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads payload fields, first error is kept in err.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errMalformed
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	size := d.uint()
+	if d.err != nil {
+		return ""
+	}
+	if size > uint64(len(d.b)) {
+		d.err = errMalformed
+		return ""
+	}
+	s := string(d.b[:size])
+	d.b = d.b[size:]
+	return s
+}
@@ -2,55 +2,315 @@ package maprepo
 
 import (
 	"context"
+	"hash/maphash"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/amanakin/shortener/internal/domain"
 	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/exp/slog"
 )
 
+// DefaultShards is number of shards of New repository.
+const DefaultShards = 64
+
+// Repo keeps links in shards, so operations on different links don't block each other.
+// Redirects are sharded by shortened URL, reverse index is sharded by original URL.
+// Store locks shard of original and then shard of shortened, this order keeps
+// "check original, then shortened" atomic and prevents deadlocks.
 type Repo struct {
+	seed      maphash.Seed
+	redirects []redirectShard
+	originals []originalShard
+
+	// pool is queue of pre-generated paths, pooled is set of its items.
+	pool   []string
+	pooled map[string]struct{}
+	poolMu sync.Mutex
+
+	nextID atomic.Uint64
+
+	config     Config
+	snapshotMu sync.Mutex
+}
+
+type redirectShard struct {
+	mu        sync.RWMutex
 	redirects map[string]string
+	clicks    map[string]uint64
+	// hosts are Unicode forms of IDN hosts by shortened URL.
+	hosts map[string]string
+	// Padding keeps shards in different cache lines.
+	_ [16]byte
+}
+
+type originalShard struct {
+	mu        sync.Mutex
 	originals map[string]string
-	mu        sync.RWMutex
+	_         [48]byte
 }
 
 func New() *Repo {
-	return &Repo{
-		redirects: make(map[string]string),
-		originals: make(map[string]string),
+	return NewSharded(DefaultShards)
+}
+
+// NewSharded creates repository with shards number of shards.
+func NewSharded(shards int) *Repo {
+	if shards < 1 {
+		shards = 1
+	}
+
+	r := &Repo{
+		seed:      maphash.MakeSeed(),
+		redirects: make([]redirectShard, shards),
+		originals: make([]originalShard, shards),
+		pooled:    make(map[string]struct{}),
+	}
+	for i := range r.redirects {
+		r.redirects[i].redirects = make(map[string]string)
+		r.redirects[i].clicks = make(map[string]uint64)
+		r.redirects[i].hosts = make(map[string]string)
+		r.originals[i].originals = make(map[string]string)
 	}
+	return r
+}
+
+func (r *Repo) shard(key string) uint64 {
+	return maphash.String(r.seed, key) % uint64(len(r.redirects))
+}
+
+func (r *Repo) redirectShard(shortened string) *redirectShard {
+	return &r.redirects[r.shard(shortened)]
+}
+
+func (r *Repo) originalShard(original string) *originalShard {
+	return &r.originals[r.shard(original)]
 }
 
-func (r *Repo) Store(_ context.Context, link domain.Link) (domain.Link, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return link, err
+	}
+
+	originals := r.originalShard(link.OriginalURL)
+	originals.mu.Lock()
+	defer originals.mu.Unlock()
 
-	if shortened, ok := r.originals[link.OriginalURL]; ok {
+	if shortened, ok := originals.originals[link.OriginalURL]; ok {
 		return domain.Link{
 			OriginalURL:  link.OriginalURL,
 			ShortenedURL: shortened,
 		}, nil
 	}
 
-	if _, ok := r.redirects[link.ShortenedURL]; ok {
+	redirects := r.redirectShard(link.ShortenedURL)
+	redirects.mu.Lock()
+	defer redirects.mu.Unlock()
+
+	if _, ok := redirects.redirects[link.ShortenedURL]; ok {
 		return domain.Link{}, service.ErrExist
 	}
 
-	r.redirects[link.ShortenedURL] = link.OriginalURL
-	r.originals[link.OriginalURL] = link.ShortenedURL
+	redirects.redirects[link.ShortenedURL] = link.OriginalURL
+	originals.originals[link.OriginalURL] = link.ShortenedURL
 
 	return link, nil
 }
 
-func (r *Repo) Get(_ context.Context, shortened string) (string, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	redirects := r.redirectShard(shortened)
+	redirects.mu.RLock()
+	defer redirects.mu.RUnlock()
 
-	if original, ok := r.redirects[shortened]; ok {
+	if original, ok := redirects.redirects[shortened]; ok {
 		return original, nil
 	}
 
 	return "", service.ErrNotFound
 }
 
-func (r *Repo) Close(_ context.Context) {}
+func (r *Repo) StoreUnicodeHost(_ context.Context, shortened, host string) error {
+	redirects := r.redirectShard(shortened)
+	redirects.mu.Lock()
+	defer redirects.mu.Unlock()
+
+	if _, ok := redirects.redirects[shortened]; !ok {
+		return service.ErrNotFound
+	}
+	redirects.hosts[shortened] = host
+	return nil
+}
+
+func (r *Repo) UnicodeHost(_ context.Context, shortened string) (string, error) {
+	redirects := r.redirectShard(shortened)
+	redirects.mu.RLock()
+	defer redirects.mu.RUnlock()
+
+	if host, ok := redirects.hosts[shortened]; ok {
+		return host, nil
+	}
+	return "", service.ErrNotFound
+}
+
+func (r *Repo) exists(shortened string) bool {
+	redirects := r.redirectShard(shortened)
+	redirects.mu.RLock()
+	defer redirects.mu.RUnlock()
+
+	_, ok := redirects.redirects[shortened]
+	return ok
+}
+
+// AllocateRange leases IDs from in-process counter.
+func (r *Repo) AllocateRange(_ context.Context, size uint64) (uint64, error) {
+	return r.nextID.Add(size) - size, nil
+}
+
+func (r *Repo) FillPool(_ context.Context, paths []string) (int, error) {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+
+	added := 0
+	for _, path := range paths {
+		if r.exists(path) {
+			continue
+		}
+		if _, ok := r.pooled[path]; ok {
+			continue
+		}
+		r.pooled[path] = struct{}{}
+		r.pool = append(r.pool, path)
+		added++
+	}
+	return added, nil
+}
+
+func (r *Repo) ClaimSlug(_ context.Context) (string, error) {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+
+	if len(r.pool) == 0 {
+		return "", service.ErrPoolEmpty
+	}
+
+	path := r.pool[0]
+	r.pool[0] = ""
+	r.pool = r.pool[1:]
+	delete(r.pooled, path)
+	return path, nil
+}
+
+func (r *Repo) PoolSize(_ context.Context) (int, error) {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+
+	return len(r.pool), nil
+}
+
+// AddClicks adds numbers of resolves to click counters of shortened URLs.
+func (r *Repo) AddClicks(_ context.Context, clicks map[string]uint64) error {
+	for shortened, count := range clicks {
+		redirects := r.redirectShard(shortened)
+		redirects.mu.Lock()
+		if _, ok := redirects.redirects[shortened]; ok {
+			redirects.clicks[shortened] += count
+		}
+		redirects.mu.Unlock()
+	}
+	return nil
+}
+
+// MostClicked returns up to limit links with most clicks.
+func (r *Repo) MostClicked(_ context.Context, limit int) ([]domain.Link, error) {
+	type clickedLink struct {
+		link   domain.Link
+		clicks uint64
+	}
+
+	var links []clickedLink
+	for i := range r.redirects {
+		redirects := &r.redirects[i]
+		redirects.mu.RLock()
+		for shortened, original := range redirects.redirects {
+			links = append(links, clickedLink{
+				link:   domain.Link{OriginalURL: original, ShortenedURL: shortened},
+				clicks: redirects.clicks[shortened],
+			})
+		}
+		redirects.mu.RUnlock()
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].clicks > links[j].clicks
+	})
+
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	result := make([]domain.Link, len(links))
+	for i, link := range links {
+		result[i] = link.link
+	}
+	return result, nil
+}
+
+func (r *Repo) CountLinks(_ context.Context) (int, error) {
+	count := 0
+	for i := range r.redirects {
+		redirects := &r.redirects[i]
+		redirects.mu.RLock()
+		count += len(redirects.redirects)
+		redirects.mu.RUnlock()
+	}
+	return count, nil
+}
+
+// ScanShortened calls fn for all shortened URLs, fn must not call repository.
+func (r *Repo) ScanShortened(_ context.Context, fn func(shortened string) error) error {
+	for i := range r.redirects {
+		if err := r.redirects[i].scan(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *redirectShard) scan(fn func(shortened string) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for shortened := range s.redirects {
+		if err := fn(shortened); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Links returns all links in no particular order.
+func (r *Repo) Links() []domain.Link {
+	var links []domain.Link
+	for i := range r.redirects {
+		redirects := &r.redirects[i]
+		redirects.mu.RLock()
+		for shortened, original := range redirects.redirects {
+			links = append(links, domain.Link{OriginalURL: original, ShortenedURL: shortened})
+		}
+		redirects.mu.RUnlock()
+	}
+	return links
+}
+
+// Close takes snapshot if it's configured.
+func (r *Repo) Close(_ context.Context) {
+	if r.config.Snapshot == "" {
+		return
+	}
+	if err := r.Snapshot(); err != nil {
+		slog.Error("memory repository snapshot", slog.String("error", err.Error()))
+	}
+}
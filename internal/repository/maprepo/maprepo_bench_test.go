@@ -0,0 +1,145 @@
+package maprepo
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service"
+)
+
+// mutexRepo is previous implementation guarded by one mutex, it's kept for comparison.
+type mutexRepo struct {
+	redirects map[string]string
+	originals map[string]string
+	mu        sync.RWMutex
+}
+
+func newMutexRepo() *mutexRepo {
+	return &mutexRepo{
+		redirects: make(map[string]string),
+		originals: make(map[string]string),
+	}
+}
+
+func (r *mutexRepo) Store(_ context.Context, link domain.Link) (domain.Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if shortened, ok := r.originals[link.OriginalURL]; ok {
+		return domain.Link{OriginalURL: link.OriginalURL, ShortenedURL: shortened}, nil
+	}
+	if _, ok := r.redirects[link.ShortenedURL]; ok {
+		return domain.Link{}, service.ErrExist
+	}
+
+	r.redirects[link.ShortenedURL] = link.OriginalURL
+	r.originals[link.OriginalURL] = link.ShortenedURL
+	return link, nil
+}
+
+func (r *mutexRepo) Get(_ context.Context, shortened string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if original, ok := r.redirects[shortened]; ok {
+		return original, nil
+	}
+	return "", service.ErrNotFound
+}
+
+func (r *mutexRepo) Close(_ context.Context) {}
+
+const benchLinks = 100000
+
+var benchRepos = []struct {
+	name string
+	new  func() repository.ShortenerRepo
+}{
+	{name: "mutex", new: func() repository.ShortenerRepo { return newMutexRepo() }},
+	{name: "sharded", new: func() repository.ShortenerRepo { return New() }},
+}
+
+func benchKeys() ([]string, []string) {
+	shortened := make([]string, benchLinks)
+	originals := make([]string, benchLinks)
+	for i := range shortened {
+		shortened[i] = "s" + strconv.Itoa(i)
+		originals[i] = "https://example.com/" + strconv.Itoa(i)
+	}
+	return shortened, originals
+}
+
+func fill(b *testing.B, repo repository.ShortenerRepo, shortened, originals []string) {
+	for i := range shortened {
+		_, err := repo.Store(context.Background(), domain.Link{OriginalURL: originals[i], ShortenedURL: shortened[i]})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGet measures resolve throughput, run with -cpu 1,2,4,8 to see scaling.
+func BenchmarkGet(b *testing.B) {
+	shortened, originals := benchKeys()
+
+	for _, bench := range benchRepos {
+		b.Run(bench.name, func(b *testing.B) {
+			repo := bench.new()
+			fill(b, repo, shortened, originals)
+			var next atomic.Uint64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := next.Add(benchLinks / 7)
+				for pb.Next() {
+					i++
+					if _, err := repo.Get(context.Background(), shortened[i%benchLinks]); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMixed measures resolves with every 10th operation storing new link.
+func BenchmarkMixed(b *testing.B) {
+	shortened, originals := benchKeys()
+
+	for _, bench := range benchRepos {
+		b.Run(bench.name, func(b *testing.B) {
+			repo := bench.new()
+			fill(b, repo, shortened, originals)
+			var next, stored atomic.Uint64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := next.Add(benchLinks / 7)
+				for pb.Next() {
+					i++
+					if i%10 == 0 {
+						n := strconv.FormatUint(stored.Add(1), 10)
+						link := domain.Link{OriginalURL: "https://example.org/" + n, ShortenedURL: "n" + n}
+						if _, err := repo.Store(context.Background(), link); err != nil {
+							b.Error(err)
+							return
+						}
+						continue
+					}
+					if _, err := repo.Get(context.Background(), shortened[i%benchLinks]); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
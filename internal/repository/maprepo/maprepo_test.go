@@ -5,73 +5,89 @@ import (
 	"testing"
 
 	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/repotest"
 	"github.com/amanakin/shortener/internal/service"
 	"github.com/stretchr/testify/require"
 )
 
+func TestConformance(t *testing.T) {
+	t.Run("single shard", func(t *testing.T) {
+		repotest.Run(t, func(*testing.T) repository.ShortenerRepo { return NewSharded(1) })
+	})
+	t.Run("sharded", func(t *testing.T) {
+		repotest.Run(t, func(*testing.T) repository.ShortenerRepo { return New() })
+	})
+}
+
 func TestMapRepo(t *testing.T) {
-	t.Run("return link if it's not in repo", func(t *testing.T) {
+	t.Run("allocated ranges don't overlap", func(t *testing.T) {
 		repo := New()
 
-		link := domain.Link{
-			OriginalURL:  "https://google.com",
-			ShortenedURL: "123",
-		}
-
-		storedLink, err := repo.Store(context.Background(), link)
+		first, err := repo.AllocateRange(context.Background(), 10)
+		require.NoError(t, err)
+		second, err := repo.AllocateRange(context.Background(), 5)
 		require.NoError(t, err)
-		require.Equal(t, link, storedLink)
+
+		require.Equal(t, uint64(0), first)
+		require.Equal(t, uint64(10), second)
 	})
 
-	t.Run("return stored link if original URL in repo", func(t *testing.T) {
+	t.Run("slug pool skips used and pooled paths", func(t *testing.T) {
 		repo := New()
 
-		link := domain.Link{
+		_, err := repo.Store(context.Background(), domain.Link{
 			OriginalURL:  "https://google.com",
-			ShortenedURL: "123",
-		}
-
-		storedLink, err := repo.Store(context.Background(), link)
+			ShortenedURL: "used",
+		})
 		require.NoError(t, err)
-		require.Equal(t, link, storedLink)
 
-		link.ShortenedURL = "456"
-		newStoredLink, err := repo.Store(context.Background(), link)
+		added, err := repo.FillPool(context.Background(), []string{"used", "a", "b", "a"})
 		require.NoError(t, err)
-		require.Equal(t, storedLink, newStoredLink)
-	})
+		require.Equal(t, 2, added)
 
-	t.Run("return ErrExist if shortened URL in repo", func(t *testing.T) {
-		repo := New()
+		size, err := repo.PoolSize(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, size)
 
-		link := domain.Link{
-			OriginalURL:  "https://google.com",
-			ShortenedURL: "123",
+		for _, expected := range []string{"a", "b"} {
+			path, err := repo.ClaimSlug(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, expected, path)
 		}
 
-		storedLink, err := repo.Store(context.Background(), link)
-		require.NoError(t, err)
-		require.Equal(t, link, storedLink)
-
-		link.OriginalURL = "some.other.url"
-		_, err = repo.Store(context.Background(), link)
-		require.ErrorIs(t, err, service.ErrExist)
+		_, err = repo.ClaimSlug(context.Background())
+		require.ErrorIs(t, err, service.ErrPoolEmpty)
 	})
+	t.Run("all links are listed", func(t *testing.T) {
+		repo := NewSharded(4)
+		var links []domain.Link
+		for _, shortened := range []string{"d", "b", "e", "a", "c"} {
+			link := domain.Link{OriginalURL: "https://google.com/" + shortened, ShortenedURL: shortened}
+			_, err := repo.Store(context.Background(), link)
+			require.NoError(t, err)
+			links = append(links, link)
+		}
 
-	t.Run("resolve returns what was stored", func(t *testing.T) {
+		require.ElementsMatch(t, links, repo.Links())
+	})
+	t.Run("unicode host is kept for stored link", func(t *testing.T) {
 		repo := New()
 
-		link := domain.Link{
-			OriginalURL:  "https://google.com",
-			ShortenedURL: "123",
-		}
+		err := repo.StoreUnicodeHost(context.Background(), "abc", "пример.рф")
+		require.ErrorIs(t, err, service.ErrNotFound)
 
-		storedLink, err := repo.Store(context.Background(), link)
+		_, err = repo.Store(context.Background(), domain.Link{
+			OriginalURL:  "https://xn--e1afmkfd.xn--p1ai",
+			ShortenedURL: "abc",
+		})
 		require.NoError(t, err)
-		require.Equal(t, link, storedLink)
+		_, err = repo.UnicodeHost(context.Background(), "abc")
+		require.ErrorIs(t, err, service.ErrNotFound)
 
-		original, err := repo.Get(context.Background(), "123")
+		require.NoError(t, repo.StoreUnicodeHost(context.Background(), "abc", "пример.рф"))
+		host, err := repo.UnicodeHost(context.Background(), "abc")
 		require.NoError(t, err)
-		require.Equal(t, "https://google.com", original)
+		require.Equal(t, "пример.рф", host)
 	})
 }
@@ -0,0 +1,159 @@
+package maprepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/snapfile"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultSnapshotInterval = 5 * time.Minute
+
+	snapshotVersion = 1
+)
+
+type Config struct {
+	// Snapshot is path of snapshot file, empty disables snapshots.
+	Snapshot string `yaml:"snapshot"`
+	// SnapshotInterval is period of snapshots, zero takes them only on shutdown.
+	SnapshotInterval time.Duration `yaml:"snapshot_interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SnapshotInterval: defaultSnapshotInterval,
+	}
+}
+
+// snapshot is gob encoded in gzip stream, slug pool is not kept.
+// Snapshots without Hosts are read as having none.
+type snapshot struct {
+	Version int
+	Links   []domain.Link
+	Clicks  map[string]uint64
+	Hosts   map[string]string
+	NextID  uint64
+}
+
+// Open creates repository and loads config.Snapshot if it exists.
+func Open(config Config) (*Repo, error) {
+	r := New()
+	r.config = config
+	if config.Snapshot == "" {
+		return r, nil
+	}
+
+	file, err := os.Open(config.Snapshot)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	if err = r.ReadSnapshot(file); err != nil {
+		return nil, fmt.Errorf("read snapshot %s: %w", config.Snapshot, err)
+	}
+	return r, nil
+}
+
+// WriteSnapshot writes links, click counters, Unicode hosts and ID counter to w.
+// Shards are copied one by one, so links stored meanwhile may be missed.
+func (r *Repo) WriteSnapshot(w io.Writer) error {
+	snap := snapshot{
+		Version: snapshotVersion,
+		Clicks:  make(map[string]uint64),
+		Hosts:   make(map[string]string),
+		NextID:  r.nextID.Load(),
+	}
+	for i := range r.redirects {
+		redirects := &r.redirects[i]
+		redirects.mu.RLock()
+		for shortened, original := range redirects.redirects {
+			snap.Links = append(snap.Links, domain.Link{OriginalURL: original, ShortenedURL: shortened})
+		}
+		for shortened, clicks := range redirects.clicks {
+			snap.Clicks[shortened] = clicks
+		}
+		for shortened, host := range redirects.hosts {
+			snap.Hosts[shortened] = host
+		}
+		redirects.mu.RUnlock()
+	}
+
+	return snapfile.Encode(w, snap)
+}
+
+// ReadSnapshot adds links, click counters, Unicode hosts and ID counter from snapshot.
+func (r *Repo) ReadSnapshot(rd io.Reader) error {
+	var snap snapshot
+	err := snapfile.Decode(rd, &snap)
+	if err != nil {
+		return err
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unknown snapshot version %d", snap.Version)
+	}
+
+	for _, link := range snap.Links {
+		if _, err = r.Store(context.Background(), link); err != nil {
+			return fmt.Errorf("store %s: %w", link.ShortenedURL, err)
+		}
+	}
+	if err = r.AddClicks(context.Background(), snap.Clicks); err != nil {
+		return err
+	}
+	for shortened, host := range snap.Hosts {
+		if err = r.StoreUnicodeHost(context.Background(), shortened, host); err != nil {
+			return fmt.Errorf("unicode host of %s: %w", shortened, err)
+		}
+	}
+	for {
+		nextID := r.nextID.Load()
+		if snap.NextID <= nextID || r.nextID.CompareAndSwap(nextID, snap.NextID) {
+			break
+		}
+	}
+	return nil
+}
+
+// Snapshot writes snapshot to configured file atomically.
+func (r *Repo) Snapshot() error {
+	if r.config.Snapshot == "" {
+		return errors.New("snapshot path is not configured")
+	}
+
+	r.snapshotMu.Lock()
+	defer r.snapshotMu.Unlock()
+
+	return snapfile.Write(r.config.Snapshot, r.WriteSnapshot)
+}
+
+// Run takes snapshots periodically until ctx is done.
+func (r *Repo) Run(ctx context.Context) {
+	if r.config.Snapshot == "" || r.config.SnapshotInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.config.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Snapshot(); err != nil {
+				slog.Error("memory repository snapshot", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
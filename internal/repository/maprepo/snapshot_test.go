@@ -0,0 +1,63 @@
+package maprepo
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	repo := New()
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err := repo.Store(ctx, link)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddClicks(ctx, map[string]uint64{"abc": 3}))
+	require.NoError(t, repo.StoreUnicodeHost(ctx, "abc", "пример.рф"))
+	_, err = repo.AllocateRange(ctx, 10)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, repo.WriteSnapshot(&buf))
+
+	restored := New()
+	require.NoError(t, restored.ReadSnapshot(&buf))
+
+	original, err := restored.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+	require.Equal(t, uint64(3), restored.redirectShard("abc").clicks["abc"])
+	host, err := restored.UnicodeHost(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, "пример.рф", host)
+	start, err := restored.AllocateRange(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), start)
+
+	require.Error(t, restored.ReadSnapshot(bytes.NewReader([]byte("not a snapshot"))))
+}
+
+func TestSnapshotFile(t *testing.T) {
+	ctx := context.Background()
+	config := Config{Snapshot: filepath.Join(t.TempDir(), "links.snapshot")}
+
+	// Missing snapshot means empty repository.
+	repo, err := Open(config)
+	require.NoError(t, err)
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err = repo.Store(ctx, link)
+	require.NoError(t, err)
+	repo.Close(ctx)
+
+	repo, err = Open(config)
+	require.NoError(t, err)
+	original, err := repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+
+	require.Error(t, New().Snapshot())
+}
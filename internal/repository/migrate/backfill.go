@@ -0,0 +1,216 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/exp/slog"
+)
+
+// Scanner is implemented by repositories which links can be copied.
+type Scanner interface {
+	// ScanLinks returns up to limit links with shortened URL greater than after, ordered by shortened URL.
+	ScanLinks(ctx context.Context, after string, limit int) ([]domain.Link, error)
+}
+
+// SortedLinks is Scanner of links which are sorted once, for repositories
+// which can't list links in order of shortened URL (e.g. memory snapshot).
+type SortedLinks struct {
+	links []domain.Link
+	alloc Allocator
+}
+
+// NewSortedLinks sorts links, Copy moves ID counter of target past alloc, if it's not nil.
+func NewSortedLinks(links []domain.Link, alloc Allocator) *SortedLinks {
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortenedURL < links[j].ShortenedURL })
+	return &SortedLinks{links: links, alloc: alloc}
+}
+
+func (l *SortedLinks) ScanLinks(ctx context.Context, after string, limit int) ([]domain.Link, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	start := sort.Search(len(l.links), func(i int) bool { return l.links[i].ShortenedURL > after })
+	end := len(l.links)
+	if limit < end-start {
+		end = start + limit
+	}
+	return l.links[start:end:end], nil
+}
+
+// allocator returns ID counter of from.
+func allocator(from Scanner) (Allocator, bool) {
+	if sorted, ok := from.(*SortedLinks); ok {
+		return sorted.alloc, sorted.alloc != nil
+	}
+	alloc, ok := from.(Allocator)
+	return alloc, ok
+}
+
+// Checkpoint is progress of Copy.
+type Checkpoint struct {
+	After  string `json:"after"`
+	Done   bool   `json:"done"`
+	Copied int64  `json:"copied"`
+	// Conflicts are links which shortened or original URL belongs to other link in target.
+	Conflicts int64 `json:"conflicts"`
+}
+
+// Copy stores links of from in to in batches, continuing from checkpoint, batch is stored by workers
+// concurrently and save is called after it. Existing links are skipped, so Copy may be repeated.
+// ID counter of to is moved past counter of from, if both of them allocate ranges.
+func Copy(ctx context.Context, from Scanner, to repository.ShortenerRepo, batch, workers int,
+	checkpoint *Checkpoint, save func(Checkpoint) error) error {
+	for !checkpoint.Done {
+		links, err := from.ScanLinks(ctx, checkpoint.After, batch)
+		if err != nil {
+			return fmt.Errorf("scan links: %w", err)
+		}
+
+		var mu sync.Mutex
+		var conflicts int64
+		err = forEach(ctx, links, workers, func(link domain.Link) error {
+			stored, err := to.Store(ctx, link)
+			if err != nil && !errors.Is(err, service.ErrExist) {
+				return fmt.Errorf("store %s: %w", link.ShortenedURL, err)
+			}
+			if err != nil || stored != link {
+				slog.Warn("link conflicts with other link in target",
+					slog.String("shortened", link.ShortenedURL), slog.String("target", stored.ShortenedURL))
+				mu.Lock()
+				conflicts++
+				mu.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(links) > 0 {
+			checkpoint.After = links[len(links)-1].ShortenedURL
+			checkpoint.Copied += int64(len(links))
+			checkpoint.Conflicts += conflicts
+		}
+		checkpoint.Done = len(links) < batch
+		if err = save(*checkpoint); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+	}
+
+	fromAlloc, ok := allocator(from)
+	if !ok {
+		return nil
+	}
+	toAlloc, ok := repository.As[Allocator](to)
+	if !ok {
+		return nil
+	}
+	next, err := fromAlloc.AllocateRange(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("next ID: %w", err)
+	}
+	return advance(ctx, toAlloc, next)
+}
+
+// VerifyResult is result of Verify.
+type VerifyResult struct {
+	Checked int64
+	// Missing links are not in target.
+	Missing int64
+	// Mismatched links point to other original URL in target.
+	Mismatched int64
+}
+
+func (r VerifyResult) OK() bool {
+	return r.Missing == 0 && r.Mismatched == 0
+}
+
+// Verify checks that all links of from are in to, batch is checked by workers concurrently.
+func Verify(ctx context.Context, from Scanner, to repository.ShortenerRepo, batch, workers int) (VerifyResult, error) {
+	var mu sync.Mutex
+	var result VerifyResult
+
+	for after := ""; ; {
+		links, err := from.ScanLinks(ctx, after, batch)
+		if err != nil {
+			return result, fmt.Errorf("scan links: %w", err)
+		}
+
+		err = forEach(ctx, links, workers, func(link domain.Link) error {
+			original, err := to.Get(ctx, link.ShortenedURL)
+			if err != nil && !errors.Is(err, service.ErrNotFound) {
+				return fmt.Errorf("get %s: %w", link.ShortenedURL, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Checked++
+			switch {
+			case err != nil:
+				result.Missing++
+			case original != link.OriginalURL:
+				result.Mismatched++
+			}
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+
+		if len(links) < batch {
+			return result, nil
+		}
+		after = links[len(links)-1].ShortenedURL
+	}
+}
+
+// forEach calls fn for links by workers goroutines, it returns the first error.
+func forEach(ctx context.Context, links []domain.Link, workers int, fn func(link domain.Link) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan domain.Link)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range queue {
+				if err := fn(link); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+send:
+	for _, link := range links {
+		select {
+		case queue <- link:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
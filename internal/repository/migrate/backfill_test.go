@@ -0,0 +1,137 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	from, to := maprepo.New(), maprepo.New()
+	for i := 0; i < 25; i++ {
+		_, err := from.Store(ctx, domain.Link{
+			OriginalURL:  fmt.Sprintf("https://google.com/%d", i),
+			ShortenedURL: fmt.Sprintf("s%02d", i),
+		})
+		require.NoError(t, err)
+	}
+	_, err := from.AllocateRange(ctx, 1000)
+	require.NoError(t, err)
+	// Link written by shortener while migration is enabled.
+	_, err = to.Store(ctx, domain.Link{OriginalURL: "https://google.com/3", ShortenedURL: "s03"})
+	require.NoError(t, err)
+	// Other link of original URL, so s07 can't be copied.
+	_, err = to.Store(ctx, domain.Link{OriginalURL: "https://google.com/7", ShortenedURL: "x"})
+	require.NoError(t, err)
+
+	scanner := NewSortedLinks(from.Links(), from)
+	result, err := Verify(ctx, scanner, to, 10, 4)
+	require.NoError(t, err)
+	require.False(t, result.OK())
+	require.Equal(t, int64(24), result.Missing)
+
+	// Copy is interrupted after the first batch.
+	interrupted := errors.New("interrupted")
+	var saved Checkpoint
+	var checkpoint Checkpoint
+	err = Copy(ctx, scanner, to, 10, 4, &checkpoint, func(c Checkpoint) error {
+		saved = c
+		return interrupted
+	})
+	require.ErrorIs(t, err, interrupted)
+	require.Equal(t, Checkpoint{After: "s09", Copied: 10, Conflicts: 1}, saved)
+
+	checkpoint = saved
+	saves := 0
+	err = Copy(ctx, scanner, to, 10, 4, &checkpoint, func(c Checkpoint) error {
+		saves++
+		saved = c
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, saves)
+	require.Equal(t, Checkpoint{After: "s24", Done: true, Copied: 25, Conflicts: 1}, saved)
+
+	next, err := to.AllocateRange(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), next)
+
+	result, err = Verify(ctx, scanner, to, 10, 4)
+	require.NoError(t, err)
+	require.Equal(t, VerifyResult{Checked: 25, Missing: 1}, result)
+
+	// Done copy isn't repeated.
+	err = Copy(ctx, scanner, to, 10, 4, &checkpoint, func(Checkpoint) error {
+		t.Fatal("checkpoint is saved after copy is done")
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	ctx := context.Background()
+	from, to := maprepo.New(), maprepo.New()
+	_, err := from.Store(ctx, link)
+	require.NoError(t, err)
+	_, err = to.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: link.ShortenedURL})
+	require.NoError(t, err)
+
+	result, err := Verify(ctx, NewSortedLinks(from.Links(), nil), to, 10, 1)
+	require.NoError(t, err)
+	require.Equal(t, VerifyResult{Checked: 1, Mismatched: 1}, result)
+}
+
+func TestCopyStoreError(t *testing.T) {
+	ctx := context.Background()
+	from := maprepo.New()
+	_, err := from.Store(ctx, link)
+	require.NoError(t, err)
+
+	var checkpoint Checkpoint
+	err = Copy(ctx, NewSortedLinks(from.Links(), nil), brokenRepo{maprepo.New()}, 10, 4, &checkpoint, func(Checkpoint) error {
+		t.Fatal("checkpoint is saved after failed batch")
+		return nil
+	})
+	require.Error(t, err)
+	require.Equal(t, Checkpoint{}, checkpoint)
+}
+
+func TestSortedLinks(t *testing.T) {
+	ctx := context.Background()
+	var links []domain.Link
+	for _, shortened := range []string{"d", "b", "e", "a", "c"} {
+		links = append(links, domain.Link{OriginalURL: "https://google.com/" + shortened, ShortenedURL: shortened})
+	}
+	scanner := NewSortedLinks(links, nil)
+
+	scanned, err := scanner.ScanLinks(ctx, "", 2)
+	require.NoError(t, err)
+	require.Equal(t, []domain.Link{
+		{OriginalURL: "https://google.com/a", ShortenedURL: "a"},
+		{OriginalURL: "https://google.com/b", ShortenedURL: "b"},
+	}, scanned)
+
+	scanned, err = scanner.ScanLinks(ctx, "b", 10)
+	require.NoError(t, err)
+	require.Len(t, scanned, 3)
+	require.Equal(t, "c", scanned[0].ShortenedURL)
+	require.Equal(t, "e", scanned[2].ShortenedURL)
+
+	scanned, err = scanner.ScanLinks(ctx, "e", 10)
+	require.NoError(t, err)
+	require.Empty(t, scanned)
+
+	// Without allocator ID counter of target isn't moved.
+	to := maprepo.New()
+	var checkpoint Checkpoint
+	require.NoError(t, Copy(ctx, scanner, to, 10, 1, &checkpoint, func(Checkpoint) error { return nil }))
+	next, err := to.AllocateRange(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), next)
+}
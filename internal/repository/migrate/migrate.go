@@ -0,0 +1,242 @@
+// Package migrate implements repository.ShortenerRepo which writes links to two repositories,
+// so they are moved from one to another without downtime (see Copy and Verify for old links).
+package migrate
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultShadowReads   = 1
+	defaultShadowTimeout = time.Second
+	defaultShadowWorkers = 100
+)
+
+type Config struct {
+	// ShadowReads is share of resolves also read from secondary and compared, 0 disables them.
+	ShadowReads float64 `yaml:"shadow_reads"`
+	// ShadowTimeout limits single shadow read.
+	ShadowTimeout time.Duration `yaml:"shadow_timeout"`
+	// ShadowWorkers is max number of concurrent shadow reads, extra ones are skipped.
+	ShadowWorkers int `yaml:"shadow_workers"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		ShadowReads:   defaultShadowReads,
+		ShadowTimeout: defaultShadowTimeout,
+		ShadowWorkers: defaultShadowWorkers,
+	}
+}
+
+// Allocator is implemented by repositories which lease ID ranges to counter generators.
+type Allocator interface {
+	// AllocateRange reserves size IDs and returns first of them, zero size returns next ID.
+	AllocateRange(ctx context.Context, size uint64) (uint64, error)
+}
+
+// Repo implements repository.ShortenerRepo.
+// Links are stored in primary and then in secondary, answers come from primary
+// and failures of secondary are only logged. Resolves are shadow-read from secondary
+// in background and compared with primary. ID ranges are allocated in both,
+// so counter generators don't repeat IDs after cut-over, other extra interfaces
+// (click counters, slug pool, notifications) are served by primary only.
+type Repo struct {
+	primary   repository.ShortenerRepo
+	secondary repository.ShortenerRepo
+	config    Config
+
+	// shadow limits concurrent shadow reads, wg waits for them on Close.
+	shadow chan struct{}
+	wg     sync.WaitGroup
+
+	metrics          *expvar.Map
+	secondaryErrors  *expvar.Int
+	secondaryDiffers *expvar.Int
+	shadowReads      *expvar.Int
+	shadowMatches    *expvar.Int
+	shadowMissing    *expvar.Int
+	shadowMismatches *expvar.Int
+	shadowErrors     *expvar.Int
+	shadowSkipped    *expvar.Int
+}
+
+func New(primary, secondary repository.ShortenerRepo, config Config) (*Repo, error) {
+	if config.ShadowReads < 0 || config.ShadowReads > 1 {
+		return nil, errors.New("shadow reads must be from 0 to 1")
+	}
+	if config.ShadowReads > 0 && config.ShadowTimeout <= 0 {
+		return nil, errors.New("shadow timeout must be positive")
+	}
+	if config.ShadowReads > 0 && config.ShadowWorkers <= 0 {
+		return nil, errors.New("shadow workers must be positive")
+	}
+
+	r := &Repo{
+		primary:          primary,
+		secondary:        secondary,
+		config:           config,
+		shadow:           make(chan struct{}, config.ShadowWorkers),
+		metrics:          new(expvar.Map).Init(),
+		secondaryErrors:  new(expvar.Int),
+		secondaryDiffers: new(expvar.Int),
+		shadowReads:      new(expvar.Int),
+		shadowMatches:    new(expvar.Int),
+		shadowMissing:    new(expvar.Int),
+		shadowMismatches: new(expvar.Int),
+		shadowErrors:     new(expvar.Int),
+		shadowSkipped:    new(expvar.Int),
+	}
+	r.metrics.Set("secondary_errors", r.secondaryErrors)
+	r.metrics.Set("secondary_differs", r.secondaryDiffers)
+	r.metrics.Set("shadow_reads", r.shadowReads)
+	r.metrics.Set("shadow_matches", r.shadowMatches)
+	r.metrics.Set("shadow_missing", r.shadowMissing)
+	r.metrics.Set("shadow_mismatches", r.shadowMismatches)
+	r.metrics.Set("shadow_errors", r.shadowErrors)
+	r.metrics.Set("shadow_skipped", r.shadowSkipped)
+	return r, nil
+}
+
+// Store stores link in primary, and then link stored by primary in secondary,
+// so it keeps the same link when original URL already exists.
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	stored, err := r.primary.Store(ctx, link)
+	if err != nil {
+		return stored, err
+	}
+
+	secondary, err := r.secondary.Store(ctx, stored)
+	switch {
+	case err != nil:
+		r.secondaryErrors.Add(1)
+		slog.Error("migration store in secondary",
+			slog.String("shortened", stored.ShortenedURL), slog.String("error", err.Error()))
+	case secondary != stored:
+		r.secondaryDiffers.Add(1)
+		slog.Warn("migration secondary has other link for original URL",
+			slog.String("shortened", stored.ShortenedURL), slog.String("secondary", secondary.ShortenedURL))
+	}
+	return stored, nil
+}
+
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	original, err := r.primary.Get(ctx, shortened)
+	if err == nil || errors.Is(err, service.ErrNotFound) {
+		r.shadowRead(shortened, original, err)
+	}
+	return original, err
+}
+
+// shadowRead compares answer of primary with secondary in background.
+func (r *Repo) shadowRead(shortened, original string, err error) {
+	if r.config.ShadowReads <= 0 || rand.Float64() >= r.config.ShadowReads {
+		return
+	}
+
+	select {
+	case r.shadow <- struct{}{}:
+	default:
+		r.shadowSkipped.Add(1)
+		return
+	}
+
+	r.shadowReads.Add(1)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer func() { <-r.shadow }()
+
+		// Request may be done before shadow read, so it has own context.
+		ctx, cancel := context.WithTimeout(context.Background(), r.config.ShadowTimeout)
+		defer cancel()
+
+		secondary, secondaryErr := r.secondary.Get(ctx, shortened)
+		r.compare(shortened, original, err, secondary, secondaryErr)
+	}()
+}
+
+func (r *Repo) compare(shortened, original string, err error, secondary string, secondaryErr error) {
+	found := err == nil
+	switch {
+	case secondaryErr != nil && !errors.Is(secondaryErr, service.ErrNotFound):
+		r.shadowErrors.Add(1)
+		slog.Warn("migration shadow read", slog.String("shortened", shortened),
+			slog.String("error", secondaryErr.Error()))
+	case found && secondaryErr != nil:
+		r.shadowMissing.Add(1)
+		slog.Warn("migration shadow read: link is missing in secondary", slog.String("shortened", shortened))
+	case found == (secondaryErr == nil) && original == secondary:
+		r.shadowMatches.Add(1)
+	default:
+		r.shadowMismatches.Add(1)
+		slog.Warn("migration shadow read: link differs in secondary", slog.String("shortened", shortened),
+			slog.String("primary", original), slog.String("secondary", secondary))
+	}
+}
+
+// AllocateRange allocates range in primary and moves counter of secondary past it,
+// if both of them allocate ranges.
+func (r *Repo) AllocateRange(ctx context.Context, size uint64) (uint64, error) {
+	primary, ok := repository.As[Allocator](r.primary)
+	if !ok {
+		return 0, errors.New("primary storage doesn't allocate ID ranges")
+	}
+	start, err := primary.AllocateRange(ctx, size)
+	if err != nil {
+		return 0, err
+	}
+
+	secondary, ok := repository.As[Allocator](r.secondary)
+	if !ok {
+		return start, nil
+	}
+	if err = advance(ctx, secondary, start+size); err != nil {
+		r.secondaryErrors.Add(1)
+		slog.Error("migration allocate range in secondary", slog.String("error", err.Error()))
+	}
+	return start, nil
+}
+
+// advance moves counter of alloc to at least next, IDs below it are skipped.
+func advance(ctx context.Context, alloc Allocator, next uint64) error {
+	current, err := alloc.AllocateRange(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("current ID: %w", err)
+	}
+	if current >= next {
+		return nil
+	}
+	if _, err = alloc.AllocateRange(ctx, next-current); err != nil {
+		return fmt.Errorf("skip IDs: %w", err)
+	}
+	return nil
+}
+
+// Metrics returns numbers of failed and differing stores in secondary and results of shadow reads.
+func (r *Repo) Metrics() expvar.Var {
+	return r.metrics
+}
+
+// Unwrap returns primary repository.
+func (r *Repo) Unwrap() repository.ShortenerRepo {
+	return r.primary
+}
+
+// Close waits for shadow reads, which are limited by shadow timeout, and closes both repositories.
+func (r *Repo) Close(ctx context.Context) {
+	r.wg.Wait()
+	r.primary.Close(ctx)
+	r.secondary.Close(ctx)
+}
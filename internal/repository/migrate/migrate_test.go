@@ -0,0 +1,199 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/amanakin/shortener/internal/repository/repotest"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenRepo fails all calls.
+type brokenRepo struct {
+	*maprepo.Repo
+}
+
+func (brokenRepo) Store(_ context.Context, link domain.Link) (domain.Link, error) {
+	return link, errors.New("connection refused")
+}
+
+func (brokenRepo) Get(context.Context, string) (string, error) {
+	return "", errors.New("connection refused")
+}
+
+var link = domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+
+func newRepo(t *testing.T, primary, secondary repository.ShortenerRepo) *Repo {
+	t.Helper()
+	repo, err := New(primary, secondary, DefaultConfig())
+	require.NoError(t, err)
+	return repo
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.ShortenerRepo {
+		return newRepo(t, maprepo.New(), maprepo.New())
+	})
+}
+
+func TestConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.ShadowReads = 2
+	_, err := New(maprepo.New(), maprepo.New(), config)
+	require.Error(t, err)
+
+	config = DefaultConfig()
+	config.ShadowWorkers = 0
+	_, err = New(maprepo.New(), maprepo.New(), config)
+	require.Error(t, err)
+
+	config.ShadowReads = 0
+	_, err = New(maprepo.New(), maprepo.New(), config)
+	require.NoError(t, err)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("link is stored in both", func(t *testing.T) {
+		primary, secondary := maprepo.New(), maprepo.New()
+		repo := newRepo(t, primary, secondary)
+
+		stored, err := repo.Store(ctx, link)
+		require.NoError(t, err)
+		require.Equal(t, link, stored)
+
+		original, err := secondary.Get(ctx, link.ShortenedURL)
+		require.NoError(t, err)
+		require.Equal(t, link.OriginalURL, original)
+	})
+
+	t.Run("secondary gets link of primary", func(t *testing.T) {
+		primary, secondary := maprepo.New(), maprepo.New()
+		_, err := primary.Store(ctx, link)
+		require.NoError(t, err)
+		repo := newRepo(t, primary, secondary)
+
+		stored, err := repo.Store(ctx, domain.Link{OriginalURL: link.OriginalURL, ShortenedURL: "def"})
+		require.NoError(t, err)
+		require.Equal(t, link, stored)
+
+		original, err := secondary.Get(ctx, link.ShortenedURL)
+		require.NoError(t, err)
+		require.Equal(t, link.OriginalURL, original)
+		_, err = secondary.Get(ctx, "def")
+		require.ErrorIs(t, err, service.ErrNotFound)
+	})
+
+	t.Run("secondary conflicts are counted", func(t *testing.T) {
+		primary, secondary := maprepo.New(), maprepo.New()
+		_, err := secondary.Store(ctx, domain.Link{OriginalURL: link.OriginalURL, ShortenedURL: "def"})
+		require.NoError(t, err)
+		repo := newRepo(t, primary, secondary)
+
+		stored, err := repo.Store(ctx, link)
+		require.NoError(t, err)
+		require.Equal(t, link, stored)
+		require.Equal(t, int64(1), repo.secondaryDiffers.Value())
+	})
+
+	t.Run("secondary errors don't fail store", func(t *testing.T) {
+		repo := newRepo(t, maprepo.New(), brokenRepo{maprepo.New()})
+
+		stored, err := repo.Store(ctx, link)
+		require.NoError(t, err)
+		require.Equal(t, link, stored)
+		require.Equal(t, int64(1), repo.secondaryErrors.Value())
+	})
+
+	t.Run("primary errors fail store", func(t *testing.T) {
+		secondary := maprepo.New()
+		repo := newRepo(t, brokenRepo{maprepo.New()}, secondary)
+
+		_, err := repo.Store(ctx, link)
+		require.Error(t, err)
+		_, err = secondary.Get(ctx, link.ShortenedURL)
+		require.ErrorIs(t, err, service.ErrNotFound)
+	})
+}
+
+func TestShadowReads(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := maprepo.New(), maprepo.New()
+	for _, shortened := range []string{"match", "missing", "mismatch"} {
+		_, err := primary.Store(ctx, domain.Link{OriginalURL: "https://google.com/" + shortened, ShortenedURL: shortened})
+		require.NoError(t, err)
+	}
+	_, err := secondary.Store(ctx, domain.Link{OriginalURL: "https://google.com/match", ShortenedURL: "match"})
+	require.NoError(t, err)
+	_, err = secondary.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "mismatch"})
+	require.NoError(t, err)
+	_, err = secondary.Store(ctx, domain.Link{OriginalURL: "https://go.dev", ShortenedURL: "extra"})
+	require.NoError(t, err)
+
+	repo := newRepo(t, primary, secondary)
+	for _, shortened := range []string{"match", "missing", "mismatch", "unknown"} {
+		original, err := repo.Get(ctx, shortened)
+		if shortened == "unknown" {
+			require.ErrorIs(t, err, service.ErrNotFound)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, "https://google.com/"+shortened, original)
+	}
+	// Link missing in primary is answered by primary, secondary only differs.
+	_, err = repo.Get(ctx, "extra")
+	require.ErrorIs(t, err, service.ErrNotFound)
+	repo.wg.Wait()
+
+	require.Equal(t, int64(5), repo.shadowReads.Value())
+	require.Equal(t, int64(2), repo.shadowMatches.Value())
+	require.Equal(t, int64(1), repo.shadowMissing.Value())
+	require.Equal(t, int64(2), repo.shadowMismatches.Value())
+	require.Equal(t, int64(0), repo.shadowErrors.Value())
+
+	repo = newRepo(t, primary, brokenRepo{secondary})
+	_, err = repo.Get(ctx, "match")
+	require.NoError(t, err)
+	repo.wg.Wait()
+	require.Equal(t, int64(1), repo.shadowErrors.Value())
+}
+
+func TestShadowReadsDisabled(t *testing.T) {
+	config := DefaultConfig()
+	config.ShadowReads = 0
+	repo, err := New(maprepo.New(), brokenRepo{maprepo.New()}, config)
+	require.NoError(t, err)
+
+	_, err = repo.Get(context.Background(), link.ShortenedURL)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	repo.wg.Wait()
+	require.Equal(t, int64(0), repo.shadowReads.Value())
+}
+
+func TestAllocateRange(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := maprepo.New(), maprepo.New()
+	_, err := primary.AllocateRange(ctx, 100)
+	require.NoError(t, err)
+	repo := newRepo(t, primary, secondary)
+
+	start, err := repo.AllocateRange(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), start)
+
+	// IDs leased from primary are never leased by secondary after cut-over.
+	next, err := secondary.AllocateRange(ctx, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(110), next)
+
+	// Only ShortenerRepo methods are promoted, so primary doesn't allocate ranges.
+	plain := struct{ repository.ShortenerRepo }{maprepo.New()}
+	_, err = newRepo(t, plain, secondary).AllocateRange(ctx, 10)
+	require.Error(t, err)
+}
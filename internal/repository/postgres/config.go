@@ -0,0 +1,298 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultEnabled         = true
+	defaultHost            = "localhost"
+	defaultPort            = 5432
+	defaultUser            = "postgres"
+	defaultPassword        = "postgres"
+	defaultDBName          = "postgres"
+	defaultApplicationName = "shortener"
+	defaultSchema          = "shortener"
+)
+
+// redacted replaces secrets in logs.
+const redacted = "xxxxx"
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// DSN is keyword/value ("host=db user=dev") or URL ("postgres://dev@db/shortener") connection string,
+	// if it's set, Host, Port, User, Password and DBName are not used.
+	DSN      string `yaml:"dsn"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"dbname"`
+
+	// SSLMode is disable, allow, prefer, require, verify-ca or verify-full, empty is prefer.
+	SSLMode string `yaml:"sslmode"`
+	// SSLRootCert is path of CA certificates for verify-ca and verify-full.
+	SSLRootCert string `yaml:"sslrootcert"`
+	// SSLCert and SSLKey are paths of client certificate and its key.
+	SSLCert string `yaml:"sslcert"`
+	SSLKey  string `yaml:"sslkey"`
+
+	// MinConns and MaxConns limit pool size, zero keeps pgxpool defaults.
+	MinConns int32 `yaml:"min_conns"`
+	MaxConns int32 `yaml:"max_conns"`
+	// MaxConnLifetime and MaxConnIdleTime close older connections, zero keeps pgxpool defaults.
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+
+	// StatementTimeout aborts longer statements on server, zero is no timeout.
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	ApplicationName  string        `yaml:"application_name"`
+	// Schema has tables of sql/schema.sql, it's search_path of connections.
+	Schema string `yaml:"schema"`
+
+	// ConnectAttempts is number of connection attempts on start, they're made with backoff.
+	ConnectAttempts int `yaml:"connect_attempts"`
+	// Retries is number of retries of Store, Get, AllocateRange and ClaimSlug on transient errors.
+	Retries int `yaml:"retries"`
+	// MinBackoff and MaxBackoff limit exponential delay between attempts.
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// BreakerFailures is number of failed calls in a row after which calls fail fast
+	// with service.ErrUnavailable for BreakerCooldown, zero disables circuit breaker.
+	BreakerFailures int           `yaml:"breaker_failures"`
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown"`
+
+	// Replicas serve reads, Store and other writes go to primary.
+	Replicas []ReplicaConfig `yaml:"replicas"`
+	// MaxReplicaLag is max replay lag of replica which serves reads.
+	MaxReplicaLag time.Duration `yaml:"max_replica_lag"`
+	// ReplicaCheckInterval is period of replica health and lag checks.
+	ReplicaCheckInterval time.Duration `yaml:"replica_check_interval"`
+	// ReadYourWrites is time after Store when shortened URL is read from primary.
+	ReadYourWrites time.Duration `yaml:"read_your_writes"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Enabled:         defaultEnabled,
+		Host:            defaultHost,
+		Port:            defaultPort,
+		User:            defaultUser,
+		Password:        defaultPassword,
+		DBName:          defaultDBName,
+		ApplicationName: defaultApplicationName,
+		Schema:          defaultSchema,
+
+		ConnectAttempts: defaultConnectAttempts,
+		Retries:         defaultRetries,
+		MinBackoff:      defaultMinBackoff,
+		MaxBackoff:      defaultMaxBackoff,
+		BreakerFailures: defaultBreakerFailures,
+		BreakerCooldown: defaultBreakerCooldown,
+
+		MaxReplicaLag:        defaultMaxReplicaLag,
+		ReplicaCheckInterval: defaultReplicaCheckInterval,
+		ReadYourWrites:       defaultReadYourWrites,
+	}
+}
+
+// LogValue hides password, so config may be logged.
+func (c Config) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("sslmode", c.SSLMode), slog.String("schema", c.Schema)}
+	if c.DSN != "" {
+		attrs = append(attrs, slog.String("dsn", redactDSN(c.DSN)))
+	} else {
+		attrs = append(attrs,
+			slog.String("host", c.Host),
+			slog.Int("port", c.Port),
+			slog.String("user", c.User),
+			slog.String("dbname", c.DBName))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// connString returns connection string of config with TLS settings.
+func (c Config) connString() (string, error) {
+	connString := c.DSN
+	if connString == "" {
+		connString = keywordValue(map[string]string{
+			"host":     c.Host,
+			"port":     strconv.Itoa(c.Port),
+			"user":     c.User,
+			"password": c.Password,
+			"dbname":   c.DBName,
+		})
+	}
+
+	params := make(map[string]string)
+	for key, value := range map[string]string{
+		"sslmode":     c.SSLMode,
+		"sslrootcert": c.SSLRootCert,
+		"sslcert":     c.SSLCert,
+		"sslkey":      c.SSLKey,
+	} {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	return withParams(connString, params)
+}
+
+// PoolConfig parses config to pgxpool config.
+func PoolConfig(config Config) (*pgxpool.Config, error) {
+	if config.MinConns < 0 || config.MaxConns < 0 || config.MaxConns > 0 && config.MinConns > config.MaxConns {
+		return nil, errors.New("min_conns must be in [0, max_conns]")
+	}
+
+	connString, err := config.connString()
+	if err != nil {
+		return nil, err
+	}
+	// Error of ParseConfig has redacted connection string.
+	pgxConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.MinConns > 0 {
+		pgxConfig.MinConns = config.MinConns
+	}
+	if config.MaxConns > 0 {
+		pgxConfig.MaxConns = config.MaxConns
+	}
+	if config.MaxConnLifetime > 0 {
+		pgxConfig.MaxConnLifetime = config.MaxConnLifetime
+	}
+	if config.MaxConnIdleTime > 0 {
+		pgxConfig.MaxConnIdleTime = config.MaxConnIdleTime
+	}
+
+	params := pgxConfig.ConnConfig.RuntimeParams
+	if config.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(config.StatementTimeout.Milliseconds(), 10)
+	}
+	if config.ApplicationName != "" {
+		params["application_name"] = config.ApplicationName
+	}
+	if config.Schema != "" {
+		params["search_path"] = pgx.Identifier{config.Schema}.Sanitize()
+	}
+	return pgxConfig, nil
+}
+
+// NewPool connects to database of config and checks connection.
+// Transient errors are retried up to config.ConnectAttempts times with backoff.
+func NewPool(ctx context.Context, config Config) (*pgxpool.Pool, error) {
+	pgxConfig, err := PoolConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("connecting to postgres", slog.Any("config", config),
+		slog.Bool("tls", pgxConfig.ConnConfig.TLSConfig != nil))
+
+	pool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	b := backoff{min: config.MinBackoff, max: config.MaxBackoff}
+	for attempt := 1; ; attempt++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+		if attempt >= config.ConnectAttempts || !isTransient(err) {
+			pool.Close()
+			return nil, err
+		}
+
+		delay := b.delay(attempt - 1)
+		slog.Warn("postgres is not available, retrying",
+			slog.Int("attempt", attempt), slog.Duration("backoff", delay), slog.String("error", err.Error()))
+		if err = sleep(ctx, delay); err != nil {
+			pool.Close()
+			return nil, err
+		}
+	}
+}
+
+// keywordValue makes keyword/value connection string, values are quoted.
+func keywordValue(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(params[key])
+		fmt.Fprintf(&b, "%s='%s'", key, value)
+	}
+	return b.String()
+}
+
+func isURL(connString string) bool {
+	return strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://")
+}
+
+// withParams sets params in connection string of any form, they override existing ones.
+func withParams(connString string, params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return connString, nil
+	}
+
+	if !isURL(connString) {
+		// Later keywords override earlier ones.
+		return strings.TrimSpace(connString + " " + keywordValue(params)), nil
+	}
+
+	u, err := url.Parse(connString)
+	if err != nil {
+		return "", errors.New("invalid dsn URL")
+	}
+	query := u.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+var dsnPassword = regexp.MustCompile(`password\s*=\s*('(\\.|[^'])*'|\S*)`)
+
+// redactDSN hides password in connection string.
+func redactDSN(connString string) string {
+	if isURL(connString) {
+		u, err := url.Parse(connString)
+		if err != nil {
+			return redacted
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(connString, "password="+redacted)
+}
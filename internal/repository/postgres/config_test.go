@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+)
+
+func TestPoolConfig(t *testing.T) {
+	config := DefaultConfig()
+	config.Host = "db"
+	config.Password = `p@ss 'word\`
+	config.SSLMode = "disable"
+	config.MinConns = 2
+	config.MaxConns = 20
+	config.MaxConnLifetime = time.Hour
+	config.MaxConnIdleTime = time.Minute
+	config.StatementTimeout = 1500 * time.Millisecond
+	config.Schema = "links"
+
+	pgxConfig, err := PoolConfig(config)
+	require.NoError(t, err)
+
+	connConfig := pgxConfig.ConnConfig
+	require.Equal(t, "db", connConfig.Host)
+	require.Equal(t, uint16(5432), connConfig.Port)
+	require.Equal(t, `p@ss 'word\`, connConfig.Password)
+	require.Nil(t, connConfig.TLSConfig)
+	require.Equal(t, int32(2), pgxConfig.MinConns)
+	require.Equal(t, int32(20), pgxConfig.MaxConns)
+	require.Equal(t, time.Hour, pgxConfig.MaxConnLifetime)
+	require.Equal(t, time.Minute, pgxConfig.MaxConnIdleTime)
+	require.Equal(t, map[string]string{
+		"statement_timeout": "1500",
+		"application_name":  "shortener",
+		"search_path":       `"links"`,
+	}, connConfig.RuntimeParams)
+}
+
+func TestPoolConfigDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+	}{
+		{name: "keyword/value", dsn: "host=db port=6432 user=dev password=secret dbname=shortener sslmode=require"},
+		{name: "URL", dsn: "postgres://dev:secret@db:6432/shortener?sslmode=require"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.DSN = tt.dsn
+			// Settings of config override DSN.
+			config.SSLMode = "disable"
+
+			pgxConfig, err := PoolConfig(config)
+			require.NoError(t, err)
+
+			connConfig := pgxConfig.ConnConfig
+			require.Equal(t, "db", connConfig.Host)
+			require.Equal(t, uint16(6432), connConfig.Port)
+			require.Equal(t, "dev", connConfig.User)
+			require.Equal(t, "secret", connConfig.Password)
+			require.Equal(t, "shortener", connConfig.Database)
+			require.Nil(t, connConfig.TLSConfig)
+		})
+	}
+}
+
+func TestPoolConfigInvalid(t *testing.T) {
+	config := DefaultConfig()
+	config.MinConns = 10
+	config.MaxConns = 5
+	_, err := PoolConfig(config)
+	require.Error(t, err)
+
+	config = DefaultConfig()
+	config.DSN = "host=db password=secret sslmode=wrong"
+	_, err = PoolConfig(config)
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "secret")
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{dsn: "host=db password=secret user=dev", want: "host=db password=xxxxx user=dev"},
+		{dsn: "host=db password='se cr\\'et' user=dev", want: "host=db password=xxxxx user=dev"},
+		{dsn: "host=db password = secret", want: "host=db password=xxxxx"},
+		{dsn: "postgres://dev:secret@db/shortener", want: "postgres://dev:xxxxx@db/shortener"},
+		{dsn: "postgres://dev@db/shortener?password=secret", want: "postgres://dev@db/shortener?password=xxxxx"},
+		{dsn: "postgresql://db/shortener", want: "postgresql://db/shortener"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			require.Equal(t, tt.want, redactDSN(tt.dsn))
+		})
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	config := DefaultConfig()
+	config.Password = "secret"
+	logger.Info("config", slog.Any("postgres", config))
+
+	config.DSN = "postgres://dev:secret@db/shortener"
+	logger.Info("config", slog.Any("postgres", config))
+
+	require.False(t, strings.Contains(buf.String(), "secret"), buf.String())
+	require.Contains(t, buf.String(), "postgres.host=localhost")
+}
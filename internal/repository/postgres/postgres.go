@@ -2,99 +2,152 @@ package postgres
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
+	"expvar"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/amanakin/shortener/internal/domain"
 	"github.com/amanakin/shortener/internal/service"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/exp/slog"
 )
 
-const (
-	defaultEnabled  = true
-	defaultHost     = "localhost"
-	defaultPort     = 5432
-	defaultUser     = "postgres"
-	defaultPassword = "postgres"
-	defaultDBName   = "postgres"
-)
+// idRangeSlug is shortener.id_ranges row used by counter generator.
+const idRangeSlug = "slug"
 
-type Config struct {
-	Enabled  bool   `yaml:"enabled"`
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	DBName   string `yaml:"dbname"`
-}
+const (
+	// notifyChannel gets short URLs changed in shortener.urls, see sql/schema.sql.
+	notifyChannel = "shortener_urls"
 
-func DefaultConfig() Config {
-	return Config{
-		Enabled:  defaultEnabled,
-		Host:     defaultHost,
-		Port:     defaultPort,
-		User:     defaultUser,
-		Password: defaultPassword,
-		DBName:   defaultDBName,
-	}
-}
+	minListenBackoff = 100 * time.Millisecond
+	maxListenBackoff = 10 * time.Second
+)
 
 type Repo struct {
-	pool *pgxpool.Pool
-}
+	// pool is primary.
+	pool   *pgxpool.Pool
+	router *router
 
-func New(config Config) (*Repo, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d",
-		config.Host, config.User, config.Password, config.DBName, config.Port)
+	retries  int
+	backoff  backoff
+	breaker  *breaker
+	retried  atomic.Uint64
+	rejected atomic.Uint64
+}
 
-	slog.Info("info", slog.String("dsn", dsn))
-	pgxConfig, err := pgxpool.ParseConfig(dsn)
-	if err != nil {
-		return nil, err
+// New connects to primary, replicas are connected lazily and serve reads after the first health check.
+func New(ctx context.Context, config Config) (*Repo, error) {
+	if len(config.Replicas) > 0 && config.ReplicaCheckInterval <= 0 {
+		return nil, errors.New("replica check interval must be positive")
 	}
 
-	pool, err := pgxpool.NewWithConfig(context.Background(), pgxConfig)
+	pool, err := NewPool(ctx, config)
 	if err != nil {
 		return nil, err
 	}
 
-	err = pool.Ping(context.Background())
-	if err != nil {
-		return nil, err
+	r := &Repo{
+		pool: pool,
+		router: &router{
+			primary:       pool,
+			maxLag:        config.MaxReplicaLag,
+			checkInterval: config.ReplicaCheckInterval,
+			recent:        newRecentWrites(config.ReadYourWrites),
+		},
+		retries: config.Retries,
+		backoff: backoff{min: config.MinBackoff, max: config.MaxBackoff},
+		breaker: newBreaker(config.BreakerFailures, config.BreakerCooldown),
+	}
+	for _, replicaConfig := range config.Replicas {
+		replica, err := newReplica(ctx, config, replicaConfig)
+		if err != nil {
+			r.Close(context.Background())
+			return nil, err
+		}
+		r.router.replicas = append(r.router.replicas, replica)
 	}
+	r.router.check(ctx)
 
-	return &Repo{
-		pool: pool,
-	}, nil
+	return r, nil
+}
+
+// Run checks health and lag of replicas until ctx is done.
+func (r *Repo) Run(ctx context.Context) {
+	r.router.run(ctx)
+}
+
+// Ping checks that primary is reachable.
+func (r *Repo) Ping(ctx context.Context) error {
+	return r.pool.Ping(ctx)
+}
+
+// Metrics returns state of circuit breaker, retries, reads of primary and replicas and replicas state.
+func (r *Repo) Metrics() expvar.Var {
+	m := r.router.metrics()
+	m.Set("breaker", expvar.Func(func() any { return r.breaker.current().String() }))
+	m.Set("retries", expvar.Func(func() any { return r.retried.Load() }))
+	m.Set("rejected", expvar.Func(func() any { return r.rejected.Load() }))
+	return m
+}
+
+// isUniqueViolation reports if insert conflicts with row committed by concurrent transaction.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" // unique_violation
+}
+
+// hashURL returns key used for uniqueness of original URL.
+// Must match sha256(convert_to(original_url, 'UTF8')) in sql/migrations.
+func hashURL(original string) []byte {
+	hash := sha256.Sum256([]byte(original))
+	return hash[:]
 }
 
 func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	var stored domain.Link
+	err := r.call(ctx, func() error {
+		var err error
+		stored, err = r.store(ctx, link)
+		// Concurrent store of the same URL has committed first, so next attempt finds it.
+		if isUniqueViolation(err) {
+			stored, err = r.store(ctx, link)
+		}
+		return err
+	})
+	if err != nil {
+		return link, err
+	}
+	return stored, nil
+}
+
+func (r *Repo) store(ctx context.Context, link domain.Link) (domain.Link, error) {
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return link, err
 	}
-	defer func() {
-		if rErr := tx.Rollback(ctx); rErr != nil {
-			err = errors.Join(err, fmt.Errorf("rollback: %w", rErr))
-		}
-	}()
+	defer tx.Rollback(ctx) // no-op after successful commit
+
+	originalHash := hashURL(link.OriginalURL)
 
 	var shortened string
-	err = r.pool.QueryRow(ctx, "SELECT short_url FROM shortener.urls WHERE original_url = $1",
-		link.OriginalURL).Scan(&shortened)
+	err = tx.QueryRow(ctx, "SELECT short_url FROM urls WHERE original_hash = $1",
+		originalHash).Scan(&shortened)
 
 	// Original URL already exists
 	if err == nil {
 		link.ShortenedURL = shortened
 		return link, nil
 	} else if !errors.Is(err, pgx.ErrNoRows) {
-		return link, fmt.Errorf("select by original_url: %w", err)
+		return link, fmt.Errorf("select by original_hash: %w", err)
 	}
 
 	var original string
-	err = r.pool.QueryRow(ctx, "SELECT original_url FROM shortener.urls WHERE short_url = $1",
+	err = tx.QueryRow(ctx, "SELECT original_url FROM urls WHERE short_url = $1",
 		link.ShortenedURL).Scan(&original)
 
 	// Shortened URL already exists
@@ -104,8 +157,8 @@ func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error)
 		return link, fmt.Errorf("select by short_url: %w", err)
 	}
 
-	_, err = r.pool.Exec(ctx, "INSERT INTO shortener.urls (original_url, short_url) VALUES ($1, $2)",
-		link.OriginalURL, link.ShortenedURL)
+	_, err = tx.Exec(ctx, "INSERT INTO urls (original_url, original_hash, short_url) VALUES ($1, $2, $3)",
+		link.OriginalURL, originalHash, link.ShortenedURL)
 	if err != nil {
 		return link, fmt.Errorf("insert link: %w", err)
 	}
@@ -113,13 +166,18 @@ func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error)
 	if err = tx.Commit(ctx); err != nil {
 		return link, fmt.Errorf("commit: %w", err)
 	}
+	r.router.recent.add(link.ShortenedURL)
 
 	return link, nil
 }
 
 func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
 	var original string
-	err := r.pool.QueryRow(ctx, "SELECT original_url FROM shortener.urls WHERE short_url = $1", shortened).Scan(&original)
+	err := r.call(ctx, func() error {
+		return r.router.read(ctx, shortened, func(pool *pgxpool.Pool) error {
+			return pool.QueryRow(ctx, "SELECT original_url FROM urls WHERE short_url = $1", shortened).Scan(&original)
+		})
+	})
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return "", service.ErrNotFound
@@ -130,6 +188,238 @@ func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
 	return original, nil
 }
 
+func (r *Repo) StoreUnicodeHost(ctx context.Context, shortened, host string) error {
+	tag, err := r.pool.Exec(ctx, "UPDATE urls SET unicode_host = $2 WHERE short_url = $1", shortened, host)
+	if err != nil {
+		return fmt.Errorf("update unicode_host: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return service.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Repo) UnicodeHost(ctx context.Context, shortened string) (string, error) {
+	var host *string
+	err := r.call(ctx, func() error {
+		return r.router.read(ctx, shortened, func(pool *pgxpool.Pool) error {
+			return pool.QueryRow(ctx, "SELECT unicode_host FROM urls WHERE short_url = $1", shortened).Scan(&host)
+		})
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", service.ErrNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("select unicode_host: %w", err)
+	}
+	if host == nil {
+		return "", service.ErrNotFound
+	}
+	return *host, nil
+}
+
+// AllocateRange leases IDs from shortener.id_ranges, it is safe for concurrent replicas.
+func (r *Repo) AllocateRange(ctx context.Context, size uint64) (uint64, error) {
+	var start int64
+	err := r.call(ctx, func() error {
+		return r.pool.QueryRow(ctx, `INSERT INTO id_ranges AS r (name, next_id) VALUES ($1, $2)
+			ON CONFLICT (name) DO UPDATE SET next_id = r.next_id + EXCLUDED.next_id
+			RETURNING r.next_id - $2`, idRangeSlug, int64(size)).Scan(&start)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("allocate id range: %w", err)
+	}
+	return uint64(start), nil
+}
+
+func (r *Repo) FillPool(ctx context.Context, paths []string) (int, error) {
+	tag, err := r.pool.Exec(ctx, `INSERT INTO slug_pool (short_url)
+		SELECT p FROM unnest($1::text[]) AS p
+		WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_url = p)
+		ON CONFLICT DO NOTHING`, paths)
+	if err != nil {
+		return 0, fmt.Errorf("insert into slug_pool: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimSlug takes path from pool, concurrent claims skip rows locked by each other.
+func (r *Repo) ClaimSlug(ctx context.Context) (string, error) {
+	var path string
+	err := r.call(ctx, func() error {
+		return r.pool.QueryRow(ctx, `DELETE FROM slug_pool
+			WHERE short_url = (SELECT short_url FROM slug_pool LIMIT 1 FOR UPDATE SKIP LOCKED)
+			RETURNING short_url`).Scan(&path)
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", service.ErrPoolEmpty
+	} else if err != nil {
+		return "", fmt.Errorf("claim from slug_pool: %w", err)
+	}
+
+	return path, nil
+}
+
+func (r *Repo) PoolSize(ctx context.Context) (int, error) {
+	var size int
+	err := r.pool.QueryRow(ctx, "SELECT count(*) FROM slug_pool").Scan(&size)
+	if err != nil {
+		return 0, fmt.Errorf("count slug_pool: %w", err)
+	}
+	return size, nil
+}
+
+// AddClicks adds numbers of resolves to click counters of shortened URLs.
+func (r *Repo) AddClicks(ctx context.Context, clicks map[string]uint64) error {
+	shortened := make([]string, 0, len(clicks))
+	counts := make([]int64, 0, len(clicks))
+	for path, count := range clicks {
+		shortened = append(shortened, path)
+		counts = append(counts, int64(count))
+	}
+
+	_, err := r.pool.Exec(ctx, `UPDATE urls AS u SET clicks = u.clicks + c.n
+		FROM unnest($1::text[], $2::bigint[]) AS c(short_url, n)
+		WHERE u.short_url = c.short_url`, shortened, counts)
+	if err != nil {
+		return fmt.Errorf("update clicks: %w", err)
+	}
+	return nil
+}
+
+// MostClicked returns up to limit links with most clicks.
+func (r *Repo) MostClicked(ctx context.Context, limit int) ([]domain.Link, error) {
+	var links []domain.Link
+	err := r.router.read(ctx, "", func(pool *pgxpool.Pool) error {
+		rows, err := pool.Query(ctx, `SELECT original_url, short_url FROM urls
+			ORDER BY clicks DESC LIMIT $1`, limit)
+		if err != nil {
+			return err
+		}
+
+		links, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.Link, error) {
+			var link domain.Link
+			err := row.Scan(&link.OriginalURL, &link.ShortenedURL)
+			return link, err
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("select most clicked: %w", err)
+	}
+	return links, nil
+}
+
+// CountLinks counts links on primary, it sizes Bloom filter built by ScanShortened.
+func (r *Repo) CountLinks(ctx context.Context) (int, error) {
+	var count int
+	err := r.pool.QueryRow(ctx, "SELECT count(*) FROM urls").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count urls: %w", err)
+	}
+	return count, nil
+}
+
+// ScanShortened streams all short URLs of primary to fn. Lagging replica would miss
+// links stored just before, and rebuilt Bloom filter would answer them as unknown.
+func (r *Repo) ScanShortened(ctx context.Context, fn func(shortened string) error) error {
+	rows, err := r.pool.Query(ctx, "SELECT short_url FROM urls")
+	if err != nil {
+		return fmt.Errorf("select short_url: %w", err)
+	}
+	defer rows.Close()
+
+	var shortened string
+	_, err = pgx.ForEachRow(rows, []any{&shortened}, func() error {
+		return fn(shortened)
+	})
+	if err != nil {
+		return fmt.Errorf("scan short_url: %w", err)
+	}
+	return nil
+}
+
+// ScanLinks returns up to limit links with short URL greater than after, ordered by short URL.
+func (r *Repo) ScanLinks(ctx context.Context, after string, limit int) ([]domain.Link, error) {
+	rows, err := r.pool.Query(ctx, `SELECT original_url, short_url FROM urls
+		WHERE short_url > $1 ORDER BY short_url LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select links: %w", err)
+	}
+
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.Link, error) {
+		var link domain.Link
+		err := row.Scan(&link.OriginalURL, &link.ShortenedURL)
+		return link, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan links: %w", err)
+	}
+	return links, nil
+}
+
+// Listen calls evict with short URLs changed by any replica until ctx is done.
+// Lost connection is restored with exponential backoff, changes made while
+// it was lost are unknown, so flush is called after reconnect.
+func (r *Repo) Listen(ctx context.Context, evict func(shortened string), flush func()) {
+	backoff := minListenBackoff
+	reconnect := false
+
+	for {
+		err := r.listen(ctx, evict, func() {
+			if reconnect {
+				flush()
+			}
+			backoff = minListenBackoff
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Warn("listen for changes, reconnecting",
+			slog.String("error", err.Error()), slog.Duration("backoff", backoff))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+		reconnect = true
+	}
+}
+
+// listen waits for notifications on dedicated connection, connected is called after LISTEN.
+func (r *Repo) listen(ctx context.Context, evict func(shortened string), connected func()) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire: %w", err)
+	}
+	// Listening connection must not return to pool.
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	if _, err = pgConn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	connected()
+
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+		evict(notification.Payload)
+	}
+}
+
+// Shared implements repository.Shared, replicas store links to the same Postgres.
+func (r *Repo) Shared() {}
+
 func (r *Repo) Close(_ context.Context) {
+	r.router.close()
 	r.pool.Close()
 }
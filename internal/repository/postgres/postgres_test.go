@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/repotest"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+// dsn is database for conformance tests, every test makes its own schema there, see make test-postgres.
+var dsn = flag.String("postgres", "", "DSN of Postgres for conformance tests, they are skipped if it's empty")
+
+// schemaPath is fresh install script, its tables are created in schema of test.
+const schemaPath = "../../../sql/schema.sql"
+
+// newTestRepo applies schema.sql to new schema and connects to it, schema is dropped after test.
+func newTestRepo(t *testing.T) repository.ShortenerRepo {
+	t.Helper()
+
+	script, err := os.ReadFile(schemaPath)
+	require.NoError(t, err)
+
+	suffix := make([]byte, 8)
+	_, err = rand.Read(suffix)
+	require.NoError(t, err)
+	schema := "repotest_" + hex.EncodeToString(suffix)
+	// Simple protocol runs whole script, statements are separated by semicolons.
+	script = []byte(strings.ReplaceAll(string(script), "shortener.", schema+"."))
+	script = []byte(strings.Replace(string(script), "SCHEMA IF NOT EXISTS shortener", "SCHEMA "+schema, 1))
+
+	config := DefaultConfig()
+	config.DSN = *dsn
+	config.Schema = schema
+
+	ctx := context.Background()
+	pool, err := NewPool(ctx, config)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	_, err = pool.Exec(ctx, string(script))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := pool.Exec(context.Background(), fmt.Sprintf("DROP SCHEMA %s CASCADE", schema))
+		require.NoError(t, err)
+	})
+
+	repo, err := New(ctx, config)
+	require.NoError(t, err)
+	return repo
+}
+
+func TestConformance(t *testing.T) {
+	if *dsn == "" {
+		t.Skip("set -postgres to run against database")
+	}
+	repotest.Run(t, newTestRepo)
+}
+
+func TestNotifyIgnoresClicks(t *testing.T) {
+	if *dsn == "" {
+		t.Skip("set -postgres to run against database")
+	}
+	repo := newTestRepo(t).(*Repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	evicted := make(chan string, 10)
+	connected := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = repo.listen(ctx, func(shortened string) { evicted <- shortened }, func() { close(connected) })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	<-connected
+
+	next := func() string {
+		select {
+		case shortened := <-evicted:
+			return shortened
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification")
+			return ""
+		}
+	}
+
+	_, err := repo.Store(ctx, domain.Link{OriginalURL: "https://google.com", ShortenedURL: "clicked"})
+	require.NoError(t, err)
+	require.Equal(t, "clicked", next())
+
+	require.NoError(t, repo.AddClicks(ctx, map[string]uint64{"clicked": 5}))
+	// Notifications come in commit order, so the next one is of the new link.
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "marker"})
+	require.NoError(t, err)
+	require.Equal(t, "marker", next())
+}
+
+func TestUnicodeHost(t *testing.T) {
+	if *dsn == "" {
+		t.Skip("set -postgres to run against database")
+	}
+	repo := newTestRepo(t).(*Repo)
+	ctx := context.Background()
+
+	require.ErrorIs(t, repo.StoreUnicodeHost(ctx, "abc", "пример.рф"), service.ErrNotFound)
+
+	_, err := repo.Store(ctx, domain.Link{OriginalURL: "https://xn--e1afmkfd.xn--p1ai", ShortenedURL: "abc"})
+	require.NoError(t, err)
+	_, err = repo.UnicodeHost(ctx, "abc")
+	require.ErrorIs(t, err, service.ErrNotFound)
+
+	require.NoError(t, repo.StoreUnicodeHost(ctx, "abc", "пример.рф"))
+	host, err := repo.UnicodeHost(ctx, "abc")
+	require.NoError(t, err)
+	require.Equal(t, "пример.рф", host)
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	require.True(t, isUniqueViolation(fmt.Errorf("insert link: %w", &pgconn.PgError{Code: "23505"})))
+	require.False(t, isUniqueViolation(&pgconn.PgError{Code: "23503"}))
+	require.False(t, isUniqueViolation(nil))
+}
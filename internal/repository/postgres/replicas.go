@@ -0,0 +1,295 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	defaultMaxReplicaLag        = time.Second
+	defaultReplicaCheckInterval = 5 * time.Second
+	defaultReadYourWrites       = 5 * time.Second
+)
+
+// replicaLagQuery returns replay lag in seconds, it's 0 if replica
+// replayed all received WAL, so idle primary doesn't make lag grow.
+// Replica which receives no WAL falls behind with zero lag, so it also returns
+// whether WAL receiver is streaming. Without pg_read_all_stats its status is NULL,
+// then running receiver is trusted.
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::float8, NOT pg_is_in_recovery() OR EXISTS (
+	SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming'
+)`
+
+// ReplicaConfig is read replica. It uses credentials, database, TLS and pool settings
+// of primary, but with DSN of primary it needs its own DSN.
+type ReplicaConfig struct {
+	DSN  string `yaml:"dsn"`
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+}
+
+type replica struct {
+	name    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+	// lag is replay lag in milliseconds, -1 if replica doesn't respond.
+	lag       atomic.Int64
+	streaming atomic.Bool
+	reads     atomic.Uint64
+}
+
+// router chooses pool for reads: healthy replica in round-robin,
+// or primary if there're none or if shortened URL was written recently.
+type router struct {
+	primary  *pgxpool.Pool
+	replicas []*replica
+	next     atomic.Uint64
+
+	maxLag        time.Duration
+	checkInterval time.Duration
+	recent        *recentWrites
+
+	primaryReads atomic.Uint64
+	fallbacks    atomic.Uint64
+	misses       atomic.Uint64
+}
+
+// pick returns healthy replica or nil, healthy ones get reads evenly.
+func (r *router) pick() *replica {
+	healthy := 0
+	for _, replica := range r.replicas {
+		if replica.healthy.Load() {
+			healthy++
+		}
+	}
+	if healthy == 0 {
+		return nil
+	}
+
+	k := int(r.next.Add(1) % uint64(healthy))
+	for _, replica := range r.replicas {
+		if !replica.healthy.Load() {
+			continue
+		}
+		if k == 0 {
+			return replica
+		}
+		k--
+	}
+	// Replica became unhealthy meanwhile.
+	return nil
+}
+
+// read runs fn on replica, and on primary if there's no healthy replica,
+// if key was written recently, or if replica fails or has no rows.
+// Link may be stored by other instance or before read_your_writes just now,
+// so replica miss isn't final. Empty key is not checked for recent writes.
+func (r *router) read(ctx context.Context, key string, fn func(pool *pgxpool.Pool) error) error {
+	var replica *replica
+	if key == "" || !r.recent.contains(key) {
+		replica = r.pick()
+	}
+
+	if replica != nil {
+		replica.reads.Add(1)
+		err := fn(replica.pool)
+		switch {
+		case err == nil || ctx.Err() != nil:
+			return err
+		case errors.Is(err, pgx.ErrNoRows):
+			r.misses.Add(1)
+		default:
+			// Replica is checked again by Run.
+			replica.healthy.Store(false)
+			r.fallbacks.Add(1)
+			slog.Warn("replica read failed, falling back to primary",
+				slog.String("replica", replica.name), slog.String("error", err.Error()))
+		}
+	}
+
+	r.primaryReads.Add(1)
+	return fn(r.primary)
+}
+
+// check updates health of all replicas.
+func (r *router) check(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, rep := range r.replicas {
+		wg.Add(1)
+		go func(rep *replica) {
+			defer wg.Done()
+			r.checkReplica(ctx, rep)
+		}(rep)
+	}
+	wg.Wait()
+}
+
+func (r *router) checkReplica(ctx context.Context, replica *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.checkInterval)
+	defer cancel()
+
+	var lagSeconds float64
+	var streaming bool
+	err := replica.pool.QueryRow(ctx, replicaLagQuery).Scan(&lagSeconds, &streaming)
+	if err != nil {
+		replica.lag.Store(-1)
+		replica.streaming.Store(false)
+		if replica.healthy.Swap(false) {
+			slog.Warn("replica is down", slog.String("replica", replica.name), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	replica.lag.Store(lag.Milliseconds())
+	replica.streaming.Store(streaming)
+
+	healthy := streaming && lag <= r.maxLag
+	if replica.healthy.Swap(healthy) != healthy {
+		slog.Info("replica health changed", slog.String("replica", replica.name),
+			slog.Bool("healthy", healthy), slog.Bool("streaming", streaming), slog.Duration("lag", lag))
+	}
+}
+
+// run checks replicas every checkInterval until ctx is done.
+func (r *router) run(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx)
+		}
+	}
+}
+
+func (r *router) metrics() *expvar.Map {
+	m := new(expvar.Map).Init()
+	m.Set("primary_reads", expvar.Func(func() any { return r.primaryReads.Load() }))
+	m.Set("replica_fallbacks", expvar.Func(func() any { return r.fallbacks.Load() }))
+	m.Set("replica_misses", expvar.Func(func() any { return r.misses.Load() }))
+	m.Set("replicas", expvar.Func(func() any {
+		replicas := make(map[string]any, len(r.replicas))
+		for _, replica := range r.replicas {
+			replicas[replica.name] = map[string]any{
+				"healthy":   replica.healthy.Load(),
+				"lag_ms":    replica.lag.Load(),
+				"streaming": replica.streaming.Load(),
+				"reads":     replica.reads.Load(),
+			}
+		}
+		return replicas
+	}))
+	return m
+}
+
+func (r *router) close() {
+	for _, replica := range r.replicas {
+		replica.pool.Close()
+	}
+}
+
+// recentWrites remembers keys written within window.
+type recentWrites struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	written map[string]time.Time
+	// pruned is time of the last removal of expired keys.
+	pruned time.Time
+}
+
+func newRecentWrites(window time.Duration) *recentWrites {
+	return &recentWrites{
+		window:  window,
+		now:     time.Now,
+		written: make(map[string]time.Time),
+	}
+}
+
+func (w *recentWrites) add(key string) {
+	if w.window <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	w.written[key] = now
+	if now.Sub(w.pruned) < w.window {
+		return
+	}
+	for key, written := range w.written {
+		if now.Sub(written) >= w.window {
+			delete(w.written, key)
+		}
+	}
+	w.pruned = now
+}
+
+func (w *recentWrites) contains(key string) bool {
+	if w.window <= 0 {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	written, ok := w.written[key]
+	return ok && w.now().Sub(written) < w.window
+}
+
+func newReplica(ctx context.Context, config Config, replicaConfig ReplicaConfig) (*replica, error) {
+	replicaDB := config
+	switch {
+	case replicaConfig.DSN != "":
+		replicaDB.DSN = replicaConfig.DSN
+	case config.DSN != "":
+		return nil, errors.New("replica must have dsn if primary has it")
+	default:
+		// Replica without port listens on port of primary.
+		replicaDB.Host = replicaConfig.Host
+		if replicaConfig.Port != 0 {
+			replicaDB.Port = replicaConfig.Port
+		}
+	}
+
+	pgxConfig, err := PoolConfig(replicaDB)
+	if err != nil {
+		return nil, fmt.Errorf("replica: %w", err)
+	}
+	name := fmt.Sprintf("%s:%d", pgxConfig.ConnConfig.Host, pgxConfig.ConnConfig.Port)
+
+	pool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
+	if err != nil {
+		return nil, fmt.Errorf("replica %s: %w", name, err)
+	}
+
+	r := &replica{
+		name: name,
+		pool: pool,
+	}
+	r.lag.Store(-1)
+	return r, nil
+}
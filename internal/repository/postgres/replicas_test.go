@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentWrites(t *testing.T) {
+	now := time.Now()
+	recent := newRecentWrites(5 * time.Second)
+	recent.now = func() time.Time { return now }
+
+	recent.add("abc")
+	require.True(t, recent.contains("abc"))
+	require.False(t, recent.contains("def"))
+
+	now = now.Add(4 * time.Second)
+	recent.add("def")
+	require.True(t, recent.contains("abc"))
+
+	now = now.Add(time.Second)
+	require.False(t, recent.contains("abc"))
+	require.True(t, recent.contains("def"))
+
+	// Expired keys are pruned once per window.
+	now = now.Add(5 * time.Second)
+	recent.add("ghi")
+	require.Len(t, recent.written, 1)
+}
+
+func TestRecentWritesDisabled(t *testing.T) {
+	recent := newRecentWrites(0)
+	recent.add("abc")
+	require.False(t, recent.contains("abc"))
+}
+
+func TestPickReplica(t *testing.T) {
+	replicas := []*replica{{name: "a"}, {name: "b"}, {name: "c"}}
+	r := &router{replicas: replicas}
+	require.Nil(t, r.pick())
+
+	replicas[0].healthy.Store(true)
+	replicas[2].healthy.Store(true)
+
+	picked := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		picked[r.pick().name]++
+	}
+	require.Equal(t, map[string]int{"a": 5, "c": 5}, picked)
+}
+
+func TestReadFallback(t *testing.T) {
+	primary := &pgxpool.Pool{}
+	rep := &replica{name: "a", pool: &pgxpool.Pool{}}
+	rep.healthy.Store(true)
+	r := &router{primary: primary, replicas: []*replica{rep}, recent: newRecentWrites(0)}
+
+	var pools []*pgxpool.Pool
+	read := func(replicaErr error) error {
+		pools = pools[:0]
+		return r.read(context.Background(), "abc", func(pool *pgxpool.Pool) error {
+			pools = append(pools, pool)
+			if pool == rep.pool {
+				return replicaErr
+			}
+			return nil
+		})
+	}
+
+	require.NoError(t, read(nil))
+	require.Equal(t, []*pgxpool.Pool{rep.pool}, pools)
+
+	// Link may be stored by other instance and not replicated yet.
+	require.NoError(t, read(pgx.ErrNoRows))
+	require.Equal(t, []*pgxpool.Pool{rep.pool, primary}, pools)
+	require.Equal(t, uint64(1), r.misses.Load())
+	require.True(t, rep.healthy.Load())
+
+	require.NoError(t, read(errors.New("connection refused")))
+	require.Equal(t, []*pgxpool.Pool{rep.pool, primary}, pools)
+	require.Equal(t, uint64(1), r.fallbacks.Load())
+	require.False(t, rep.healthy.Load())
+}
+
+func TestNewReplica(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Port = 6432
+
+	// Pool connects lazily, so replicas aren't reached.
+	r, err := newReplica(ctx, config, ReplicaConfig{Host: "replica"})
+	require.NoError(t, err)
+	r.pool.Close()
+	require.Equal(t, "replica:6432", r.name)
+
+	r, err = newReplica(ctx, config, ReplicaConfig{Host: "replica", Port: 5433})
+	require.NoError(t, err)
+	r.pool.Close()
+	require.Equal(t, "replica:5433", r.name)
+}
@@ -0,0 +1,220 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultConnectAttempts = 10
+	defaultRetries         = 2
+	defaultMinBackoff      = 100 * time.Millisecond
+	defaultMaxBackoff      = 5 * time.Second
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 10 * time.Second
+)
+
+// transientCodes are SQLSTATE codes of errors which may pass on retry.
+var transientCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// isTransient reports if err is caused by database or network state
+// and not by query, so query may succeed on retry.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 is connection exception.
+		return transientCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// backoff is exponential delay from min to max with jitter.
+type backoff struct {
+	min, max time.Duration
+}
+
+// delay returns delay before retry after attempt, it's from d/2 to d.
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.max
+	if attempt < 32 && b.min<<attempt < b.max {
+		d = b.min << attempt
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker opens after failures failed calls in a row and rejects calls for cooldown.
+// Then one probe call is let through: success closes breaker, failure opens it again.
+type breaker struct {
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failed   int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(failures int, cooldown time.Duration) *breaker {
+	return &breaker{
+		failures: failures,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+// allow reports if call may be done, done must be called after it.
+func (b *breaker) allow() bool {
+	if b.failures <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// done records result of allowed call, canceled calls don't change state.
+func (b *breaker) done(err error) {
+	if b.failures <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == breakerHalfOpen && b.probing
+	if probe {
+		b.probing = false
+	}
+
+	switch {
+	case isTransient(err):
+		b.failed++
+		if probe || b.state == breakerClosed && b.failed >= b.failures {
+			b.state = breakerOpen
+			b.openedAt = b.now()
+		}
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+	default:
+		b.failed = 0
+		if probe {
+			b.state = breakerClosed
+		}
+	}
+}
+
+func (b *breaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// call runs fn and retries it on transient errors. While breaker is open,
+// and if retries are exhausted, it returns service.ErrUnavailable.
+func (r *Repo) call(ctx context.Context, fn func() error) error {
+	if !r.breaker.allow() {
+		r.rejected.Add(1)
+		return fmt.Errorf("%w: postgres circuit breaker is open", service.ErrUnavailable)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if !isTransient(err) || attempt >= r.retries {
+			break
+		}
+		r.retried.Add(1)
+		if sleep(ctx, r.backoff.delay(attempt)) != nil {
+			break
+		}
+	}
+
+	r.breaker.done(err)
+	if isTransient(err) {
+		return fmt.Errorf("%w: %w", service.ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "no rows", err: pgx.ErrNoRows, want: false},
+		{name: "not found", err: service.ErrNotFound, want: false},
+		{name: "serialization failure", err: &pgconn.PgError{Code: "40001"}, want: true},
+		{name: "deadlock", err: &pgconn.PgError{Code: "40P01"}, want: true},
+		{name: "connection failure", err: &pgconn.PgError{Code: "08006"}, want: true},
+		{name: "admin shutdown", err: fmt.Errorf("query: %w", &pgconn.PgError{Code: "57P01"}), want: true},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}, want: false},
+		{name: "wrong password", err: &pgconn.PgError{Code: "28P01"}, want: false},
+		{name: "connection reset", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, want: true},
+		{name: "wrapped reset", err: fmt.Errorf("commit: %w", syscall.ECONNRESET), want: true},
+		{name: "unexpected EOF", err: io.ErrUnexpectedEOF, want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "deadline", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isTransient(tt.err))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := backoff{min: 100 * time.Millisecond, max: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		delay := b.delay(attempt)
+		require.GreaterOrEqual(t, delay, max/2)
+		require.LessOrEqual(t, delay, max)
+	}
+	// Large attempt doesn't overflow.
+	require.GreaterOrEqual(t, b.delay(100), time.Second/2)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(3, 10*time.Second)
+	b.now = func() time.Time { return now }
+	down := &pgconn.PgError{Code: "57P03"}
+
+	// Not transient errors don't open breaker.
+	for i := 0; i < 5; i++ {
+		require.True(t, b.allow())
+		b.done(pgx.ErrNoRows)
+	}
+
+	for i := 0; i < 3; i++ {
+		require.True(t, b.allow())
+		b.done(down)
+	}
+	require.Equal(t, breakerOpen, b.current())
+	require.False(t, b.allow())
+
+	// One probe after cooldown, its failure opens breaker again.
+	now = now.Add(10 * time.Second)
+	require.True(t, b.allow())
+	require.False(t, b.allow())
+	b.done(down)
+	require.Equal(t, breakerOpen, b.current())
+	require.False(t, b.allow())
+
+	// Canceled probe lets another one through.
+	now = now.Add(10 * time.Second)
+	require.True(t, b.allow())
+	b.done(context.Canceled)
+	require.True(t, b.allow())
+
+	b.done(nil)
+	require.Equal(t, breakerClosed, b.current())
+	require.True(t, b.allow())
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(0, time.Second)
+	for i := 0; i < 10; i++ {
+		require.True(t, b.allow())
+		b.done(io.ErrUnexpectedEOF)
+	}
+}
+
+func TestCall(t *testing.T) {
+	ctx := context.Background()
+	newRepo := func() *Repo {
+		return &Repo{
+			retries: 2,
+			backoff: backoff{min: time.Millisecond, max: time.Millisecond},
+			breaker: newBreaker(2, time.Hour),
+		}
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		r := newRepo()
+		calls := 0
+		err := r.call(ctx, func() error {
+			calls++
+			if calls < 3 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+		require.Equal(t, uint64(2), r.retried.Load())
+	})
+
+	t.Run("not transient", func(t *testing.T) {
+		r := newRepo()
+		calls := 0
+		err := r.call(ctx, func() error {
+			calls++
+			return service.ErrExist
+		})
+		require.ErrorIs(t, err, service.ErrExist)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		r := newRepo()
+		calls := 0
+		fail := func() error {
+			calls++
+			return io.ErrUnexpectedEOF
+		}
+
+		err := r.call(ctx, fail)
+		require.ErrorIs(t, err, service.ErrUnavailable)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		require.Equal(t, 3, calls)
+
+		err = r.call(ctx, fail)
+		require.ErrorIs(t, err, service.ErrUnavailable)
+
+		// Breaker is open, database is not queried.
+		err = r.call(ctx, fail)
+		require.True(t, errors.Is(err, service.ErrUnavailable))
+		require.Equal(t, 6, calls)
+		require.Equal(t, uint64(1), r.rejected.Load())
+	})
+}
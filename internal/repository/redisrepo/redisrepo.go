@@ -0,0 +1,354 @@
+// Package redisrepo implements repository.ShortenerRepo over RESP,
+// protocol of Redis and compatible stores.
+//
+// Link is two keys: prefix+"s:"+shortened keeps original URL and
+// prefix+"o:"+sha256(original) keeps shortened URL. Both are set by one
+// Lua script, so they are created together and expire together.
+//
+// Repo works with single server (or primary with replicas): redirects of Redis Cluster
+// aren't followed. Script touches two keys, so behind cluster proxy KeyPrefix must
+// have hash tag (e.g. "{shortener}:") to keep all keys in one slot.
+package redisrepo
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository/redisrepo/resp"
+	"github.com/amanakin/shortener/internal/service"
+)
+
+const (
+	defaultAddr      = "localhost:6379"
+	defaultKeyPrefix = "shortener:"
+	defaultPoolSize  = 10
+	defaultTimeout   = 3 * time.Second
+)
+
+// StoreScript sets both keys of link unless original or shortened URL exists.
+// KEYS are original and shortened keys, ARGV are original URL, shortened URL
+// and TTL in milliseconds (0 for no expiration).
+// It returns shortened URL of original, or nil if shortened URL exists.
+const StoreScript = `
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return existing
+end
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return false
+end
+if ARGV[3] == '0' then
+	redis.call('SET', KEYS[2], ARGV[1])
+	redis.call('SET', KEYS[1], ARGV[2])
+else
+	redis.call('SET', KEYS[2], ARGV[1], 'PX', ARGV[3])
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+end
+return ARGV[2]
+`
+
+// idRangeKey is counter used by counter generator.
+const idRangeKey = "id_range"
+
+type Config struct {
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	// KeyPrefix is prepended to all keys, so store can be shared.
+	// Behind cluster proxy it must have hash tag, e.g. "{shortener}:".
+	KeyPrefix string `yaml:"key_prefix"`
+	// TTL is lifetime of links, zero keeps them forever.
+	TTL time.Duration `yaml:"ttl"`
+	// PoolSize is max number of idle connections.
+	PoolSize int `yaml:"pool_size"`
+	// Timeout limits dial and every command, if ctx has no earlier deadline.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:      defaultAddr,
+		KeyPrefix: defaultKeyPrefix,
+		PoolSize:  defaultPoolSize,
+		Timeout:   defaultTimeout,
+	}
+}
+
+type Repo struct {
+	config    Config
+	storeSHA  string
+	idleConns chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// New connects to store and checks connection.
+func New(ctx context.Context, config Config) (*Repo, error) {
+	if config.TTL < 0 {
+		return nil, errors.New("ttl must not be negative")
+	}
+	if config.TTL > 0 && config.TTL < time.Millisecond {
+		return nil, errors.New("ttl must be at least 1ms")
+	}
+	if config.PoolSize < 1 {
+		config.PoolSize = 1
+	}
+
+	sha := sha1.Sum([]byte(StoreScript))
+	r := &Repo{
+		config:    config,
+		storeSHA:  hex.EncodeToString(sha[:]),
+		idleConns: make(chan *conn, config.PoolSize),
+	}
+
+	if err := r.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Ping checks that server is reachable.
+func (r *Repo) Ping(ctx context.Context) error {
+	reply, err := r.do(ctx, "PING")
+	if err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	if reply != resp.Status("PONG") {
+		return fmt.Errorf("ping: unexpected reply %v", reply)
+	}
+	return nil
+}
+
+func (r *Repo) shortenedKey(shortened string) string {
+	return r.config.KeyPrefix + "s:" + shortened
+}
+
+// originalKey uses hash, so key length doesn't depend on URL length.
+func (r *Repo) originalKey(original string) string {
+	hash := sha256.Sum256([]byte(original))
+	return r.config.KeyPrefix + "o:" + hex.EncodeToString(hash[:])
+}
+
+// LinkTTL returns lifetime of links, zero if they don't expire.
+func (r *Repo) LinkTTL() time.Duration {
+	return r.config.TTL
+}
+
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	keys := []string{r.originalKey(link.OriginalURL), r.shortenedKey(link.ShortenedURL)}
+	args := []string{link.OriginalURL, link.ShortenedURL, strconv.FormatInt(r.config.TTL.Milliseconds(), 10)}
+
+	reply, err := r.eval(ctx, keys, args)
+	var respErr resp.Error
+	if errors.As(err, &respErr) && respErr.Prefix() == "CROSSSLOT" {
+		return link, fmt.Errorf("store script: key prefix %q must have hash tag: %w", r.config.KeyPrefix, err)
+	}
+	if err != nil {
+		return link, fmt.Errorf("store script: %w", err)
+	}
+
+	switch reply := reply.(type) {
+	case nil:
+		return link, service.ErrExist
+	case string:
+		link.ShortenedURL = reply
+		return link, nil
+	default:
+		return link, fmt.Errorf("store script: unexpected reply %v", reply)
+	}
+}
+
+// eval runs StoreScript by SHA and loads it on the first call on every server.
+func (r *Repo) eval(ctx context.Context, keys, args []string) (any, error) {
+	cmd := make([]string, 0, 3+len(keys)+len(args))
+	cmd = append(cmd, "EVALSHA", r.storeSHA, strconv.Itoa(len(keys)))
+	cmd = append(cmd, keys...)
+	cmd = append(cmd, args...)
+
+	reply, err := r.do(ctx, cmd...)
+	var respErr resp.Error
+	if errors.As(err, &respErr) && respErr.Prefix() == "NOSCRIPT" {
+		cmd[0], cmd[1] = "EVAL", StoreScript
+		reply, err = r.do(ctx, cmd...)
+	}
+	return reply, err
+}
+
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	reply, err := r.do(ctx, "GET", r.shortenedKey(shortened))
+	if err != nil {
+		return "", fmt.Errorf("get: %w", err)
+	}
+
+	switch reply := reply.(type) {
+	case nil:
+		return "", service.ErrNotFound
+	case string:
+		return reply, nil
+	default:
+		return "", fmt.Errorf("get: unexpected reply %v", reply)
+	}
+}
+
+// AllocateRange leases IDs from counter in store, it is safe for concurrent replicas.
+func (r *Repo) AllocateRange(ctx context.Context, size uint64) (uint64, error) {
+	reply, err := r.do(ctx, "INCRBY", r.config.KeyPrefix+idRangeKey, strconv.FormatUint(size, 10))
+	if err != nil {
+		return 0, fmt.Errorf("allocate id range: %w", err)
+	}
+	end, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("allocate id range: unexpected reply %v", reply)
+	}
+	return uint64(end) - size, nil
+}
+
+// do sends command and reads reply, error reply is returned as resp.Error.
+func (r *Repo) do(ctx context.Context, args ...string) (any, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(r.deadline(ctx), args...)
+	if err != nil {
+		// State of connection is unknown after I/O error.
+		c.Close()
+		return nil, err
+	}
+	r.put(c)
+
+	if respErr, ok := reply.(resp.Error); ok {
+		return nil, respErr
+	}
+	return reply, nil
+}
+
+func (r *Repo) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(r.config.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+func (c *conn) do(deadline time.Time, args ...string) (any, error) {
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := resp.WriteCommand(c.w, args...); err != nil {
+		return nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return resp.Read(c.r)
+}
+
+// conn takes idle connection or dials new one.
+func (r *Repo) conn(ctx context.Context) (*conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case c := <-r.idleConns:
+		return c, nil
+	default:
+	}
+
+	dialer := net.Dialer{Deadline: r.deadline(ctx)}
+	netConn, err := dialer.DialContext(ctx, "tcp", r.config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+	c := &conn{
+		Conn: netConn,
+		r:    bufio.NewReader(netConn),
+		w:    bufio.NewWriter(netConn),
+	}
+
+	if err = r.handshake(ctx, c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// handshake authenticates and selects database.
+func (r *Repo) handshake(ctx context.Context, c *conn) error {
+	var commands [][]string
+	if r.config.Password != "" {
+		if r.config.Username != "" {
+			commands = append(commands, []string{"AUTH", r.config.Username, r.config.Password})
+		} else {
+			commands = append(commands, []string{"AUTH", r.config.Password})
+		}
+	}
+	if r.config.DB != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(r.config.DB)})
+	}
+
+	for _, args := range commands {
+		reply, err := c.do(r.deadline(ctx), args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		if respErr, ok := reply.(resp.Error); ok {
+			return fmt.Errorf("%s: %w", args[0], respErr)
+		}
+	}
+	return nil
+}
+
+// put returns connection to idle ones, it's closed if there're enough of them.
+func (r *Repo) put(c *conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		c.Close()
+		return
+	}
+	select {
+	case r.idleConns <- c:
+	default:
+		c.Close()
+	}
+}
+
+// Shared implements repository.Shared, replicas store links to the same Redis.
+func (r *Repo) Shared() {}
+
+func (r *Repo) Close(_ context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	for {
+		select {
+		case c := <-r.idleConns:
+			c.Close()
+		default:
+			return
+		}
+	}
+}
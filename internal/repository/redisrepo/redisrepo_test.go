@@ -0,0 +1,282 @@
+package redisrepo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/redisrepo/redistest"
+	"github.com/amanakin/shortener/internal/repository/redisrepo/resp"
+	"github.com/amanakin/shortener/internal/repository/repotest"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+// addr is Redis for tests of StoreScript on real server, see make test-redis.
+var addr = flag.String("redis", "", "Address of Redis for tests on real server, they are skipped if it's empty")
+
+// storeScript emulates StoreScript.
+func storeScript(db *redistest.DB, keys, args []string) any {
+	if existing, ok := db.Get(keys[0]); ok {
+		return existing
+	}
+	if db.Exists(keys[1]) {
+		return nil
+	}
+
+	ttl, _ := strconv.ParseInt(args[2], 10, 64)
+	db.Set(keys[1], args[0], time.Duration(ttl)*time.Millisecond)
+	db.Set(keys[0], args[1], time.Duration(ttl)*time.Millisecond)
+	return args[1]
+}
+
+func newServer(t *testing.T) *redistest.Server {
+	t.Helper()
+
+	srv := redistest.NewServer()
+	srv.RegisterScript(StoreScript, storeScript)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newRepo(t *testing.T, config Config) *Repo {
+	t.Helper()
+
+	repo, err := New(context.Background(), config)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close(context.Background()) })
+	return repo
+}
+
+func testConfig(srv *redistest.Server) Config {
+	config := DefaultConfig()
+	config.Addr = srv.Addr()
+	return config
+}
+
+func TestConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.ShortenerRepo {
+		return newRepo(t, testConfig(newServer(t)))
+	})
+}
+
+func TestRedisRepo(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t, testConfig(newServer(t)))
+
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	stored, err := repo.Store(ctx, link)
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+
+	stored, err = repo.Store(ctx, domain.Link{OriginalURL: link.OriginalURL, ShortenedURL: "def"})
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: link.ShortenedURL})
+	require.ErrorIs(t, err, service.ErrExist)
+
+	original, err := repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+
+	_, err = repo.Get(ctx, "def")
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestTTL(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t)
+	config := testConfig(srv)
+	config.TTL = time.Hour
+	repo := newRepo(t, config)
+
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	_, err := repo.Store(ctx, link)
+	require.NoError(t, err)
+	require.Equal(t, 2, srv.Keys())
+
+	srv.FastForward(time.Hour - time.Millisecond)
+	_, err = repo.Get(ctx, link.ShortenedURL)
+	require.NoError(t, err)
+
+	srv.FastForward(time.Millisecond)
+	_, err = repo.Get(ctx, link.ShortenedURL)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	require.Equal(t, 0, srv.Keys())
+
+	// Expired original gets new short link.
+	link.ShortenedURL = "def"
+	stored, err := repo.Store(ctx, link)
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+}
+
+func TestScriptReload(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t)
+	repo := newRepo(t, testConfig(srv))
+
+	_, err := repo.Store(ctx, domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"})
+	require.NoError(t, err)
+
+	// Restarted server doesn't know script, it's sent again.
+	srv.FlushScripts()
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"})
+	require.NoError(t, err)
+}
+
+func TestConcurrentStore(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t, testConfig(newServer(t)))
+
+	const workers = 20
+	results := make([]string, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stored, err := repo.Store(ctx, domain.Link{
+				OriginalURL:  "https://google.com",
+				ShortenedURL: strconv.Itoa(i),
+			})
+			require.NoError(t, err)
+			results[i] = stored.ShortenedURL
+		}(i)
+	}
+	wg.Wait()
+
+	for _, shortened := range results {
+		require.Equal(t, results[0], shortened)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv := newServer(t)
+	srv.SetPassword("secret")
+
+	config := testConfig(srv)
+	_, err := New(context.Background(), config)
+	require.ErrorContains(t, err, "NOAUTH")
+
+	config.Password = "wrong"
+	_, err = New(context.Background(), config)
+	require.ErrorContains(t, err, "WRONGPASS")
+
+	config.Password = "secret"
+	config.DB = 1
+	newRepo(t, config)
+}
+
+func TestAllocateRange(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepo(t, testConfig(newServer(t)))
+
+	start, err := repo.AllocateRange(ctx, 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), start)
+
+	start, err = repo.AllocateRange(ctx, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), start)
+}
+
+func TestServerClosed(t *testing.T) {
+	srv := newServer(t)
+	repo := newRepo(t, testConfig(srv))
+	srv.Close()
+
+	_, err := repo.Get(context.Background(), "abc")
+	require.Error(t, err)
+}
+
+func TestCrossSlot(t *testing.T) {
+	srv := redistest.NewServer()
+	srv.RegisterScript(StoreScript, func(*redistest.DB, []string, []string) any {
+		return resp.Error("CROSSSLOT Keys in request don't hash to the same slot")
+	})
+	t.Cleanup(srv.Close)
+	repo := newRepo(t, testConfig(srv))
+
+	_, err := repo.Store(context.Background(), domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"})
+	require.ErrorContains(t, err, "hash tag")
+}
+
+// newRealRepo connects to -redis server with unique key prefix, its keys are deleted after test.
+func newRealRepo(t *testing.T, ttl time.Duration) *Repo {
+	t.Helper()
+	if *addr == "" {
+		t.Skip("-redis is not set")
+	}
+
+	suffix := make([]byte, 8)
+	_, err := rand.Read(suffix)
+	require.NoError(t, err)
+
+	config := DefaultConfig()
+	config.Addr = *addr
+	config.KeyPrefix = "{repotest_" + hex.EncodeToString(suffix) + "}:"
+	config.TTL = ttl
+	repo := newRepo(t, config)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		reply, err := repo.do(ctx, "KEYS", config.KeyPrefix+"*")
+		require.NoError(t, err)
+		keys, _ := reply.([]any)
+		for _, key := range keys {
+			_, err = repo.do(ctx, "DEL", key.(string))
+			require.NoError(t, err)
+		}
+	})
+	return repo
+}
+
+func TestRealConformance(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.ShortenerRepo {
+		return newRealRepo(t, 0)
+	})
+}
+
+// TestRealStoreScript runs Lua of StoreScript, which redistest only emulates.
+func TestRealStoreScript(t *testing.T) {
+	ctx := context.Background()
+	repo := newRealRepo(t, time.Second)
+
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	stored, err := repo.Store(ctx, link)
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+
+	stored, err = repo.Store(ctx, domain.Link{OriginalURL: link.OriginalURL, ShortenedURL: "def"})
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: link.ShortenedURL})
+	require.ErrorIs(t, err, service.ErrExist)
+
+	// Server forgets scripts on restart, EVALSHA is retried with EVAL.
+	_, err = repo.do(ctx, "SCRIPT", "FLUSH")
+	require.NoError(t, err)
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "ghi"})
+	require.NoError(t, err)
+
+	// Both keys expire together.
+	require.Eventually(t, func() bool {
+		_, err := repo.Get(ctx, link.ShortenedURL)
+		return errors.Is(err, service.ErrNotFound)
+	}, 3*time.Second, 50*time.Millisecond)
+	link.ShortenedURL = "jkl"
+	stored, err = repo.Store(ctx, link)
+	require.NoError(t, err)
+	require.Equal(t, link, stored)
+}
@@ -0,0 +1,438 @@
+// Package redistest provides in-process RESP server for tests,
+// which stands in for Redis with small subset of its commands.
+//
+// Lua is not interpreted: scripts are emulated by Go functions
+// registered with Server.RegisterScript.
+package redistest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amanakin/shortener/internal/repository/redisrepo/resp"
+)
+
+// ScriptFunc emulates Lua script, it runs atomically like in Redis.
+// Result is RESP value (see resp package), nil is Lua false.
+type ScriptFunc func(db *DB, keys, args []string) any
+
+// Server serves RESP on localhost until Close.
+// Its clock stands still and is moved only by FastForward, so expiration is deterministic.
+type Server struct {
+	lsn net.Listener
+	wg  sync.WaitGroup
+
+	mu       sync.Mutex
+	db       DB
+	scripts  map[string]ScriptFunc
+	loaded   map[string]bool
+	password string
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// DB is keyspace of Server, available to scripts.
+type DB struct {
+	values  map[string]string
+	expires map[string]time.Time
+	now     time.Time
+}
+
+// NewServer starts server on random port, it panics if it can't listen.
+func NewServer() *Server {
+	lsn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("redistest: listen: %v", err))
+	}
+
+	s := &Server{
+		lsn: lsn,
+		db: DB{
+			values:  make(map[string]string),
+			expires: make(map[string]time.Time),
+			now:     time.Now(),
+		},
+		scripts: make(map[string]ScriptFunc),
+		loaded:  make(map[string]bool),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns host:port of server.
+func (s *Server) Addr() string {
+	return s.lsn.Addr().String()
+}
+
+// SetPassword makes server require AUTH with password.
+func (s *Server) SetPassword(password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = password
+}
+
+// RegisterScript makes script known to EVAL. Like in Redis, EVALSHA
+// of script works only after it was sent by EVAL or SCRIPT LOAD.
+func (s *Server) RegisterScript(script string, fn ScriptFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[sha1Hex(script)] = fn
+}
+
+// FlushScripts forgets scripts sent by EVAL and SCRIPT LOAD, like server restart.
+func (s *Server) FlushScripts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = make(map[string]bool)
+}
+
+// FastForward moves clock of keys expiration.
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.db.now = s.db.now.Add(d)
+}
+
+// Keys returns number of not expired keys.
+func (s *Server) Keys() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for key := range s.db.values {
+		if _, ok := s.db.Get(key); ok {
+			count++
+		}
+	}
+	return count
+}
+
+// Close stops server and closes all connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.lsn.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.lsn.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	authorized := false
+
+	for {
+		value, err := resp.Read(r)
+		if err != nil {
+			return
+		}
+		args, err := commandArgs(value)
+
+		var reply any
+		if err != nil {
+			reply = resp.Error("ERR " + err.Error())
+		} else {
+			reply = s.exec(args, &authorized)
+		}
+
+		if err = resp.Write(w, reply); err != nil {
+			return
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func commandArgs(value any) ([]string, error) {
+	array, ok := value.([]any)
+	if !ok || len(array) == 0 {
+		return nil, errors.New("command must be non-empty array")
+	}
+
+	args := make([]string, len(array))
+	for i, item := range array {
+		if args[i], ok = item.(string); !ok {
+			return nil, errors.New("command must be array of bulk strings")
+		}
+	}
+	return args, nil
+}
+
+// exec runs command atomically.
+func (s *Server) exec(args []string, authorized *bool) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+
+	if name == "AUTH" {
+		if len(args) < 1 || len(args) > 2 {
+			return wrongArgs(name)
+		}
+		if s.password == "" || args[len(args)-1] != s.password {
+			return resp.Error("WRONGPASS invalid username-password pair or user is disabled.")
+		}
+		*authorized = true
+		return resp.Status("OK")
+	}
+	if s.password != "" && !*authorized {
+		return resp.Error("NOAUTH Authentication required.")
+	}
+
+	switch name {
+	case "PING":
+		return resp.Status("PONG")
+	case "SELECT":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		if db, err := strconv.Atoi(args[0]); err != nil || db < 0 || db > 15 {
+			return resp.Error("ERR DB index is out of range")
+		}
+		return resp.Status("OK")
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		if value, ok := s.db.Get(args[0]); ok {
+			return value
+		}
+		return nil
+	case "SET":
+		return s.set(args)
+	case "EXISTS":
+		if len(args) < 1 {
+			return wrongArgs(name)
+		}
+		count := 0
+		for _, key := range args {
+			if s.db.Exists(key) {
+				count++
+			}
+		}
+		return count
+	case "DEL":
+		if len(args) < 1 {
+			return wrongArgs(name)
+		}
+		count := 0
+		for _, key := range args {
+			if s.db.Del(key) {
+				count++
+			}
+		}
+		return count
+	case "PTTL":
+		if len(args) != 1 {
+			return wrongArgs(name)
+		}
+		return s.db.PTTL(args[0])
+	case "INCRBY":
+		if len(args) != 2 {
+			return wrongArgs(name)
+		}
+		return s.incrBy(args[0], args[1])
+	case "EVAL", "EVALSHA":
+		return s.eval(name, args)
+	case "SCRIPT":
+		if len(args) != 2 || strings.ToUpper(args[0]) != "LOAD" {
+			return resp.Error("ERR unknown subcommand of SCRIPT")
+		}
+		sha := sha1Hex(args[1])
+		if _, ok := s.scripts[sha]; !ok {
+			return resp.Error("ERR script is not registered in redistest")
+		}
+		s.loaded[sha] = true
+		return sha
+	default:
+		return resp.Error(fmt.Sprintf("ERR unknown command '%s'", name))
+	}
+}
+
+func wrongArgs(name string) resp.Error {
+	return resp.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// set supports NX, XX, PX and EX options.
+func (s *Server) set(args []string) any {
+	if len(args) < 2 {
+		return wrongArgs("SET")
+	}
+	key, value := args[0], args[1]
+
+	var nx, xx bool
+	var ttl time.Duration
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "PX", "EX":
+			if i+1 == len(args) {
+				return resp.Error("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return resp.Error("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if strings.ToUpper(args[i]) == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+			i++
+		default:
+			return resp.Error("ERR syntax error")
+		}
+	}
+
+	exists := s.db.Exists(key)
+	if nx && exists || xx && !exists {
+		return nil
+	}
+	s.db.Set(key, value, ttl)
+	return resp.Status("OK")
+}
+
+func (s *Server) incrBy(key, by string) any {
+	n, err := strconv.ParseInt(by, 10, 64)
+	if err != nil {
+		return resp.Error("ERR value is not an integer or out of range")
+	}
+
+	var current int64
+	if value, ok := s.db.Get(key); ok {
+		if current, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return resp.Error("ERR value is not an integer or out of range")
+		}
+	}
+	current += n
+
+	ttl := s.db.PTTL(key)
+	s.db.Set(key, strconv.FormatInt(current, 10), 0)
+	if ttl > 0 {
+		s.db.expires[key] = s.db.now.Add(time.Duration(ttl) * time.Millisecond)
+	}
+	return current
+}
+
+func (s *Server) eval(name string, args []string) any {
+	if len(args) < 2 {
+		return wrongArgs(name)
+	}
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+		return resp.Error("ERR Number of keys can't be greater than number of args")
+	}
+
+	sha := args[0]
+	if name == "EVAL" {
+		sha = sha1Hex(args[0])
+	}
+	fn, ok := s.scripts[sha]
+	if !ok {
+		return resp.Error("ERR script is not registered in redistest")
+	}
+	if name == "EVALSHA" && !s.loaded[sha] {
+		return resp.Error("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	s.loaded[sha] = true
+
+	keys := args[2 : 2+numKeys]
+	return fn(&s.db, keys, args[2+numKeys:])
+}
+
+func sha1Hex(script string) string {
+	sha := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sha[:])
+}
+
+// Get returns value of not expired key.
+func (db *DB) Get(key string) (string, bool) {
+	if expire, ok := db.expires[key]; ok && !db.now.Before(expire) {
+		delete(db.values, key)
+		delete(db.expires, key)
+	}
+	value, ok := db.values[key]
+	return value, ok
+}
+
+func (db *DB) Exists(key string) bool {
+	_, ok := db.Get(key)
+	return ok
+}
+
+// Set sets value, zero ttl keeps key forever.
+func (db *DB) Set(key, value string, ttl time.Duration) {
+	db.values[key] = value
+	delete(db.expires, key)
+	if ttl > 0 {
+		db.expires[key] = db.now.Add(ttl)
+	}
+}
+
+func (db *DB) Del(key string) bool {
+	exists := db.Exists(key)
+	delete(db.values, key)
+	delete(db.expires, key)
+	return exists
+}
+
+// PTTL returns milliseconds to expiration, -1 for key without TTL and -2 for missing key.
+func (db *DB) PTTL(key string) int64 {
+	if !db.Exists(key) {
+		return -2
+	}
+	expire, ok := db.expires[key]
+	if !ok {
+		return -1
+	}
+	return expire.Sub(db.now).Milliseconds()
+}
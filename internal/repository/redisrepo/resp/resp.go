@@ -0,0 +1,175 @@
+// Package resp implements RESP2, protocol of Redis and compatible stores.
+//
+// Values are mapped to Go types: simple string is Status, bulk string is string,
+// null bulk string and null array are nil, integer is int64, array is []any,
+// error reply is Error.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// MaxBulkLen is max length of bulk string, the same as in Redis.
+const MaxBulkLen = 512 * 1024 * 1024
+
+// maxArrayLen limits arrays read from peer, replies of repository are short.
+const maxArrayLen = 1024 * 1024
+
+// Status is simple string reply, e.g. "OK".
+type Status string
+
+// Error is error reply, e.g. "NOSCRIPT No matching script".
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Prefix returns error code, first word of error.
+func (e Error) Prefix() string {
+	for i := 0; i < len(e); i++ {
+		if e[i] == ' ' {
+			return string(e[:i])
+		}
+	}
+	return string(e)
+}
+
+var ErrProtocol = errors.New("resp: protocol error")
+
+// WriteCommand writes command as array of bulk strings, w is not flushed.
+func WriteCommand(w *bufio.Writer, args ...string) error {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(len(args)))
+	w.WriteString("\r\n")
+	for _, arg := range args {
+		writeBulk(w, arg)
+	}
+	// bufio.Writer keeps the first error.
+	_, err := w.Write(nil)
+	return err
+}
+
+// Write writes v, w is not flushed.
+func Write(w *bufio.Writer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case Status:
+		w.WriteByte('+')
+		w.WriteString(string(v))
+		w.WriteString("\r\n")
+	case Error:
+		w.WriteByte('-')
+		w.WriteString(string(v))
+		w.WriteString("\r\n")
+	case string:
+		writeBulk(w, v)
+	case int64:
+		w.WriteByte(':')
+		w.WriteString(strconv.FormatInt(v, 10))
+		w.WriteString("\r\n")
+	case int:
+		return Write(w, int64(v))
+	case []any:
+		w.WriteByte('*')
+		w.WriteString(strconv.Itoa(len(v)))
+		w.WriteString("\r\n")
+		for _, item := range v {
+			if err := Write(w, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("resp: unsupported type %T", v)
+	}
+	_, err := w.Write(nil)
+	return err
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	w.WriteByte('$')
+	w.WriteString(strconv.Itoa(len(s)))
+	w.WriteString("\r\n")
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// Read reads one value. Error reply is returned as value, not as error.
+func Read(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w: empty line", ErrProtocol)
+	}
+
+	switch line[0] {
+	case '+':
+		return Status(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: integer: %s", ErrProtocol, err)
+		}
+		return n, nil
+	case '$':
+		n, err := readLen(line, MaxBulkLen)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, fmt.Errorf("%w: bulk string is not terminated", ErrProtocol)
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := readLen(line, maxArrayLen)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		array := make([]any, n)
+		for i := range array {
+			if array[i], err = Read(r); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrProtocol, line[0])
+	}
+}
+
+// readLen parses length of bulk string or array, -1 is null.
+func readLen(line []byte, max int) (int, error) {
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < -1 || n > max {
+		return 0, fmt.Errorf("%w: length %q", ErrProtocol, line[1:])
+	}
+	return n, nil
+}
+
+// readLine reads line without CRLF.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: line is too long", ErrProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: line is not terminated by CRLF", ErrProtocol)
+	}
+	return line[:len(line)-2], nil
+}
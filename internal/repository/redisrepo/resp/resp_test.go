@@ -0,0 +1,74 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{name: "null", value: nil},
+		{name: "status", value: Status("OK")},
+		{name: "error", value: Error("ERR wrong")},
+		{name: "bulk", value: "hello\r\nworld"},
+		{name: "empty bulk", value: ""},
+		{name: "integer", value: int64(-42)},
+		{name: "array", value: []any{"a", int64(1), nil, []any{Status("OK")}}},
+		{name: "empty array", value: []any{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := bufio.NewWriter(&buf)
+			require.NoError(t, Write(w, tt.value))
+			require.NoError(t, w.Flush())
+
+			value, err := Read(bufio.NewReader(&buf))
+			require.NoError(t, err)
+			require.Equal(t, tt.value, value)
+		})
+	}
+}
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	require.NoError(t, WriteCommand(w, "SET", "key", "value"))
+	require.NoError(t, w.Flush())
+
+	require.Equal(t, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n", buf.String())
+}
+
+func TestReadInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "unknown type", input: "!1\r\n"},
+		{name: "no CR", input: "+OK\n"},
+		{name: "bad integer", input: ":x\r\n"},
+		{name: "negative length", input: "$-2\r\n"},
+		{name: "unterminated bulk", input: "$2\r\nabcd"},
+		{name: "empty line", input: "\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+			require.ErrorIs(t, err, ErrProtocol)
+		})
+	}
+}
+
+func TestErrorPrefix(t *testing.T) {
+	require.Equal(t, "NOSCRIPT", Error("NOSCRIPT No matching script").Prefix())
+	require.Equal(t, "ERR", Error("ERR").Prefix())
+}
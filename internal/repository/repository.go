@@ -10,10 +10,59 @@ type ShortenerRepo interface {
 	// Store saves link in repository if there's no such link.
 	// If original URL already exists, it must return it.
 	// If shortened URL already exists, it must return service.ErrExist.
-	// Above rules must be followed in specified order.
+	// Above rules must be followed in specified order, also by concurrent calls.
+	// If ctx is done, it must return error matching ctx.Err() and not store link.
 	Store(ctx context.Context, link domain.Link) (domain.Link, error)
 	// Get gets original URL from shortened.
 	// If shortened URL is not found It must return service.ErrNotFound.
+	// If ctx is done, it must return error matching ctx.Err().
 	Get(ctx context.Context, shortened string) (string, error)
+	// Close releases resources, it must not block if ctx is done and may be called again.
+	// See repotest package for conformance tests.
 	Close(ctx context.Context)
 }
+
+// UnicodeHosts is implemented by repositories which keep Unicode form of IDN host of links,
+// original URLs keep ASCII (punycode) form.
+type UnicodeHosts interface {
+	// StoreUnicodeHost keeps host for link with shortened URL.
+	StoreUnicodeHost(ctx context.Context, shortened, host string) error
+	// UnicodeHost returns host kept for link, service.ErrNotFound if there's none.
+	UnicodeHost(ctx context.Context, shortened string) (string, error)
+}
+
+// Wrapper is implemented by repositories which decorate another one (cache, etc.).
+type Wrapper interface {
+	Unwrap() ShortenerRepo
+}
+
+// Notifier is implemented by repositories shared by replicas, which publish changes of links.
+type Notifier interface {
+	// Listen calls evict with changed shortened URLs until ctx is done,
+	// flush is called when changes may have been missed.
+	Listen(ctx context.Context, evict func(shortened string), flush func())
+}
+
+// Shared is implemented by repositories which replicas share,
+// so links may be stored by other processes.
+type Shared interface {
+	Shared()
+}
+
+// As finds first repository in chain of wrappers which implements T,
+// so extra interfaces of decorated repository stay available.
+func As[T any](repo ShortenerRepo) (T, bool) {
+	for repo != nil {
+		if target, ok := repo.(T); ok {
+			return target, true
+		}
+		wrapper, ok := repo.(Wrapper)
+		if !ok {
+			break
+		}
+		repo = wrapper.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,43 @@
+package repotest
+
+import (
+	"context"
+
+	"github.com/amanakin/shortener/internal/repository"
+)
+
+// NotifyingRepo implements repository.Notifier for tests of decorators,
+// it sends changes from channels to listener.
+type NotifyingRepo struct {
+	repository.ShortenerRepo
+	Changes chan string
+	Flushes chan struct{}
+}
+
+// NewNotifyingRepo wraps repo, its extra interfaces are found by repository.As.
+func NewNotifyingRepo(repo repository.ShortenerRepo) *NotifyingRepo {
+	return &NotifyingRepo{
+		ShortenerRepo: repo,
+		Changes:       make(chan string),
+		Flushes:       make(chan struct{}),
+	}
+}
+
+// Unwrap implements repository.Wrapper.
+func (r *NotifyingRepo) Unwrap() repository.ShortenerRepo {
+	return r.ShortenerRepo
+}
+
+// Listen implements repository.Notifier.
+func (r *NotifyingRepo) Listen(ctx context.Context, evict func(shortened string), flush func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case shortened := <-r.Changes:
+			evict(shortened)
+		case <-r.Flushes:
+			flush()
+		}
+	}
+}
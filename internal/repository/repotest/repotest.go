@@ -0,0 +1,330 @@
+// Package repotest checks that implementations of repository.ShortenerRepo follow its documented behavior.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// workers is number of goroutines in concurrent tests.
+	workers = 16
+	// MaxShortenedLen is the longest shortened URL repositories must keep.
+	MaxShortenedLen = 255
+	// LargeOriginalLen is length of original URL repositories must keep.
+	LargeOriginalLen = 64 << 10
+)
+
+// Factory returns new empty repository. Run closes it after test,
+// so Factory may register cleanup of its storage with t.Cleanup.
+type Factory func(t *testing.T) repository.ShortenerRepo
+
+// Run runs conformance tests, every one gets repository from newRepo.
+func Run(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.ShortenerRepo)
+	}{
+		{name: "store new link", fn: testStore},
+		{name: "store existing original returns stored link", fn: testStoreOriginalExists},
+		{name: "store existing shortened returns ErrExist", fn: testStoreShortenedExists},
+		{name: "existing original is checked before shortened", fn: testDedupOrder},
+		{name: "store same link again", fn: testStoreTwice},
+		{name: "get unknown returns ErrNotFound", fn: testGetNotFound},
+		{name: "values are kept exactly", fn: testExactValues},
+		{name: "large values", fn: testLargeValues},
+		{name: "concurrent stores of same original", fn: testConcurrentOriginal},
+		{name: "concurrent stores of same shortened", fn: testConcurrentShortened},
+		{name: "concurrent stores keep dedup order", fn: testConcurrentDedupOrder},
+		{name: "concurrent stores and gets", fn: testConcurrentStoreGet},
+		{name: "canceled context", fn: testCanceled},
+		{name: "expired context", fn: testDeadline},
+		{name: "close", fn: testClose},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newRepo(t)
+			t.Cleanup(func() { repo.Close(context.Background()) })
+			tt.fn(t, repo)
+		})
+	}
+}
+
+func requireStore(t *testing.T, repo repository.ShortenerRepo, link, expected domain.Link) {
+	t.Helper()
+
+	stored, err := repo.Store(context.Background(), link)
+	require.NoError(t, err)
+	require.Equal(t, expected, stored)
+}
+
+func requireGet(t *testing.T, repo repository.ShortenerRepo, shortened, expected string) {
+	t.Helper()
+
+	original, err := repo.Get(context.Background(), shortened)
+	require.NoError(t, err)
+	require.Equal(t, expected, original)
+}
+
+func requireNotFound(t *testing.T, repo repository.ShortenerRepo, shortened string) {
+	t.Helper()
+
+	_, err := repo.Get(context.Background(), shortened)
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func testStore(t *testing.T, repo repository.ShortenerRepo) {
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	requireStore(t, repo, link, link)
+	requireGet(t, repo, link.ShortenedURL, link.OriginalURL)
+}
+
+func testStoreOriginalExists(t *testing.T, repo repository.ShortenerRepo) {
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	requireStore(t, repo, link, link)
+
+	requireStore(t, repo, domain.Link{OriginalURL: link.OriginalURL, ShortenedURL: "def"}, link)
+	requireNotFound(t, repo, "def")
+}
+
+func testStoreShortenedExists(t *testing.T, repo repository.ShortenerRepo) {
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	requireStore(t, repo, link, link)
+
+	_, err := repo.Store(context.Background(), domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: link.ShortenedURL})
+	require.ErrorIs(t, err, service.ErrExist)
+	requireGet(t, repo, link.ShortenedURL, link.OriginalURL)
+}
+
+// testDedupOrder stores link which original and shortened both exist in different links.
+func testDedupOrder(t *testing.T, repo repository.ShortenerRepo) {
+	first := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	second := domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"}
+	requireStore(t, repo, first, first)
+	requireStore(t, repo, second, second)
+
+	requireStore(t, repo, domain.Link{OriginalURL: first.OriginalURL, ShortenedURL: second.ShortenedURL}, first)
+	requireGet(t, repo, second.ShortenedURL, second.OriginalURL)
+}
+
+func testStoreTwice(t *testing.T, repo repository.ShortenerRepo) {
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	requireStore(t, repo, link, link)
+	requireStore(t, repo, link, link)
+}
+
+func testGetNotFound(t *testing.T, repo repository.ShortenerRepo) {
+	requireNotFound(t, repo, "abc")
+
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	requireStore(t, repo, link, link)
+	requireNotFound(t, repo, "ab")
+	requireNotFound(t, repo, "abcd")
+}
+
+// testExactValues checks that values aren't normalized: case, trailing slash and unicode are kept.
+func testExactValues(t *testing.T, repo repository.ShortenerRepo) {
+	links := []domain.Link{
+		{OriginalURL: "https://google.com", ShortenedURL: "abc"},
+		{OriginalURL: "https://google.com/", ShortenedURL: "ABC"},
+		{OriginalURL: "https://Google.com", ShortenedURL: "aBc"},
+		{OriginalURL: "https://пример.рф/путь?q=значение#якорь", ShortenedURL: "abc_"},
+		{OriginalURL: "https://example.com/%D0%BF%D1%83%D1%82%D1%8C", ShortenedURL: "a-b"},
+	}
+	for _, link := range links {
+		requireStore(t, repo, link, link)
+	}
+	for _, link := range links {
+		requireGet(t, repo, link.ShortenedURL, link.OriginalURL)
+	}
+}
+
+func testLargeValues(t *testing.T, repo repository.ShortenerRepo) {
+	long := "https://example.com/" + strings.Repeat("a", LargeOriginalLen-len("https://example.com/"))
+	link := domain.Link{OriginalURL: long, ShortenedURL: strings.Repeat("z", MaxShortenedLen)}
+	requireStore(t, repo, link, link)
+	requireGet(t, repo, link.ShortenedURL, link.OriginalURL)
+
+	// Originals differing only at the end are different.
+	other := domain.Link{OriginalURL: long[:len(long)-1] + "b", ShortenedURL: "abc"}
+	requireStore(t, repo, other, other)
+	requireStore(t, repo, domain.Link{OriginalURL: long, ShortenedURL: "def"}, link)
+}
+
+// concurrently calls fn from workers goroutines started at once.
+func concurrently(fn func(i int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+}
+
+func testConcurrentOriginal(t *testing.T, repo repository.ShortenerRepo) {
+	results := make([]domain.Link, workers)
+	errs := make([]error, workers)
+	concurrently(func(i int) {
+		link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "s" + strconv.Itoa(i)}
+		results[i], errs[i] = repo.Store(context.Background(), link)
+	})
+
+	for i := 0; i < workers; i++ {
+		require.NoError(t, errs[i])
+		require.Equal(t, results[0], results[i])
+	}
+	requireGet(t, repo, results[0].ShortenedURL, "https://google.com")
+	for i := 0; i < workers; i++ {
+		if shortened := "s" + strconv.Itoa(i); shortened != results[0].ShortenedURL {
+			requireNotFound(t, repo, shortened)
+		}
+	}
+}
+
+func testConcurrentShortened(t *testing.T, repo repository.ShortenerRepo) {
+	errs := make([]error, workers)
+	concurrently(func(i int) {
+		link := domain.Link{OriginalURL: "https://o" + strconv.Itoa(i), ShortenedURL: "same"}
+		_, errs[i] = repo.Store(context.Background(), link)
+	})
+
+	winner := -1
+	for i := 0; i < workers; i++ {
+		if errs[i] == nil {
+			require.Equal(t, -1, winner, "shortened URL is stored twice")
+			winner = i
+			continue
+		}
+		require.ErrorIs(t, errs[i], service.ErrExist)
+	}
+	require.NotEqual(t, -1, winner)
+	requireGet(t, repo, "same", "https://o"+strconv.Itoa(winner))
+}
+
+// testConcurrentDedupOrder stores the same original by half of workers and the same shortened by others.
+func testConcurrentDedupOrder(t *testing.T, repo repository.ShortenerRepo) {
+	results := make([]domain.Link, workers)
+	errs := make([]error, workers)
+	concurrently(func(i int) {
+		link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "s" + strconv.Itoa(i)}
+		if i%2 == 1 {
+			link = domain.Link{OriginalURL: "https://o" + strconv.Itoa(i), ShortenedURL: "same"}
+		}
+		results[i], errs[i] = repo.Store(context.Background(), link)
+	})
+
+	sameOriginal := ""
+	sameShortened := 0
+	for i := 0; i < workers; i++ {
+		if i%2 == 0 {
+			require.NoError(t, errs[i])
+			if sameOriginal == "" {
+				sameOriginal = results[i].ShortenedURL
+			}
+			require.Equal(t, sameOriginal, results[i].ShortenedURL)
+			continue
+		}
+		if errs[i] == nil {
+			sameShortened++
+		} else {
+			require.ErrorIs(t, errs[i], service.ErrExist)
+		}
+	}
+	require.Equal(t, 1, sameShortened)
+	requireGet(t, repo, sameOriginal, "https://google.com")
+}
+
+// testConcurrentStoreGet checks that every stored link is resolved at once, while others are stored.
+func testConcurrentStoreGet(t *testing.T, repo repository.ShortenerRepo) {
+	const links = 20
+
+	errs := make([]error, workers)
+	concurrently(func(i int) {
+		for j := 0; j < links; j++ {
+			id := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+			link := domain.Link{OriginalURL: "https://example.com/" + id, ShortenedURL: id}
+			if _, err := repo.Store(context.Background(), link); err != nil {
+				errs[i] = err
+				return
+			}
+			original, err := repo.Get(context.Background(), id)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if original != link.OriginalURL {
+				errs[i] = fmt.Errorf("got %q for %s", original, id)
+				return
+			}
+		}
+	})
+
+	for i := 0; i < workers; i++ {
+		require.NoError(t, errs[i])
+	}
+}
+
+func testCanceled(t *testing.T, repo repository.ShortenerRepo) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	testDone(t, repo, ctx, context.Canceled)
+}
+
+func testDeadline(t *testing.T, repo repository.ShortenerRepo) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	testDone(t, repo, ctx, context.DeadlineExceeded)
+}
+
+// testDone checks that calls with done ctx return its error and change nothing.
+func testDone(t *testing.T, repo repository.ShortenerRepo, ctx context.Context, expected error) {
+	stored := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	requireStore(t, repo, stored, stored)
+
+	_, err := repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: "def"})
+	require.ErrorIs(t, err, expected)
+	requireNotFound(t, repo, "def")
+
+	_, err = repo.Get(ctx, stored.ShortenedURL)
+	require.ErrorIs(t, err, expected)
+
+	// Repository still works with live context.
+	requireGet(t, repo, stored.ShortenedURL, stored.OriginalURL)
+}
+
+func testClose(t *testing.T, repo repository.ShortenerRepo) {
+	link := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "abc"}
+	requireStore(t, repo, link, link)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// Run closes repository once more after test.
+		repo.Close(ctx)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close with canceled context is blocked")
+	}
+}
@@ -0,0 +1,78 @@
+package shardrepo
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// Buckets is number of hash buckets, shard map assigns them to shards.
+// It must never change, buckets of stored links would change too.
+const Buckets = 1024
+
+// BucketRange is buckets from Lo to Hi inclusive.
+type BucketRange struct {
+	Lo, Hi int
+}
+
+func (r BucketRange) Contains(bucket int) bool {
+	return r.Lo <= bucket && bucket <= r.Hi
+}
+
+func (r BucketRange) String() string {
+	if r.Lo == r.Hi {
+		return strconv.Itoa(r.Lo)
+	}
+	return fmt.Sprintf("%d-%d", r.Lo, r.Hi)
+}
+
+// ParseBuckets parses comma-separated buckets and ranges, e.g. "0-511,768".
+func ParseBuckets(s string) ([]BucketRange, error) {
+	var ranges []BucketRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+
+		var r BucketRange
+		var err error
+		if r.Lo, err = strconv.Atoi(lo); err != nil {
+			return nil, fmt.Errorf("bucket %q: %w", part, err)
+		}
+		r.Hi = r.Lo
+		if isRange {
+			if r.Hi, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("bucket %q: %w", part, err)
+			}
+		}
+
+		if r.Lo < 0 || r.Hi >= Buckets || r.Lo > r.Hi {
+			return nil, fmt.Errorf("bucket range %q must be within [0, %d]", part, Buckets-1)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func bucket(key []byte) int {
+	h := fnv.New64a()
+	h.Write(key)
+	return int(h.Sum64() % Buckets)
+}
+
+// SlugBucket returns bucket of link by its shortened URL.
+func SlugBucket(shortened string) int {
+	return bucket([]byte(shortened))
+}
+
+// OriginalHash returns key of original URL in directory of originals.
+func OriginalHash(original string) []byte {
+	hash := sha256.Sum256([]byte(original))
+	return hash[:]
+}
+
+// OriginalBucket returns bucket of directory entry by original URL hash.
+func OriginalBucket(originalHash []byte) int {
+	return bucket(originalHash)
+}
@@ -0,0 +1,135 @@
+package shardrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/amanakin/shortener/internal/service"
+)
+
+// Checkpoint is progress of Copy. Links are copied before directory entries,
+// so copied directory entry never points to missing link.
+type Checkpoint struct {
+	Buckets        string `json:"buckets"`
+	LinksAfter     string `json:"links_after"`
+	LinksDone      bool   `json:"links_done"`
+	OriginalsAfter []byte `json:"originals_after"`
+	Done           bool   `json:"done"`
+	Copied         int64  `json:"copied"`
+}
+
+// Copy copies links and directory entries of buckets in batches, continuing from checkpoint.
+// save is called after every batch. Rows existing on to are skipped, so Copy may be repeated.
+func Copy(ctx context.Context, from, to Shard, buckets BucketRange, batch int,
+	checkpoint *Checkpoint, save func(Checkpoint) error) error {
+	if checkpoint.Buckets == "" {
+		checkpoint.Buckets = buckets.String()
+	}
+	if checkpoint.Buckets != buckets.String() {
+		return fmt.Errorf("checkpoint is for buckets %s", checkpoint.Buckets)
+	}
+
+	for !checkpoint.LinksDone {
+		links, err := from.ScanLinks(ctx, buckets, checkpoint.LinksAfter, batch)
+		if err != nil {
+			return err
+		}
+		if len(links) > 0 {
+			if err = to.CopyLinks(ctx, links); err != nil {
+				return err
+			}
+			checkpoint.LinksAfter = links[len(links)-1].ShortenedURL
+			checkpoint.Copied += int64(len(links))
+		}
+		checkpoint.LinksDone = len(links) < batch
+		if err = save(*checkpoint); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+	}
+
+	for !checkpoint.Done {
+		originals, err := from.ScanOriginals(ctx, buckets, checkpoint.OriginalsAfter, batch)
+		if err != nil {
+			return err
+		}
+		if len(originals) > 0 {
+			if err = to.CopyOriginals(ctx, originals); err != nil {
+				return err
+			}
+			checkpoint.OriginalsAfter = originals[len(originals)-1].Hash
+			checkpoint.Copied += int64(len(originals))
+		}
+		checkpoint.Done = len(originals) < batch
+		if err = save(*checkpoint); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+	}
+	return nil
+}
+
+// VerifyResult is result of Verify.
+type VerifyResult struct {
+	Checked int64
+	// Missing rows are not on destination shard.
+	Missing int64
+	// Mismatched rows point to other URL on destination shard.
+	Mismatched int64
+}
+
+func (r VerifyResult) OK() bool {
+	return r.Missing == 0 && r.Mismatched == 0
+}
+
+// Verify checks that all links and directory entries of buckets on from are on to.
+func Verify(ctx context.Context, from, to Shard, buckets BucketRange, batch int) (VerifyResult, error) {
+	var result VerifyResult
+
+	for after := ""; ; {
+		links, err := from.ScanLinks(ctx, buckets, after, batch)
+		if err != nil {
+			return result, err
+		}
+		for _, link := range links {
+			original, err := to.Get(ctx, link.ShortenedURL)
+			if err = result.check(err, original == link.OriginalURL); err != nil {
+				return result, err
+			}
+		}
+		if len(links) < batch {
+			break
+		}
+		after = links[len(links)-1].ShortenedURL
+	}
+
+	for after := []byte(nil); ; {
+		originals, err := from.ScanOriginals(ctx, buckets, after, batch)
+		if err != nil {
+			return result, err
+		}
+		for _, original := range originals {
+			shortened, err := to.Lookup(ctx, original.Hash)
+			if err = result.check(err, shortened == original.Shortened); err != nil {
+				return result, err
+			}
+		}
+		if len(originals) < batch {
+			break
+		}
+		after = originals[len(originals)-1].Hash
+	}
+	return result, nil
+}
+
+func (r *VerifyResult) check(err error, match bool) error {
+	r.Checked++
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		r.Missing++
+	case err != nil:
+		return err
+	case !match:
+		r.Mismatched++
+	}
+	return nil
+}
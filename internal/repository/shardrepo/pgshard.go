@@ -0,0 +1,193 @@
+package shardrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository/postgres"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgShard is Shard in Postgres database with schema from sql/sharded.sql.
+type PgShard struct {
+	pool *pgxpool.Pool
+}
+
+func NewPgShard(ctx context.Context, config postgres.Config) (*PgShard, error) {
+	pool, err := postgres.NewPool(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &PgShard{pool: pool}, nil
+}
+
+func (s *PgShard) Get(ctx context.Context, shortened string) (string, error) {
+	var original string
+	err := s.pool.QueryRow(ctx, "SELECT original_url FROM links WHERE short_url = $1",
+		shortened).Scan(&original)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", service.ErrNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("select link: %w", err)
+	}
+	return original, nil
+}
+
+func (s *PgShard) Insert(ctx context.Context, link domain.Link) error {
+	tag, err := s.pool.Exec(ctx, `INSERT INTO links (short_url, original_url, bucket)
+		VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		link.ShortenedURL, link.OriginalURL, SlugBucket(link.ShortenedURL))
+	if err != nil {
+		return fmt.Errorf("insert link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return service.ErrExist
+	}
+	return nil
+}
+
+func (s *PgShard) Delete(ctx context.Context, link domain.Link) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM links WHERE short_url = $1 AND original_url = $2",
+		link.ShortenedURL, link.OriginalURL)
+	if err != nil {
+		return fmt.Errorf("delete link: %w", err)
+	}
+	return nil
+}
+
+func (s *PgShard) Lookup(ctx context.Context, originalHash []byte) (string, error) {
+	var shortened string
+	err := s.pool.QueryRow(ctx, "SELECT short_url FROM originals WHERE original_hash = $1",
+		originalHash).Scan(&shortened)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", service.ErrNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("select original: %w", err)
+	}
+	return shortened, nil
+}
+
+func (s *PgShard) Claim(ctx context.Context, original Original) (string, error) {
+	// No-op update makes RETURNING see existing row.
+	var shortened string
+	err := s.pool.QueryRow(ctx, `INSERT INTO originals AS o (original_hash, short_url, bucket)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (original_hash) DO UPDATE SET short_url = o.short_url
+		RETURNING o.short_url`,
+		original.Hash, original.Shortened, OriginalBucket(original.Hash)).Scan(&shortened)
+	if err != nil {
+		return "", fmt.Errorf("insert original: %w", err)
+	}
+	return shortened, nil
+}
+
+func (s *PgShard) ScanLinks(ctx context.Context, buckets BucketRange, after string, limit int) ([]domain.Link, error) {
+	rows, err := s.pool.Query(ctx, `SELECT original_url, short_url FROM links
+		WHERE bucket BETWEEN $1 AND $2 AND short_url > $3
+		ORDER BY short_url LIMIT $4`, buckets.Lo, buckets.Hi, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select links: %w", err)
+	}
+
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.Link, error) {
+		var link domain.Link
+		err := row.Scan(&link.OriginalURL, &link.ShortenedURL)
+		return link, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan links: %w", err)
+	}
+	return links, nil
+}
+
+func (s *PgShard) ScanOriginals(ctx context.Context, buckets BucketRange, after []byte, limit int) ([]Original, error) {
+	if after == nil {
+		after = []byte{}
+	}
+	rows, err := s.pool.Query(ctx, `SELECT original_hash, short_url FROM originals
+		WHERE bucket BETWEEN $1 AND $2 AND original_hash > $3
+		ORDER BY original_hash LIMIT $4`, buckets.Lo, buckets.Hi, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select originals: %w", err)
+	}
+
+	originals, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Original, error) {
+		var original Original
+		err := row.Scan(&original.Hash, &original.Shortened)
+		return original, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan originals: %w", err)
+	}
+	return originals, nil
+}
+
+func (s *PgShard) CopyLinks(ctx context.Context, links []domain.Link) error {
+	shortened := make([]string, len(links))
+	originals := make([]string, len(links))
+	buckets := make([]int32, len(links))
+	for i, link := range links {
+		shortened[i] = link.ShortenedURL
+		originals[i] = link.OriginalURL
+		buckets[i] = int32(SlugBucket(link.ShortenedURL))
+	}
+
+	_, err := s.pool.Exec(ctx, `INSERT INTO links (short_url, original_url, bucket)
+		SELECT * FROM unnest($1::text[], $2::text[], $3::smallint[])
+		ON CONFLICT DO NOTHING`, shortened, originals, buckets)
+	if err != nil {
+		return fmt.Errorf("copy links: %w", err)
+	}
+	return nil
+}
+
+func (s *PgShard) CopyOriginals(ctx context.Context, originals []Original) error {
+	hashes := make([][]byte, len(originals))
+	shortened := make([]string, len(originals))
+	buckets := make([]int32, len(originals))
+	for i, original := range originals {
+		hashes[i] = original.Hash
+		shortened[i] = original.Shortened
+		buckets[i] = int32(OriginalBucket(original.Hash))
+	}
+
+	_, err := s.pool.Exec(ctx, `INSERT INTO originals (original_hash, short_url, bucket)
+		SELECT * FROM unnest($1::bytea[], $2::text[], $3::smallint[])
+		ON CONFLICT DO NOTHING`, hashes, shortened, buckets)
+	if err != nil {
+		return fmt.Errorf("copy originals: %w", err)
+	}
+	return nil
+}
+
+func (s *PgShard) DeleteBuckets(ctx context.Context, buckets BucketRange) (int64, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx) // no-op after successful commit
+
+	links, err := tx.Exec(ctx, "DELETE FROM links WHERE bucket BETWEEN $1 AND $2", buckets.Lo, buckets.Hi)
+	if err != nil {
+		return 0, fmt.Errorf("delete links: %w", err)
+	}
+	originals, err := tx.Exec(ctx, "DELETE FROM originals WHERE bucket BETWEEN $1 AND $2", buckets.Lo, buckets.Hi)
+	if err != nil {
+		return 0, fmt.Errorf("delete originals: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return links.RowsAffected() + originals.RowsAffected(), nil
+}
+
+func (s *PgShard) Close() {
+	s.pool.Close()
+}
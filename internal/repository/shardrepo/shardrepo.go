@@ -0,0 +1,303 @@
+// Package shardrepo implements repository.ShortenerRepo sharded over several databases.
+//
+// Links are routed by hash of shortened URL, and directory of originals
+// (original URL hash to shortened URL), which keeps original URLs unique,
+// is routed by hash of original URL. Both hashes fall into one of Buckets
+// buckets, and shard map assigns buckets to shards.
+//
+// Store inserts link first and directory entry second, so directory never
+// points to missing link. If directory entry of original exists meanwhile,
+// inserted link is deleted and existing one is returned.
+//
+// Buckets are moved between shards online: while move is configured,
+// links and directory entries are written to the old shard and then to the new one,
+// and read from the new shard and then the old one, and Copy moves old rows.
+// Instances which don't know about the move yet (or already finished it) write
+// only to the old (new) shard, so unique keys of both keep links unique during deploys.
+package shardrepo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository/postgres"
+	"github.com/amanakin/shortener/internal/service"
+)
+
+// Original is directory entry of original URL.
+type Original struct {
+	Hash      []byte
+	Shortened string
+}
+
+// Shard keeps links and directory entries of some buckets.
+type Shard interface {
+	// Get returns original URL of shortened or service.ErrNotFound.
+	Get(ctx context.Context, shortened string) (string, error)
+	// Insert inserts link or returns service.ErrExist if shortened URL exists.
+	Insert(ctx context.Context, link domain.Link) error
+	// Delete deletes link if shortened URL points to its original URL.
+	Delete(ctx context.Context, link domain.Link) error
+	// Lookup returns shortened URL of original URL hash or service.ErrNotFound.
+	Lookup(ctx context.Context, originalHash []byte) (string, error)
+	// Claim inserts directory entry, if original exists it returns its shortened URL.
+	Claim(ctx context.Context, original Original) (string, error)
+
+	// ScanLinks returns up to limit links of buckets ordered by shortened URL after given one.
+	ScanLinks(ctx context.Context, buckets BucketRange, after string, limit int) ([]domain.Link, error)
+	// ScanOriginals returns up to limit directory entries of buckets ordered by hash after given one.
+	ScanOriginals(ctx context.Context, buckets BucketRange, after []byte, limit int) ([]Original, error)
+	// CopyLinks and CopyOriginals insert rows skipping existing ones.
+	CopyLinks(ctx context.Context, links []domain.Link) error
+	CopyOriginals(ctx context.Context, originals []Original) error
+	// DeleteBuckets deletes links and directory entries of buckets.
+	DeleteBuckets(ctx context.Context, buckets BucketRange) (int64, error)
+
+	Close()
+}
+
+type Config struct {
+	Shards []ShardConfig `yaml:"shards"`
+	// Moves are buckets being moved between shards.
+	Moves []MoveConfig `yaml:"moves"`
+}
+
+type ShardConfig struct {
+	Name     string          `yaml:"name"`
+	Postgres postgres.Config `yaml:"postgres"`
+	// Buckets owned by shard, e.g. "0-511,768-1023". New shard owns none until buckets are moved to it.
+	Buckets string `yaml:"buckets"`
+}
+
+type MoveConfig struct {
+	// Buckets must be owned by From shard.
+	Buckets string `yaml:"buckets"`
+	From    string `yaml:"from"`
+	To      string `yaml:"to"`
+}
+
+func DefaultConfig() Config {
+	return Config{}
+}
+
+// route is where bucket lives, from is set while bucket is moved to shard.
+type route struct {
+	shard Shard
+	from  Shard
+}
+
+type Repo struct {
+	shards map[string]Shard
+	routes [Buckets]route
+}
+
+// New connects to all shards of config.
+func New(ctx context.Context, config Config) (*Repo, error) {
+	shards := make(map[string]Shard, len(config.Shards))
+	for _, shardConfig := range config.Shards {
+		if _, ok := shards[shardConfig.Name]; ok {
+			closeShards(shards)
+			return nil, fmt.Errorf("duplicate shard %q", shardConfig.Name)
+		}
+		shard, err := NewPgShard(ctx, shardConfig.Postgres)
+		if err != nil {
+			closeShards(shards)
+			return nil, fmt.Errorf("shard %s: %w", shardConfig.Name, err)
+		}
+		shards[shardConfig.Name] = shard
+	}
+
+	repo, err := NewWithShards(config, shards)
+	if err != nil {
+		closeShards(shards)
+		return nil, err
+	}
+	return repo, nil
+}
+
+func closeShards(shards map[string]Shard) {
+	for _, shard := range shards {
+		shard.Close()
+	}
+}
+
+// NewWithShards builds shard map of config over shards by their names.
+// Every bucket must be owned by exactly one shard.
+func NewWithShards(config Config, shards map[string]Shard) (*Repo, error) {
+	r := &Repo{shards: shards}
+
+	owners, err := Owners(config)
+	if err != nil {
+		return nil, err
+	}
+	for bucket, owner := range owners {
+		shard, ok := shards[owner]
+		if !ok {
+			return nil, fmt.Errorf("unknown shard %q", owner)
+		}
+		r.routes[bucket].shard = shard
+	}
+
+	for _, move := range config.Moves {
+		ranges, err := ParseBuckets(move.Buckets)
+		if err != nil {
+			return nil, fmt.Errorf("move to %s: %w", move.To, err)
+		}
+		to, ok := shards[move.To]
+		if !ok || move.From == move.To {
+			return nil, fmt.Errorf("move of %s: wrong shard %q", move.Buckets, move.To)
+		}
+
+		for _, buckets := range ranges {
+			for bucket := buckets.Lo; bucket <= buckets.Hi; bucket++ {
+				if owners[bucket] != move.From {
+					return nil, fmt.Errorf("move of %s: bucket %d is not owned by %s", move.Buckets, bucket, move.From)
+				}
+				if r.routes[bucket].from != nil {
+					return nil, fmt.Errorf("bucket %d is moved twice", bucket)
+				}
+				r.routes[bucket] = route{shard: to, from: r.routes[bucket].shard}
+			}
+		}
+	}
+	return r, nil
+}
+
+// Owners returns names of shards owning buckets according to config.Shards.
+func Owners(config Config) ([Buckets]string, error) {
+	var owners [Buckets]string
+	for _, shardConfig := range config.Shards {
+		if shardConfig.Buckets == "" {
+			continue
+		}
+		ranges, err := ParseBuckets(shardConfig.Buckets)
+		if err != nil {
+			return owners, fmt.Errorf("shard %s: %w", shardConfig.Name, err)
+		}
+		for _, buckets := range ranges {
+			for bucket := buckets.Lo; bucket <= buckets.Hi; bucket++ {
+				if owners[bucket] != "" {
+					return owners, fmt.Errorf("bucket %d is owned by %s and %s", bucket, owners[bucket], shardConfig.Name)
+				}
+				owners[bucket] = shardConfig.Name
+			}
+		}
+	}
+
+	for bucket, owner := range owners {
+		if owner == "" {
+			return owners, fmt.Errorf("bucket %d has no shard", bucket)
+		}
+	}
+	return owners, nil
+}
+
+func (r *Repo) Store(ctx context.Context, link domain.Link) (domain.Link, error) {
+	original := Original{Hash: OriginalHash(link.OriginalURL), Shortened: link.ShortenedURL}
+	originalRoute := r.routes[OriginalBucket(original.Hash)]
+	slugRoute := r.routes[SlugBucket(link.ShortenedURL)]
+
+	shortened, err := originalRoute.lookup(ctx, original.Hash)
+	if err == nil {
+		link.ShortenedURL = shortened
+		return link, nil
+	} else if !errors.Is(err, service.ErrNotFound) {
+		return link, fmt.Errorf("lookup original: %w", err)
+	}
+
+	if err = slugRoute.insert(ctx, link); err != nil {
+		if errors.Is(err, service.ErrExist) {
+			return link, err
+		}
+		return link, fmt.Errorf("insert link: %w", err)
+	}
+
+	shortened, err = originalRoute.claim(ctx, original)
+	if err != nil {
+		// Link without directory entry resolves and is never returned by Store.
+		return link, fmt.Errorf("claim original: %w", err)
+	}
+	if shortened != link.ShortenedURL {
+		// Concurrent Store of the same original URL won.
+		if err = slugRoute.delete(ctx, link); err != nil {
+			return link, fmt.Errorf("delete link: %w", err)
+		}
+		link.ShortenedURL = shortened
+	}
+	return link, nil
+}
+
+// insert inserts link into old shard and then into new one while bucket is moved.
+func (rt route) insert(ctx context.Context, link domain.Link) error {
+	if rt.from != nil {
+		if err := rt.from.Insert(ctx, link); err != nil {
+			return err
+		}
+	}
+
+	err := rt.shard.Insert(ctx, link)
+	if rt.from == nil || !errors.Is(err, service.ErrExist) {
+		return err
+	}
+	// Link inserted into old shard may be copied already.
+	if original, getErr := rt.shard.Get(ctx, link.ShortenedURL); getErr == nil && original == link.OriginalURL {
+		return nil
+	}
+	// Instance which finished the move stored other link.
+	if deleteErr := rt.from.Delete(ctx, link); deleteErr != nil {
+		return fmt.Errorf("delete from old shard: %w", deleteErr)
+	}
+	return err
+}
+
+// claim claims original on old shard and then on new one while bucket is moved,
+// winner on the new shard is returned, since it's looked up first.
+func (rt route) claim(ctx context.Context, original Original) (string, error) {
+	if rt.from != nil {
+		shortened, err := rt.from.Claim(ctx, original)
+		if err != nil || shortened != original.Shortened {
+			return shortened, err
+		}
+	}
+	return rt.shard.Claim(ctx, original)
+}
+
+func (rt route) delete(ctx context.Context, link domain.Link) error {
+	if err := rt.shard.Delete(ctx, link); err != nil {
+		return err
+	}
+	if rt.from != nil {
+		return rt.from.Delete(ctx, link)
+	}
+	return nil
+}
+
+func (rt route) lookup(ctx context.Context, originalHash []byte) (string, error) {
+	shortened, err := rt.shard.Lookup(ctx, originalHash)
+	if errors.Is(err, service.ErrNotFound) && rt.from != nil {
+		return rt.from.Lookup(ctx, originalHash)
+	}
+	return shortened, err
+}
+
+func (r *Repo) Get(ctx context.Context, shortened string) (string, error) {
+	rt := r.routes[SlugBucket(shortened)]
+
+	original, err := rt.shard.Get(ctx, shortened)
+	if errors.Is(err, service.ErrNotFound) && rt.from != nil {
+		original, err = rt.from.Get(ctx, shortened)
+	}
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		return "", fmt.Errorf("get: %w", err)
+	}
+	return original, err
+}
+
+// Shared implements repository.Shared, replicas store links to the same shards.
+func (r *Repo) Shared() {}
+
+func (r *Repo) Close(_ context.Context) {
+	closeShards(r.shards)
+}
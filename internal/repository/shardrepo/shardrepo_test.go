@@ -0,0 +1,458 @@
+package shardrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/repotest"
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+// memShard is Shard in memory.
+type memShard struct {
+	mu        sync.Mutex
+	links     map[string]string
+	originals map[string]string
+}
+
+func newMemShard() *memShard {
+	return &memShard{
+		links:     make(map[string]string),
+		originals: make(map[string]string),
+	}
+}
+
+func (s *memShard) Get(ctx context.Context, shortened string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	original, ok := s.links[shortened]
+	if !ok {
+		return "", service.ErrNotFound
+	}
+	return original, nil
+}
+
+func (s *memShard) Insert(ctx context.Context, link domain.Link) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.links[link.ShortenedURL]; ok {
+		return service.ErrExist
+	}
+	s.links[link.ShortenedURL] = link.OriginalURL
+	return nil
+}
+
+func (s *memShard) Delete(_ context.Context, link domain.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.links[link.ShortenedURL] == link.OriginalURL {
+		delete(s.links, link.ShortenedURL)
+	}
+	return nil
+}
+
+func (s *memShard) Lookup(ctx context.Context, originalHash []byte) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shortened, ok := s.originals[string(originalHash)]
+	if !ok {
+		return "", service.ErrNotFound
+	}
+	return shortened, nil
+}
+
+func (s *memShard) Claim(ctx context.Context, original Original) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if shortened, ok := s.originals[string(original.Hash)]; ok {
+		return shortened, nil
+	}
+	s.originals[string(original.Hash)] = original.Shortened
+	return original.Shortened, nil
+}
+
+func (s *memShard) ScanLinks(_ context.Context, buckets BucketRange, after string, limit int) ([]domain.Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var links []domain.Link
+	for shortened, original := range s.links {
+		if buckets.Contains(SlugBucket(shortened)) && shortened > after {
+			links = append(links, domain.Link{OriginalURL: original, ShortenedURL: shortened})
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].ShortenedURL < links[j].ShortenedURL
+	})
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+func (s *memShard) ScanOriginals(_ context.Context, buckets BucketRange, after []byte, limit int) ([]Original, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var originals []Original
+	for hash, shortened := range s.originals {
+		if buckets.Contains(OriginalBucket([]byte(hash))) && bytes.Compare([]byte(hash), after) > 0 {
+			originals = append(originals, Original{Hash: []byte(hash), Shortened: shortened})
+		}
+	}
+	sort.Slice(originals, func(i, j int) bool {
+		return bytes.Compare(originals[i].Hash, originals[j].Hash) < 0
+	})
+	if len(originals) > limit {
+		originals = originals[:limit]
+	}
+	return originals, nil
+}
+
+func (s *memShard) CopyLinks(_ context.Context, links []domain.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, link := range links {
+		if _, ok := s.links[link.ShortenedURL]; !ok {
+			s.links[link.ShortenedURL] = link.OriginalURL
+		}
+	}
+	return nil
+}
+
+func (s *memShard) CopyOriginals(_ context.Context, originals []Original) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, original := range originals {
+		if _, ok := s.originals[string(original.Hash)]; !ok {
+			s.originals[string(original.Hash)] = original.Shortened
+		}
+	}
+	return nil
+}
+
+func (s *memShard) DeleteBuckets(_ context.Context, buckets BucketRange) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for shortened := range s.links {
+		if buckets.Contains(SlugBucket(shortened)) {
+			delete(s.links, shortened)
+			deleted++
+		}
+	}
+	for hash := range s.originals {
+		if buckets.Contains(OriginalBucket([]byte(hash))) {
+			delete(s.originals, hash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *memShard) Close() {}
+
+func twoShards() map[string]Shard {
+	return map[string]Shard{"s1": newMemShard(), "s2": newMemShard()}
+}
+
+func link(i int) domain.Link {
+	return domain.Link{
+		OriginalURL:  "https://example.com/" + strconv.Itoa(i),
+		ShortenedURL: "s" + strconv.Itoa(i),
+	}
+}
+
+func TestConformance(t *testing.T) {
+	configs := map[string]Config{
+		"without move": {Shards: []ShardConfig{{Name: "s1", Buckets: "0-511"}, {Name: "s2", Buckets: "512-1023"}}},
+		"with move": {
+			Shards: []ShardConfig{{Name: "s1", Buckets: "0-511"}, {Name: "s2", Buckets: "512-1023"}},
+			Moves:  []MoveConfig{{Buckets: "0-255", From: "s1", To: "s2"}},
+		},
+	}
+	for name, config := range configs {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			repotest.Run(t, func(t *testing.T) repository.ShortenerRepo {
+				repo, err := NewWithShards(config, twoShards())
+				require.NoError(t, err)
+				return repo
+			})
+		})
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets string
+		want    []BucketRange
+		wantErr bool
+	}{
+		{name: "range", buckets: "0-511", want: []BucketRange{{0, 511}}},
+		{name: "list", buckets: "0-1, 7", want: []BucketRange{{0, 1}, {7, 7}}},
+		{name: "out of range", buckets: "0-1024", wantErr: true},
+		{name: "reversed", buckets: "5-4", wantErr: true},
+		{name: "not number", buckets: "a", wantErr: true},
+		{name: "empty", buckets: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBuckets(tt.buckets)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestShardMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: Config{
+				Shards: []ShardConfig{{Name: "s1", Buckets: "0-511"}, {Name: "s2", Buckets: "512-1023"}},
+				Moves:  []MoveConfig{{Buckets: "0-63", From: "s1", To: "s2"}},
+			},
+		},
+		{
+			name:    "gap",
+			config:  Config{Shards: []ShardConfig{{Name: "s1", Buckets: "0-510"}, {Name: "s2", Buckets: "512-1023"}}},
+			wantErr: "bucket 511 has no shard",
+		},
+		{
+			name:    "overlap",
+			config:  Config{Shards: []ShardConfig{{Name: "s1", Buckets: "0-512"}, {Name: "s2", Buckets: "512-1023"}}},
+			wantErr: "bucket 512 is owned by s1 and s2",
+		},
+		{
+			name: "move from not owner",
+			config: Config{
+				Shards: []ShardConfig{{Name: "s1", Buckets: "0-511"}, {Name: "s2", Buckets: "512-1023"}},
+				Moves:  []MoveConfig{{Buckets: "510-512", From: "s1", To: "s2"}},
+			},
+			wantErr: "bucket 512 is not owned by s1",
+		},
+		{
+			name:    "unknown shard",
+			config:  Config{Shards: []ShardConfig{{Name: "s3", Buckets: "0-1023"}}},
+			wantErr: `unknown shard "s3"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWithShards(tt.config, twoShards())
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestShardRepo(t *testing.T) {
+	ctx := context.Background()
+	shards := twoShards()
+	repo, err := NewWithShards(Config{
+		Shards: []ShardConfig{{Name: "s1", Buckets: "0-511"}, {Name: "s2", Buckets: "512-1023"}},
+	}, shards)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		stored, err := repo.Store(ctx, link(i))
+		require.NoError(t, err)
+		require.Equal(t, link(i), stored)
+	}
+	// Both shards get links.
+	require.NotEmpty(t, shards["s1"].(*memShard).links)
+	require.NotEmpty(t, shards["s2"].(*memShard).links)
+
+	stored, err := repo.Store(ctx, domain.Link{OriginalURL: link(1).OriginalURL, ShortenedURL: "new"})
+	require.NoError(t, err)
+	require.Equal(t, link(1), stored)
+
+	_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: link(1).ShortenedURL})
+	require.ErrorIs(t, err, service.ErrExist)
+
+	original, err := repo.Get(ctx, link(2).ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, link(2).OriginalURL, original)
+
+	_, err = repo.Get(ctx, "new")
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestConcurrentStore(t *testing.T) {
+	ctx := context.Background()
+	shards := twoShards()
+	repo, err := NewWithShards(Config{
+		Shards: []ShardConfig{{Name: "s1", Buckets: "0-511"}, {Name: "s2", Buckets: "512-1023"}},
+	}, shards)
+	require.NoError(t, err)
+
+	const workers = 20
+	results := make([]string, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stored, err := repo.Store(ctx, domain.Link{OriginalURL: "https://google.com", ShortenedURL: strconv.Itoa(i)})
+			require.NoError(t, err)
+			results[i] = stored.ShortenedURL
+		}(i)
+	}
+	wg.Wait()
+
+	for _, shortened := range results {
+		require.Equal(t, results[0], shortened)
+	}
+	// Links of lost stores are deleted.
+	links := len(shards["s1"].(*memShard).links) + len(shards["s2"].(*memShard).links)
+	require.Equal(t, 1, links)
+}
+
+func TestMove(t *testing.T) {
+	ctx := context.Background()
+	shards := twoShards()
+	moved := BucketRange{0, Buckets - 1}
+
+	before := Config{Shards: []ShardConfig{{Name: "s1", Buckets: "0-1023"}, {Name: "s2"}}}
+
+	repo, err := NewWithShards(before, shards)
+	require.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		_, err = repo.Store(ctx, link(i))
+		require.NoError(t, err)
+	}
+
+	moving := before
+	moving.Moves = []MoveConfig{{Buckets: "0-1023", From: "s1", To: "s2"}}
+	repo, err = NewWithShards(moving, shards)
+	require.NoError(t, err)
+
+	// Old links are found on old shard, new ones go to new shard.
+	for i := 0; i < 50; i++ {
+		stored, err := repo.Store(ctx, domain.Link{OriginalURL: link(i).OriginalURL, ShortenedURL: "new"})
+		require.NoError(t, err)
+		require.Equal(t, link(i), stored)
+
+		_, err = repo.Store(ctx, domain.Link{OriginalURL: "https://ya.ru", ShortenedURL: link(i).ShortenedURL})
+		require.ErrorIs(t, err, service.ErrExist)
+	}
+	for i := 50; i < 100; i++ {
+		_, err = repo.Store(ctx, link(i))
+		require.NoError(t, err)
+	}
+
+	// Copy is interrupted after the first batch and resumed from checkpoint.
+	var saved Checkpoint
+	errStop := errors.New("stop")
+	err = Copy(ctx, shards["s1"], shards["s2"], moved, 10, &Checkpoint{}, func(c Checkpoint) error {
+		saved = c
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, int64(10), saved.Copied)
+
+	result, err := Verify(ctx, shards["s1"], shards["s2"], moved, 10)
+	require.NoError(t, err)
+	require.False(t, result.OK())
+
+	err = Copy(ctx, shards["s1"], shards["s2"], moved, 10, &saved, func(c Checkpoint) error { return nil })
+	require.NoError(t, err)
+	require.True(t, saved.Done)
+
+	result, err = Verify(ctx, shards["s1"], shards["s2"], moved, 10)
+	require.NoError(t, err)
+	require.True(t, result.OK())
+	require.Equal(t, saved.Copied, result.Checked)
+
+	after := Config{Shards: []ShardConfig{{Name: "s1"}, {Name: "s2", Buckets: "0-1023"}}}
+	_, err = shards["s1"].DeleteBuckets(ctx, moved)
+	require.NoError(t, err)
+	repo, err = NewWithShards(after, shards)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		original, err := repo.Get(ctx, link(i).ShortenedURL)
+		require.NoError(t, err)
+		require.Equal(t, link(i).OriginalURL, original)
+
+		stored, err := repo.Store(ctx, domain.Link{OriginalURL: link(i).OriginalURL, ShortenedURL: "new"})
+		require.NoError(t, err)
+		require.Equal(t, link(i), stored)
+	}
+}
+
+func TestMoveDeploy(t *testing.T) {
+	ctx := context.Background()
+	shards := twoShards()
+	before := Config{Shards: []ShardConfig{{Name: "s1", Buckets: "0-1023"}, {Name: "s2"}}}
+	moving := before
+	moving.Moves = []MoveConfig{{Buckets: "0-1023", From: "s1", To: "s2"}}
+	after := Config{Shards: []ShardConfig{{Name: "s1"}, {Name: "s2", Buckets: "0-1023"}}}
+
+	repos := make(map[string]*Repo)
+	for name, config := range map[string]Config{"before": before, "moving": moving, "after": after} {
+		repo, err := NewWithShards(config, shards)
+		require.NoError(t, err)
+		repos[name] = repo
+	}
+
+	// Instances of neighbour configs run together during deploys,
+	// every link is stored once whichever of them stores it first.
+	for i, pair := range [][2]string{{"before", "moving"}, {"moving", "before"}, {"moving", "after"}, {"after", "moving"}} {
+		first, second := repos[pair[0]], repos[pair[1]]
+
+		stored, err := first.Store(ctx, link(i))
+		require.NoError(t, err)
+		require.Equal(t, link(i), stored)
+
+		_, err = second.Store(ctx, domain.Link{OriginalURL: "https://ya.ru/" + strconv.Itoa(i), ShortenedURL: link(i).ShortenedURL})
+		require.ErrorIs(t, err, service.ErrExist, pair)
+		stored, err = second.Store(ctx, domain.Link{OriginalURL: link(i).OriginalURL, ShortenedURL: "new"})
+		require.NoError(t, err)
+		require.Equal(t, link(i), stored, pair)
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/amanakin/shortener/internal/domain"
 )
@@ -12,8 +13,39 @@ var (
 	ErrExist = errors.New("shortened URL exists")
 	// ErrNotFound is returned when URL is not found
 	ErrNotFound = errors.New("URL not found")
+	// ErrInvalidURL is returned when original URL can't be shortened.
+	ErrInvalidURL = errors.New("invalid URL")
+	// ErrURLTooLong is returned when original URL exceeds configured max length.
+	ErrURLTooLong = errors.New("URL is too long")
+	// ErrPoolEmpty is returned when there are no pre-generated shortened URLs.
+	ErrPoolEmpty = errors.New("slug pool is empty")
+	// ErrUnavailable is returned when storage is down, request may be retried later.
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrReadOnly is returned when links can't be stored, because service is in read-only mode.
+	ErrReadOnly = errors.New("service is read-only")
 )
 
+// MistypedError is returned when shortened URL has wrong check symbol,
+// Suggestion is existing shortened URL which was probably meant.
+// It matches ErrNotFound with errors.Is.
+type MistypedError struct {
+	Suggestion string
+}
+
+func (e *MistypedError) Error() string {
+	return fmt.Sprintf("%s, did you mean %q", ErrNotFound, e.Suggestion)
+}
+
+func (e *MistypedError) Unwrap() error {
+	return ErrNotFound
+}
+
+// HostResolver is implemented by shorteners which keep Unicode form of IDN hosts.
+type HostResolver interface {
+	// UnicodeHost returns Unicode host of original URL of shortened, ErrNotFound if it isn't kept.
+	UnicodeHost(ctx context.Context, shortened string) (string, error)
+}
+
 type Shortener interface {
 	// Shorten creates short URL from origin URL, and returns if already created
 	Shorten(ctx context.Context, original string) (domain.Link, bool, error)
@@ -0,0 +1,167 @@
+package adaptivegenerator
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// window is number of attempts collision rate is averaged over.
+const window = 100
+
+// Generator is generator of paths with fixed length.
+type Generator interface {
+	Generate(ctx context.Context, input string) (string, error)
+}
+
+// Factory creates generator of paths with given length.
+type Factory func(length int) (Generator, error)
+
+// LengthStats describes usage of paths with one length.
+type LengthStats struct {
+	Length   int     `json:"length"`
+	Keyspace float64 `json:"keyspace"`
+	// Stored is number of paths stored by this replica.
+	Stored     uint64 `json:"stored"`
+	Collisions uint64 `json:"collisions"`
+	// CollisionRate is moving average of collisions per attempt.
+	CollisionRate float64 `json:"collision_rate"`
+	// Occupancy is estimated part of keyspace in use.
+	// For random paths probability of collision equals to occupancy.
+	Occupancy float64 `json:"occupancy"`
+}
+
+// Stats describes state of AdaptiveGenerator.
+type Stats struct {
+	Length  int           `json:"length"`
+	Lengths []LengthStats `json:"lengths"`
+}
+
+// AdaptiveGenerator implements Generator interface.
+// It starts with minLen paths and moves to the next length when
+// collision rate of current length crosses threshold, up to maxLen.
+// Old shorter paths are still resolved, because repository looks paths up as is.
+type AdaptiveGenerator struct {
+	alphabetLen int
+	minLen      int
+	maxLen      int
+	threshold   float64
+	factory     Factory
+
+	mu      sync.Mutex
+	length  int
+	gens    map[int]Generator
+	lengths map[int]*LengthStats
+	tries   map[int]uint64
+}
+
+func New(factory Factory, alphabetLen, minLen, maxLen int, threshold float64) (*AdaptiveGenerator, error) {
+	if minLen < 1 || minLen > maxLen {
+		return nil, errors.New("min length must be in [1, max length]")
+	}
+	if threshold <= 0 || threshold >= 1 {
+		return nil, errors.New("threshold must be in (0, 1)")
+	}
+
+	return &AdaptiveGenerator{
+		alphabetLen: alphabetLen,
+		minLen:      minLen,
+		maxLen:      maxLen,
+		threshold:   threshold,
+		factory:     factory,
+		length:      minLen,
+		gens:        make(map[int]Generator),
+		lengths:     make(map[int]*LengthStats),
+		tries:       make(map[int]uint64),
+	}, nil
+}
+
+func (g *AdaptiveGenerator) Generate(ctx context.Context, input string) (string, error) {
+	g.mu.Lock()
+	gen, ok := g.gens[g.length]
+	if !ok {
+		var err error
+		gen, err = g.factory(g.length)
+		if err != nil {
+			g.mu.Unlock()
+			return "", fmt.Errorf("generator of %d-symbol paths: %w", g.length, err)
+		}
+		g.gens[g.length] = gen
+	}
+	g.mu.Unlock()
+
+	return gen.Generate(ctx, input)
+}
+
+// Observe is called with result of storing generated path.
+func (g *AdaptiveGenerator) Observe(path string, collided bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	length := len(path)
+	stats := g.stats(length)
+	g.tries[length]++
+
+	collision := 0.0
+	if collided {
+		stats.Collisions++
+		collision = 1
+	} else {
+		stats.Stored++
+	}
+
+	// Plain average until window is filled, then exponential moving average.
+	weight := 1 / math.Min(float64(g.tries[length]), window)
+	stats.CollisionRate += (collision - stats.CollisionRate) * weight
+
+	if length == g.length && length < g.maxLen &&
+		g.tries[length] >= window && stats.CollisionRate > g.threshold {
+		g.length++
+	}
+}
+
+// Length returns length of currently generated paths.
+func (g *AdaptiveGenerator) Length() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.length
+}
+
+func (g *AdaptiveGenerator) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	res := Stats{Length: g.length}
+	for length := g.minLen; length <= g.length; length++ {
+		stats := *g.stats(length)
+		stats.Occupancy = stats.CollisionRate
+		if lower := float64(stats.Stored) / stats.Keyspace; lower > stats.Occupancy {
+			stats.Occupancy = math.Min(lower, 1)
+		}
+		res.Lengths = append(res.Lengths, stats)
+	}
+	return res
+}
+
+// Metrics exposes Stats as expvar.
+func (g *AdaptiveGenerator) Metrics() expvar.Var {
+	return expvar.Func(func() any {
+		return g.Stats()
+	})
+}
+
+func (g *AdaptiveGenerator) stats(length int) *LengthStats {
+	stats, ok := g.lengths[length]
+	if !ok {
+		stats = &LengthStats{
+			Length:   length,
+			Keyspace: math.Pow(float64(g.alphabetLen), float64(length)),
+		}
+		g.lengths[length] = stats
+	}
+	return stats
+}
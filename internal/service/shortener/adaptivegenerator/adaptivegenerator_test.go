@@ -0,0 +1,96 @@
+package adaptivegenerator
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fixedGenerator struct {
+	length int
+}
+
+func (g fixedGenerator) Generate(_ context.Context, _ string) (string, error) {
+	return strings.Repeat("a", g.length), nil
+}
+
+func newGenerator(t *testing.T, minLen, maxLen int) *AdaptiveGenerator {
+	generator, err := New(func(length int) (Generator, error) {
+		return fixedGenerator{length: length}, nil
+	}, 10, minLen, maxLen, 0.5)
+	require.NoError(t, err)
+	return generator
+}
+
+func TestAdaptiveGenerator(t *testing.T) {
+	t.Run("starts with min length", func(t *testing.T) {
+		generator := newGenerator(t, 3, 5)
+
+		res, err := generator.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.Len(t, res, 3)
+	})
+
+	t.Run("grows when collision rate crosses threshold", func(t *testing.T) {
+		generator := newGenerator(t, 3, 5)
+
+		for i := 0; i < window; i++ {
+			generator.Observe("aaa", i%4 != 0)
+		}
+		require.Equal(t, 4, generator.Length())
+
+		res, err := generator.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.Len(t, res, 4)
+	})
+
+	t.Run("keeps length while collisions are rare", func(t *testing.T) {
+		generator := newGenerator(t, 3, 5)
+
+		for i := 0; i < 10*window; i++ {
+			generator.Observe("aaa", i%4 == 0)
+		}
+		require.Equal(t, 3, generator.Length())
+	})
+
+	t.Run("does not exceed max length", func(t *testing.T) {
+		generator := newGenerator(t, 3, 4)
+
+		for _, path := range []string{"aaa", "aaaa"} {
+			for i := 0; i < window; i++ {
+				generator.Observe(path, true)
+			}
+		}
+		require.Equal(t, 4, generator.Length())
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		generator := newGenerator(t, 3, 5)
+
+		for i := 0; i < window; i++ {
+			generator.Observe("aaa", i%4 != 0)
+		}
+
+		stats := generator.Stats()
+		require.Equal(t, 4, stats.Length)
+		require.Len(t, stats.Lengths, 2)
+		require.Equal(t, uint64(75), stats.Lengths[0].Collisions)
+		require.Equal(t, uint64(25), stats.Lengths[0].Stored)
+		require.InDelta(t, 0.75, stats.Lengths[0].Occupancy, 0.01)
+		require.Equal(t, float64(1000), stats.Lengths[0].Keyspace)
+
+		var decoded Stats
+		require.NoError(t, json.Unmarshal([]byte(generator.Metrics().String()), &decoded))
+		require.Equal(t, stats, decoded)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := New(nil, 2, 5, 3, 0.5)
+		require.Error(t, err)
+		_, err = New(nil, 2, 3, 5, 1.5)
+		require.Error(t, err)
+	})
+}
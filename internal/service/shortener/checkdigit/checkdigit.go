@@ -0,0 +1,125 @@
+// Package checkdigit appends check symbol to paths (Luhn mod N algorithm,
+// doubling is taken modulo N for odd N), so single mistyped symbol
+// and most swaps of adjacent symbols are detected.
+package checkdigit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// confusables are groups of symbols which are often mistaken for each other.
+var confusables = []string{
+	"0Oo", "1lIi|", "2Zz", "5Ss", "6Gb", "8B", "9gq", "uvUV", "cC", "kK", "mnM", "pP", "wW", "xX", "yY",
+}
+
+// Alphabet computes check symbols of paths in alphabet.
+type Alphabet struct {
+	symbols string
+	index   [256]int
+}
+
+func New(alphabet string) *Alphabet {
+	a := &Alphabet{symbols: alphabet}
+	for i := range a.index {
+		a.index[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		a.index[alphabet[i]] = i
+	}
+	return a
+}
+
+// Append returns path with check symbol, it fails if path has symbols not from alphabet.
+func (a *Alphabet) Append(path string) (string, error) {
+	sum, ok := a.sum(path, 2)
+	if !ok {
+		return "", fmt.Errorf("path %q has symbols not from alphabet", path)
+	}
+	n := len(a.symbols)
+	return path + string(a.symbols[(n-sum%n)%n]), nil
+}
+
+// Valid reports if last symbol of path is its check symbol.
+func (a *Alphabet) Valid(path string) bool {
+	if len(path) < 2 {
+		return false
+	}
+	sum, ok := a.sum(path, 1)
+	return ok && sum%len(a.symbols) == 0
+}
+
+// sum is Luhn mod N sum, factor is used for the last symbol.
+func (a *Alphabet) sum(path string, factor int) (int, bool) {
+	n := len(a.symbols)
+	sum := 0
+	for i := len(path) - 1; i >= 0; i-- {
+		code := a.index[path[i]]
+		if code < 0 {
+			return 0, false
+		}
+		addend := factor * code
+		if n%2 == 0 {
+			// Luhn mod N, symbol index is doubled and "digits" of result are summed.
+			addend = addend/n + addend%n
+		} else {
+			// Doubling modulo odd N already maps symbols one-to-one.
+			addend %= n
+		}
+		sum += addend
+		factor = 3 - factor
+	}
+	return sum, true
+}
+
+// Suggest returns valid paths which differ from mistyped path in one confusable symbol,
+// case of one symbol or in order of two adjacent symbols.
+func (a *Alphabet) Suggest(path string) []string {
+	seen := map[string]bool{path: true}
+	var suggestions []string
+	add := func(candidate string) {
+		if !seen[candidate] && a.Valid(candidate) {
+			suggestions = append(suggestions, candidate)
+		}
+		seen[candidate] = true
+	}
+
+	b := []byte(path)
+	for i, c := range b {
+		for _, alt := range a.alternatives(c) {
+			b[i] = alt
+			add(string(b))
+		}
+		b[i] = c
+	}
+
+	for i := 0; i+1 < len(b); i++ {
+		b[i], b[i+1] = b[i+1], b[i]
+		add(string(b))
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+
+	return suggestions
+}
+
+// alternatives returns symbols of alphabet which may be meant instead of c.
+func (a *Alphabet) alternatives(c byte) []byte {
+	var alts []byte
+	for _, group := range confusables {
+		if strings.IndexByte(group, c) < 0 {
+			continue
+		}
+		for i := 0; i < len(group); i++ {
+			if group[i] != c && a.index[group[i]] >= 0 {
+				alts = append(alts, group[i])
+			}
+		}
+	}
+
+	for _, alt := range []byte(strings.ToUpper(string(c)) + strings.ToLower(string(c))) {
+		if alt != c && a.index[alt] >= 0 {
+			alts = append(alts, alt)
+		}
+	}
+	return alts
+}
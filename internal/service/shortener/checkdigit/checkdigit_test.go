@@ -0,0 +1,68 @@
+package checkdigit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_"
+
+func TestAppendValid(t *testing.T) {
+	a := New(alphabet)
+
+	path, err := a.Append("mCMdDvvigK")
+	require.NoError(t, err)
+	require.Len(t, path, 11)
+	require.True(t, a.Valid(path))
+
+	_, err = a.Append("brave-otter")
+	require.Error(t, err)
+	require.False(t, a.Valid("x"))
+	require.False(t, a.Valid("a-b"))
+}
+
+func TestDetectsMistypes(t *testing.T) {
+	// Odd and even alphabet lengths use different doubling.
+	for _, symbols := range []string{alphabet, alphabet[:62]} {
+		a := New(symbols)
+		path, err := a.Append("mCMdDvvigK")
+		require.NoError(t, err)
+
+		// Every single symbol substitution is detected.
+		for i := 0; i < len(path); i++ {
+			for j := 0; j < len(symbols); j++ {
+				if symbols[j] == path[i] {
+					continue
+				}
+				mistyped := path[:i] + string(symbols[j]) + path[i+1:]
+				require.False(t, a.Valid(mistyped), mistyped)
+			}
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	a := New(alphabet)
+	path, err := a.Append("abcO1xyz")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		mistyped string
+	}{
+		{name: "confusable", mistyped: path[:3] + "0" + path[4:]},
+		{name: "case", mistyped: path[:1] + "B" + path[2:]},
+		{name: "swap", mistyped: path[:5] + string(path[6]) + string(path[5]) + path[7:]},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			require.False(t, a.Valid(tCase.mistyped))
+			require.Contains(t, a.Suggest(tCase.mistyped), path)
+			for _, suggestion := range a.Suggest(tCase.mistyped) {
+				require.True(t, a.Valid(suggestion))
+			}
+		})
+	}
+}
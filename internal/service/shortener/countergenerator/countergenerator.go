@@ -0,0 +1,191 @@
+package countergenerator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
+)
+
+// Type is name of generator in config.
+const Type = "counter"
+
+// DefaultRangeSize is number of IDs leased at once by default.
+const DefaultRangeSize = 1000
+
+// Options are counter generator options in config.
+type Options struct {
+	RangeSize uint64 `yaml:"range_size"`
+}
+
+func init() {
+	generator.Register(Type, func(params generator.Params, options generator.Options) (generator.Generator, error) {
+		opts := Options{RangeSize: DefaultRangeSize}
+		if err := options.Decode(&opts); err != nil {
+			return nil, err
+		}
+
+		alloc, ok := repository.As[Allocator](params.Repo)
+		if !ok {
+			return nil, fmt.Errorf("repository %T can't allocate IDs", params.Repo)
+		}
+		return New(alloc, params.Alphabet, params.ShortLen, opts.RangeSize)
+	})
+}
+
+// Allocator leases ranges of unique IDs, it is shared by all replicas.
+type Allocator interface {
+	// AllocateRange reserves size IDs and returns first of them, range is [start, start+size).
+	AllocateRange(ctx context.Context, size uint64) (uint64, error)
+}
+
+// IDs hands out unique IDs, they are leased by ranges from Allocator,
+// one lease per rangeSize IDs.
+type IDs struct {
+	alloc     Allocator
+	rangeSize uint64
+
+	mu   sync.Mutex
+	next uint64
+	end  uint64
+}
+
+func NewIDs(alloc Allocator, rangeSize uint64) (*IDs, error) {
+	if rangeSize == 0 {
+		return nil, errors.New("range size must be positive")
+	}
+
+	return &IDs{
+		alloc:     alloc,
+		rangeSize: rangeSize,
+	}, nil
+}
+
+// Next returns unique ID, IDs of one replica are increasing.
+func (i *IDs) Next(ctx context.Context) (uint64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.next == i.end {
+		start, err := i.alloc.AllocateRange(ctx, i.rangeSize)
+		if err != nil {
+			return 0, fmt.Errorf("allocate range: %w", err)
+		}
+		i.next, i.end = start, start+i.rangeSize
+	}
+
+	id := i.next
+	i.next++
+	return id, nil
+}
+
+// CounterGenerator implements Generator interface.
+// It encodes increasing IDs in bijective base-N, so generated paths never collide.
+type CounterGenerator struct {
+	ids      *IDs
+	alphabet []byte
+	offset   uint64
+}
+
+// New creates generator which paths are at least minLen long.
+func New(alloc Allocator, alphabet []byte, minLen int, rangeSize uint64) (*CounterGenerator, error) {
+	if len(alphabet) < 2 {
+		return nil, errors.New("alphabet must have at least 2 symbols")
+	}
+
+	offset, ok := Offset(len(alphabet), minLen)
+	if !ok {
+		return nil, fmt.Errorf("%d symbols of %d-symbol alphabet overflow uint64", minLen, len(alphabet))
+	}
+
+	ids, err := NewIDs(alloc, rangeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CounterGenerator{
+		ids:      ids,
+		alphabet: alphabet,
+		offset:   offset,
+	}, nil
+}
+
+func (g *CounterGenerator) Generate(ctx context.Context, _ string) (string, error) {
+	id, err := g.ids.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if id > math.MaxUint64-g.offset {
+		return "", fmt.Errorf("id %d overflows", id)
+	}
+	return Encode(g.alphabet, id+g.offset), nil
+}
+
+// Offset returns number of bijective base-N numerals shorter than minLen (including empty one),
+// it is 1 + N + N^2 + ... + N^(minLen-1). Returns false on overflow.
+func Offset(base, minLen int) (uint64, bool) {
+	var offset, pow uint64 = 1, 1
+	for i := 1; i < minLen; i++ {
+		hi, lo := bits.Mul64(pow, uint64(base))
+		if hi != 0 {
+			return 0, false
+		}
+		pow = lo
+		offset, hi = bits.Add64(offset, pow, 0)
+		if hi != 0 {
+			return 0, false
+		}
+	}
+	return offset, true
+}
+
+// Encode returns bijective base-N numeral of n (0 is the empty numeral).
+// There are no leading zero symbols, so every n has exactly one numeral.
+func Encode(alphabet []byte, n uint64) string {
+	base := uint64(len(alphabet))
+
+	var buf [64]byte
+	i := len(buf)
+	for n > 0 {
+		n--
+		i--
+		buf[i] = alphabet[n%base]
+		n /= base
+	}
+	return string(buf[i:])
+}
+
+// Decode is inverse of Encode, returns false if s has symbols out of alphabet or overflows.
+func Decode(alphabet []byte, s string) (uint64, bool) {
+	base := uint64(len(alphabet))
+
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		digit := -1
+		for j, c := range alphabet {
+			if c == s[i] {
+				digit = j
+				break
+			}
+		}
+		if digit < 0 {
+			return 0, false
+		}
+
+		hi, lo := bits.Mul64(n, base)
+		if hi != 0 {
+			return 0, false
+		}
+		n, hi = bits.Add64(lo, uint64(digit)+1, 0)
+		if hi != 0 {
+			return 0, false
+		}
+	}
+	return n, true
+}
@@ -0,0 +1,135 @@
+package countergenerator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type counterAllocator struct {
+	next  atomic.Uint64
+	calls atomic.Int64
+}
+
+func (a *counterAllocator) AllocateRange(_ context.Context, size uint64) (uint64, error) {
+	a.calls.Add(1)
+	return a.next.Add(size) - size, nil
+}
+
+func TestEncode(t *testing.T) {
+	alphabet := []byte("abc")
+
+	t.Run("bijective numerals", func(t *testing.T) {
+		expected := []string{"", "a", "b", "c", "aa", "ab", "ac", "ba", "bb", "bc", "ca", "cb", "cc", "aaa"}
+		for n, numeral := range expected {
+			require.Equal(t, numeral, Encode(alphabet, uint64(n)))
+
+			decoded, ok := Decode(alphabet, numeral)
+			require.True(t, ok)
+			require.Equal(t, uint64(n), decoded)
+		}
+	})
+
+	t.Run("unknown symbol", func(t *testing.T) {
+		_, ok := Decode(alphabet, "abd")
+		require.False(t, ok)
+	})
+}
+
+func TestCounterGenerator(t *testing.T) {
+	alphabet := []byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_")
+	length := 10
+
+	t.Run("min length and no collisions", func(t *testing.T) {
+		alloc := &counterAllocator{}
+		generator, err := New(alloc, alphabet, length, 100)
+		require.NoError(t, err)
+
+		first, err := generator.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.Equal(t, "0000000000", first)
+
+		generated := map[string]struct{}{first: {}}
+		N := 10000
+		for i := 1; i < N; i++ {
+			res, err := generator.Generate(context.Background(), "")
+			require.NoError(t, err)
+			require.Len(t, res, length)
+			if _, ok := generated[res]; ok {
+				t.Errorf("generated %s twice", res)
+			}
+			generated[res] = struct{}{}
+		}
+		require.Equal(t, int64(N/100), alloc.calls.Load())
+	})
+
+	t.Run("replicas share allocator", func(t *testing.T) {
+		alloc := &counterAllocator{}
+
+		var mu sync.Mutex
+		generated := make(map[string]struct{})
+
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			generator, err := New(alloc, alphabet, length, 7)
+			require.NoError(t, err)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					res, err := generator.Generate(context.Background(), "")
+					require.NoError(t, err)
+
+					mu.Lock()
+					if _, ok := generated[res]; ok {
+						t.Errorf("generated %s twice", res)
+					}
+					generated[res] = struct{}{}
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("grows after min length is exhausted", func(t *testing.T) {
+		alloc := &counterAllocator{}
+		generator, err := New(alloc, []byte("ab"), 2, 10)
+		require.NoError(t, err)
+
+		var res []string
+		for i := 0; i < 6; i++ {
+			slug, err := generator.Generate(context.Background(), "")
+			require.NoError(t, err)
+			res = append(res, slug)
+		}
+		require.Equal(t, []string{"aa", "ab", "ba", "bb", "aaa", "aab"}, res)
+	})
+
+	t.Run("allocator error", func(t *testing.T) {
+		errAlloc := errors.New("db is down")
+		generator, err := New(allocatorFunc(func(context.Context, uint64) (uint64, error) {
+			return 0, errAlloc
+		}), alphabet, length, 10)
+		require.NoError(t, err)
+
+		_, err = generator.Generate(context.Background(), "")
+		require.ErrorIs(t, err, errAlloc)
+	})
+
+	t.Run("too long min length", func(t *testing.T) {
+		_, err := New(&counterAllocator{}, alphabet, 12, 10)
+		require.Error(t, err)
+	})
+}
+
+type allocatorFunc func(ctx context.Context, size uint64) (uint64, error)
+
+func (f allocatorFunc) AllocateRange(ctx context.Context, size uint64) (uint64, error) {
+	return f(ctx, size)
+}
@@ -0,0 +1,175 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/amanakin/shortener/internal/repository"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxShortLen is max length of paths, it's limited by storage.
+const MaxShortLen = 255
+
+// Unambiguous is name of alphabet preset without symbols
+// which are easily confused when read or typed: 0, O, o, 1, I, l, i.
+const Unambiguous = "unambiguous"
+
+var alphabets = map[string]string{
+	Unambiguous: "23456789abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ",
+}
+
+// Alphabet returns symbols of alphabet preset, other alphabets are returned as is.
+func Alphabet(alphabet string) string {
+	if symbols, ok := alphabets[alphabet]; ok {
+		return symbols
+	}
+	return alphabet
+}
+
+// Generator generates paths for original URLs.
+type Generator interface {
+	Generate(ctx context.Context, input string) (string, error)
+}
+
+// Keyspacer is implemented by generators which know number of different paths they make.
+type Keyspacer interface {
+	Keyspace() float64
+}
+
+// Params are common for all generators.
+type Params struct {
+	Alphabet []byte
+	ShortLen int
+	// Repo is storage of links, generators may require it to implement extra interfaces.
+	Repo repository.ShortenerRepo
+}
+
+// Options are type-specific options, see Config.
+type Options struct {
+	node *yaml.Node
+}
+
+// Decode decodes options into v, fields missing in config keep their values.
+func (o Options) Decode(v any) error {
+	if o.node == nil {
+		return nil
+	}
+	return o.node.Decode(v)
+}
+
+// Config is generator config block, type-specific options are next to type:
+//
+//	generator:
+//	  type: sqids
+//	  key: secret
+//
+// Short form "generator: hash" is also allowed.
+type Config struct {
+	Type    string
+	Options Options
+}
+
+func (c *Config) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Type = node.Value
+		c.Options = Options{}
+		return nil
+	}
+
+	var typed struct {
+		Type string `yaml:"type"`
+	}
+	if err := node.Decode(&typed); err != nil {
+		return err
+	}
+
+	c.Type = typed.Type
+	c.Options = Options{node: node}
+	return nil
+}
+
+// Factory creates generator of registered type.
+type Factory func(params Params, options Options) (Generator, error)
+
+var (
+	factories = make(map[string]Factory)
+	mu        sync.RWMutex
+)
+
+// Register makes generator type available by name.
+// It is intended to be called from init functions, it panics if name is registered twice.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("generator %q is registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// Types returns sorted names of registered generators.
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	types := make([]string, 0, len(factories))
+	for name := range factories {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New creates generator of config.Type.
+func New(config Config, params Params) (Generator, error) {
+	mu.RLock()
+	factory, ok := factories[config.Type]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q, registered are %v", config.Type, Types())
+	}
+
+	gen, err := factory(params, config.Options)
+	if err != nil {
+		return nil, fmt.Errorf("%s generator: %w", config.Type, err)
+	}
+	return gen, nil
+}
+
+// ValidateParams checks that alphabet has at least 2 unique symbols
+// and short length is in [1, MaxShortLen].
+func ValidateParams(params Params) error {
+	if len(params.Alphabet) < 2 {
+		return errors.New("alphabet must have at least 2 symbols")
+	}
+
+	var seen [256]bool
+	for _, c := range params.Alphabet {
+		if seen[c] {
+			return fmt.Errorf("symbol %q repeats in alphabet", c)
+		}
+		seen[c] = true
+	}
+
+	if params.ShortLen < 1 || params.ShortLen > MaxShortLen {
+		return fmt.Errorf("short length %d is out of [1, %d]", params.ShortLen, MaxShortLen)
+	}
+
+	return nil
+}
+
+// Keyspace returns number of different paths of generator.
+// If generator doesn't know it, it's estimated as len(alphabet)^shortLen.
+func Keyspace(gen Generator, params Params) float64 {
+	if keyspacer, ok := gen.(Keyspacer); ok {
+		return keyspacer.Keyspace()
+	}
+	return math.Pow(float64(len(params.Alphabet)), float64(params.ShortLen))
+}
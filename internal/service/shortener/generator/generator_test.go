@@ -0,0 +1,115 @@
+package generator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type fixedGenerator struct {
+	path string
+}
+
+func (g fixedGenerator) Generate(context.Context, string) (string, error) {
+	return g.path, nil
+}
+
+func TestConfigUnmarshal(t *testing.T) {
+	cases := []struct {
+		name    string
+		raw     string
+		typ     string
+		options map[string]any
+	}{
+		{name: "short form", raw: "generator: hash", typ: "hash"},
+		{name: "block", raw: "generator:\n  type: random\n", typ: "random", options: map[string]any{"type": "random"}},
+		{
+			name:    "block with options",
+			raw:     "generator:\n  type: sqids\n  key: secret\n  range_size: 10\n",
+			typ:     "sqids",
+			options: map[string]any{"type": "sqids", "key": "secret", "range_size": 10},
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			var config struct {
+				Generator Config `yaml:"generator"`
+			}
+			require.NoError(t, yaml.Unmarshal([]byte(tCase.raw), &config))
+			require.Equal(t, tCase.typ, config.Generator.Type)
+
+			var options map[string]any
+			require.NoError(t, config.Generator.Options.Decode(&options))
+			require.Equal(t, tCase.options, options)
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	const name = "test-fixed"
+
+	Register(name, func(params Params, options Options) (Generator, error) {
+		opts := struct {
+			Path string `yaml:"path"`
+		}{Path: "default"}
+		if err := options.Decode(&opts); err != nil {
+			return nil, err
+		}
+		return fixedGenerator{path: opts.Path}, nil
+	})
+	require.Contains(t, Types(), name)
+	require.Panics(t, func() {
+		Register(name, nil)
+	})
+
+	var config Config
+	require.NoError(t, yaml.Unmarshal([]byte("type: test-fixed\npath: abc\n"), &config))
+
+	gen, err := New(config, Params{})
+	require.NoError(t, err)
+	path, err := gen.Generate(context.Background(), "")
+	require.NoError(t, err)
+	require.Equal(t, "abc", path)
+
+	gen, err = New(Config{Type: name}, Params{})
+	require.NoError(t, err)
+	path, err = gen.Generate(context.Background(), "")
+	require.NoError(t, err)
+	require.Equal(t, "default", path)
+
+	_, err = New(Config{Type: "unknown"}, Params{})
+	require.Error(t, err)
+}
+
+func TestValidateParams(t *testing.T) {
+	cases := []struct {
+		name   string
+		params Params
+		valid  bool
+	}{
+		{name: "valid", params: Params{Alphabet: []byte("abc"), ShortLen: 5}, valid: true},
+		{name: "one symbol", params: Params{Alphabet: []byte("a"), ShortLen: 5}, valid: false},
+		{name: "repeated symbol", params: Params{Alphabet: []byte("abca"), ShortLen: 5}, valid: false},
+		{name: "zero length", params: Params{Alphabet: []byte("abc"), ShortLen: 0}, valid: false},
+		{name: "too long", params: Params{Alphabet: []byte("abc"), ShortLen: MaxShortLen + 1}, valid: false},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			err := ValidateParams(tCase.params)
+			if tCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestKeyspace(t *testing.T) {
+	params := Params{Alphabet: []byte("0123456789"), ShortLen: 3}
+	require.Equal(t, 1000.0, Keyspace(fixedGenerator{}, params))
+}
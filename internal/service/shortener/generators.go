@@ -0,0 +1,91 @@
+package shortener
+
+import (
+	"fmt"
+
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service/shortener/adaptivegenerator"
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
+	"github.com/amanakin/shortener/internal/service/shortener/hashgenerator"
+	"github.com/amanakin/shortener/internal/service/shortener/poolgenerator"
+	"github.com/amanakin/shortener/internal/service/shortener/randgenerator"
+
+	// Built-in generators, they register themselves.
+	_ "github.com/amanakin/shortener/internal/service/shortener/countergenerator"
+	_ "github.com/amanakin/shortener/internal/service/shortener/sqidsgenerator"
+	_ "github.com/amanakin/shortener/internal/service/shortener/wordsgenerator"
+)
+
+// generatorConfig returns config.Generator, falling back to deprecated HashGenerator.
+func generatorConfig(config Config) generator.Config {
+	if config.Generator.Type != "" {
+		return config.Generator
+	}
+
+	if config.HashGenerator {
+		return generator.Config{Type: hashgenerator.Type}
+	}
+	return generator.Config{Type: randgenerator.Type}
+}
+
+// newGenerator creates generator of registered type, wrapped into adaptive length
+// and slug pool generators if they're enabled.
+func newGenerator(repo repository.ShortenerRepo, config Config) (Generator, error) {
+	genConfig := generatorConfig(config)
+	params := generator.Params{
+		Alphabet: []byte(config.Alphabet),
+		ShortLen: config.ShortLen,
+		Repo:     repo,
+	}
+
+	if err := generator.ValidateParams(params); err != nil {
+		return nil, err
+	}
+
+	gen, err := generator.New(genConfig, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyspace := generator.Keyspace(gen, params); keyspace < config.MinKeyspace {
+		return nil, fmt.Errorf("%s generator makes %.0f paths, less than min keyspace %.0f",
+			genConfig.Type, keyspace, config.MinKeyspace)
+	}
+
+	if config.AdaptiveLength {
+		gen, err = newAdaptiveGenerator(genConfig, params, config)
+		if err != nil {
+			return nil, fmt.Errorf("adaptive length: %w", err)
+		}
+	}
+
+	if !config.SlugPool.Enabled {
+		return gen, nil
+	}
+
+	pool, ok := repository.As[poolgenerator.Pool](repo)
+	if !ok {
+		return nil, fmt.Errorf("repository %T has no slug pool", repo)
+	}
+	// Separate generator of configured type, so counters of filler and fallback lease their own IDs.
+	filler, err := generator.New(genConfig, params)
+	if err != nil {
+		return nil, err
+	}
+	return poolgenerator.New(pool, filler, gen, config.SlugPool)
+}
+
+func newAdaptiveGenerator(genConfig generator.Config, params generator.Params, config Config) (Generator, error) {
+	if config.MinShortLen < 1 || config.MinShortLen > params.ShortLen {
+		return nil, fmt.Errorf("min short length %d is out of [1, %d]", config.MinShortLen, params.ShortLen)
+	}
+
+	factory := func(length int) (adaptivegenerator.Generator, error) {
+		lengthParams := params
+		lengthParams.ShortLen = length
+		return generator.New(genConfig, lengthParams)
+	}
+
+	return adaptivegenerator.New(factory, len(params.Alphabet),
+		config.MinShortLen, params.ShortLen, config.AdaptiveThreshold)
+}
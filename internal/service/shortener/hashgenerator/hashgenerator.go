@@ -1,11 +1,23 @@
 package hashgenerator
 
 import (
+	"context"
 	"crypto/sha256"
 	"math/big"
 	"strings"
+
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
 )
 
+// Type is name of generator in config.
+const Type = "hash"
+
+func init() {
+	generator.Register(Type, func(params generator.Params, _ generator.Options) (generator.Generator, error) {
+		return New(params.Alphabet, params.ShortLen), nil
+	})
+}
+
 // HashGenerator implements more secure Generator interface.
 // Translates SHA256 hash if input to alphabet based string.
 type HashGenerator struct {
@@ -20,7 +32,7 @@ func New(alphabet []byte, shortLen int) *HashGenerator {
 	}
 }
 
-func (g *HashGenerator) Generate(input string) string {
+func (g *HashGenerator) Generate(_ context.Context, input string) (string, error) {
 	hash := sha256.New()
 	hash.Write([]byte(input))
 	hashed := hash.Sum(nil)
@@ -41,5 +53,5 @@ func (g *HashGenerator) Generate(input string) string {
 		sb.WriteByte(g.alphabet[0])
 	}
 
-	return sb.String()
+	return sb.String(), nil
 }
@@ -1,6 +1,7 @@
 package hashgenerator
 
 import (
+	"context"
 	"math/rand"
 	"testing"
 
@@ -13,8 +14,10 @@ func TestHashGenerator(t *testing.T) {
 	generator := New([]byte("abcdefghijklmnopqrstuvwxyz"), length)
 
 	t.Run("same result", func(t *testing.T) {
-		res1 := generator.Generate("https://golang.org")
-		res2 := generator.Generate("https://golang.org")
+		res1, err := generator.Generate(context.Background(), "https://golang.org")
+		require.NoError(t, err)
+		res2, err := generator.Generate(context.Background(), "https://golang.org")
+		require.NoError(t, err)
 
 		require.Equal(t, res1, res2)
 		require.Equal(t, length, len(res1))
@@ -32,7 +35,8 @@ func TestHashGenerator(t *testing.T) {
 				input[j] = alphabet[r.Intn(len(alphabet))]
 			}
 
-			res := generator.Generate(string(input))
+			res, err := generator.Generate(context.Background(), string(input))
+			require.NoError(t, err)
 			if _, ok := generated[res]; ok {
 				t.Errorf("generated %s twice", res)
 			}
@@ -0,0 +1,160 @@
+package homograph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+)
+
+// Result describes host check.
+type Result struct {
+	Suspicious bool
+	// Reason is human-readable explanation, empty if host is not suspicious.
+	Reason string
+	// LooksLike is latin look-alike of host, empty if there's no such.
+	LooksLike string
+}
+
+// scripts are checked for every rune, Common and Inherited (digits, hyphen, marks) are skipped.
+var scripts = []string{
+	"Latin", "Cyrillic", "Greek", "Armenian", "Hebrew", "Arabic", "Georgian",
+	"Han", "Hiragana", "Katakana", "Hangul", "Bopomofo", "Thai", "Devanagari",
+}
+
+// allowedMixes are script sets which are commonly mixed in one label (UTS #39 highly restrictive).
+var allowedMixes = [][]string{
+	{"Han", "Hiragana", "Katakana", "Latin"},
+	{"Bopomofo", "Han", "Latin"},
+	{"Han", "Hangul", "Latin"},
+}
+
+// confusables maps non-latin letters to latin letters which look the same.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k',
+	'ӏ': 'l', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'у': 'y', 'ԝ': 'w', 'х': 'x',
+	'ь': 'b',
+	// Greek
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u',
+	'χ': 'x', 'ϲ': 'c', 'ϳ': 'j',
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'հ': 'h', 'ո': 'n', 'զ': 'q',
+}
+
+// Unicode returns Unicode form of host, it should be used to show host to humans.
+func Unicode(host string) string {
+	unicodeHost, err := idna.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+	return unicodeHost
+}
+
+// Check looks for mixed-script and whole-script confusable labels in host.
+// Host may be in Unicode or ASCII (punycode) form.
+func Check(host string) Result {
+	unicodeHost := Unicode(host)
+
+	var reasons []string
+	suspicious := false
+	lookalike := make([]string, 0, strings.Count(unicodeHost, ".")+1)
+
+	for _, label := range strings.Split(unicodeHost, ".") {
+		labelScripts := labelScripts(label)
+		skeleton, confusable := skeleton(label)
+		lookalike = append(lookalike, skeleton)
+
+		switch {
+		case len(labelScripts) > 1 && !allowedMix(labelScripts):
+			suspicious = true
+			reasons = append(reasons, fmt.Sprintf("label %q mixes scripts %s",
+				label, strings.Join(labelScripts, ", ")))
+		case len(labelScripts) == 1 && labelScripts[0] != "Latin" && confusable:
+			suspicious = true
+			reasons = append(reasons, fmt.Sprintf("label %q is written in %s but looks like latin %q",
+				label, labelScripts[0], skeleton))
+		}
+	}
+
+	if !suspicious {
+		return Result{}
+	}
+
+	res := Result{
+		Suspicious: true,
+		Reason:     strings.Join(reasons, "; "),
+	}
+	if looksLike := strings.Join(lookalike, "."); looksLike != unicodeHost {
+		res.LooksLike = looksLike
+	}
+	return res
+}
+
+// labelScripts returns sorted scripts used in label.
+func labelScripts(label string) []string {
+	used := make(map[string]struct{})
+	for _, r := range label {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, name := range scripts {
+			if unicode.Is(unicode.Scripts[name], r) {
+				used[name] = struct{}{}
+				break
+			}
+		}
+	}
+
+	res := make([]string, 0, len(used))
+	for name := range used {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// skeleton replaces confusable letters with latin ones.
+// Returns true if every letter of label is latin or confusable with latin.
+func skeleton(label string) (string, bool) {
+	var sb strings.Builder
+	allConfusable := true
+	for _, r := range label {
+		if latin, ok := confusables[r]; ok {
+			sb.WriteRune(latin)
+			continue
+		}
+		if unicode.IsLetter(r) && !unicode.Is(unicode.Latin, r) {
+			allConfusable = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), allConfusable
+}
+
+func allowedMix(labelScripts []string) bool {
+	for _, mix := range allowedMixes {
+		if subset(labelScripts, mix) {
+			return true
+		}
+	}
+	return false
+}
+
+func subset(sub, set []string) bool {
+	for _, s := range sub {
+		found := false
+		for _, v := range set {
+			if s == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package homograph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name       string
+		host       string
+		suspicious bool
+		looksLike  string
+	}{
+		{
+			name:       "latin host",
+			host:       "paypal.com",
+			suspicious: false,
+		},
+		{
+			name:       "cyrillic a in latin label",
+			host:       "pаypal.com",
+			suspicious: true,
+			looksLike:  "paypal.com",
+		},
+		{
+			name:       "punycode of mixed label",
+			host:       "xn--pypal-4ve.com",
+			suspicious: true,
+			looksLike:  "paypal.com",
+		},
+		{
+			name:       "whole-script cyrillic confusable",
+			host:       "аррӏе.com",
+			suspicious: true,
+			looksLike:  "apple.com",
+		},
+		{
+			name:       "cyrillic host",
+			host:       "пример.рф",
+			suspicious: false,
+		},
+		{
+			name:       "japanese mix",
+			host:       "ドメイン名例jp.com",
+			suspicious: false,
+		},
+		{
+			name:       "digits and hyphens",
+			host:       "my-site-42.com",
+			suspicious: false,
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			res := Check(tCase.host)
+			require.Equal(t, tCase.suspicious, res.Suspicious, res.Reason)
+			require.Equal(t, tCase.looksLike, res.LooksLike)
+			if tCase.suspicious {
+				require.NotEmpty(t, res.Reason)
+			}
+		})
+	}
+}
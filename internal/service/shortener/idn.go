@@ -0,0 +1,68 @@
+package shortener
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile maps hosts like browsers do, but keeps underscores allowed.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// normalizeHost replaces host of rawURL with its ASCII (punycode) lower-case form.
+// Rest of rawURL is kept as is.
+func normalizeHost(rawURL string, u *url.URL) (string, error) {
+	hostname := u.Hostname()
+	if hostname == "" || net.ParseIP(hostname) != nil {
+		return rawURL, nil
+	}
+
+	asciiHost, err := idnaProfile.ToASCII(hostname)
+	if err != nil {
+		return "", fmt.Errorf("%w: host %q: %s", service.ErrInvalidURL, hostname, err)
+	}
+	if asciiHost == hostname {
+		return rawURL, nil
+	}
+
+	// Authority is between "scheme://" and first of "/?#", host is after userinfo.
+	authStart := strings.Index(rawURL, "://") + len("://")
+	authEnd := len(rawURL)
+	if i := strings.IndexAny(rawURL[authStart:], "/?#"); i >= 0 {
+		authEnd = authStart + i
+	}
+	hostStart := authStart
+	if i := strings.LastIndex(rawURL[authStart:authEnd], "@"); i >= 0 {
+		hostStart = authStart + i + 1
+	}
+	hostEnd := authEnd
+	if port := u.Port(); port != "" {
+		hostEnd -= len(":" + port)
+	}
+
+	return rawURL[:hostStart] + asciiHost + rawURL[hostEnd:], nil
+}
+
+// unicodeHost returns Unicode form of IDN host of normalized URL, or empty string
+// if host has no punycode labels.
+func unicodeHost(normalized string) string {
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return ""
+	}
+	hostname := u.Hostname()
+	unicode, err := idnaProfile.ToUnicode(hostname)
+	if err != nil || unicode == hostname {
+		return ""
+	}
+	return unicode
+}
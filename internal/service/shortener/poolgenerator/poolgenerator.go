@@ -0,0 +1,181 @@
+package poolgenerator
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/amanakin/shortener/internal/service"
+	"golang.org/x/exp/slog"
+)
+
+// Pool keeps pre-generated paths which are not used by links.
+type Pool interface {
+	// FillPool adds paths which are neither used by links nor in pool, returns number of added.
+	FillPool(ctx context.Context, paths []string) (int, error)
+	// ClaimSlug atomically takes one path from pool.
+	// If pool is empty it must return service.ErrPoolEmpty.
+	ClaimSlug(ctx context.Context) (string, error)
+	// PoolSize returns number of paths in pool.
+	PoolSize(ctx context.Context) (int, error)
+}
+
+// Generator is generator used to fill pool and when pool is empty.
+type Generator interface {
+	Generate(ctx context.Context, input string) (string, error)
+}
+
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// LowWatermark is pool size which triggers refill.
+	LowWatermark int `yaml:"low_watermark"`
+	// BatchSize is number of paths added by one insert.
+	BatchSize int `yaml:"batch_size"`
+	// Size is pool size reached by refill.
+	Size int `yaml:"size"`
+	// Interval is period of pool size checks besides ones triggered by claims.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// PoolGenerator implements Generator interface.
+// It takes paths pre-generated by background filler (see Run), so generation
+// and collision handling are off the request path. If pool runs dry,
+// it generates paths inline with fallback generator.
+type PoolGenerator struct {
+	pool     Pool
+	filler   Generator
+	fallback Generator
+	config   Config
+
+	refill chan struct{}
+
+	metrics   *expvar.Map
+	claimed   *expvar.Int
+	fallbacks *expvar.Int
+	filled    *expvar.Int
+	size      *expvar.Int
+}
+
+// New creates generator, filler must generate paths independent of input (e.g. random).
+func New(pool Pool, filler, fallback Generator, config Config) (*PoolGenerator, error) {
+	if config.BatchSize <= 0 || config.Size <= 0 {
+		return nil, errors.New("batch size and pool size must be positive")
+	}
+	if config.LowWatermark < 0 || config.LowWatermark >= config.Size {
+		return nil, errors.New("low watermark must be in [0, pool size)")
+	}
+	if config.Interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+
+	g := &PoolGenerator{
+		pool:      pool,
+		filler:    filler,
+		fallback:  fallback,
+		config:    config,
+		refill:    make(chan struct{}, 1),
+		metrics:   new(expvar.Map).Init(),
+		claimed:   new(expvar.Int),
+		fallbacks: new(expvar.Int),
+		filled:    new(expvar.Int),
+		size:      new(expvar.Int),
+	}
+	g.metrics.Set("claimed", g.claimed)
+	g.metrics.Set("fallbacks", g.fallbacks)
+	g.metrics.Set("filled", g.filled)
+	g.metrics.Set("size", g.size)
+
+	return g, nil
+}
+
+func (g *PoolGenerator) Generate(ctx context.Context, input string) (string, error) {
+	path, err := g.pool.ClaimSlug(ctx)
+	if err == nil {
+		g.claimed.Add(1)
+		g.size.Add(-1)
+		if g.size.Value() < int64(g.config.LowWatermark) {
+			g.triggerRefill()
+		}
+		return path, nil
+	}
+
+	if !errors.Is(err, service.ErrPoolEmpty) {
+		slog.Warn("claim slug from pool", slog.String("error", err.Error()))
+	}
+	g.fallbacks.Add(1)
+	g.triggerRefill()
+
+	return g.fallback.Generate(ctx, input)
+}
+
+func (g *PoolGenerator) triggerRefill() {
+	select {
+	case g.refill <- struct{}{}:
+	default:
+	}
+}
+
+// Run fills pool up to configured size, when it's below low watermark.
+// It blocks until ctx is done.
+func (g *PoolGenerator) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := g.Fill(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("fill slug pool", slog.String("error", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-g.refill:
+		}
+	}
+}
+
+// Fill adds paths to pool if it's below low watermark.
+func (g *PoolGenerator) Fill(ctx context.Context) error {
+	size, err := g.pool.PoolSize(ctx)
+	if err != nil {
+		return fmt.Errorf("pool size: %w", err)
+	}
+	g.size.Set(int64(size))
+	if size >= g.config.LowWatermark {
+		return nil
+	}
+
+	for size < g.config.Size {
+		batch := make([]string, 0, g.config.BatchSize)
+		for len(batch) < cap(batch) && size+len(batch) < g.config.Size {
+			path, err := g.filler.Generate(ctx, "")
+			if err != nil {
+				return fmt.Errorf("generate: %w", err)
+			}
+			batch = append(batch, path)
+		}
+
+		added, err := g.pool.FillPool(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("fill pool: %w", err)
+		}
+		g.filled.Add(int64(added))
+		size += added
+		g.size.Set(int64(size))
+
+		// Every path collides, keyspace is exhausted, retrying won't help.
+		if added == 0 {
+			return errors.New("no unused paths generated")
+		}
+	}
+
+	return nil
+}
+
+// Metrics returns claimed, fallbacks, filled counters and pool size.
+func (g *PoolGenerator) Metrics() expvar.Var {
+	return g.metrics
+}
@@ -0,0 +1,153 @@
+package poolgenerator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+type memPool struct {
+	mu    sync.Mutex
+	paths []string
+	used  map[string]struct{}
+}
+
+func (p *memPool) FillPool(_ context.Context, paths []string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	added := 0
+	for _, path := range paths {
+		if _, ok := p.used[path]; ok {
+			continue
+		}
+		p.used[path] = struct{}{}
+		p.paths = append(p.paths, path)
+		added++
+	}
+	return added, nil
+}
+
+func (p *memPool) ClaimSlug(_ context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.paths) == 0 {
+		return "", service.ErrPoolEmpty
+	}
+	path := p.paths[0]
+	p.paths = p.paths[1:]
+	return path, nil
+}
+
+func (p *memPool) PoolSize(_ context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.paths), nil
+}
+
+type seqGenerator struct {
+	mu     sync.Mutex
+	prefix string
+	n      int
+}
+
+func (g *seqGenerator) Generate(_ context.Context, _ string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.n++
+	return fmt.Sprintf("%s%d", g.prefix, g.n), nil
+}
+
+func newPoolGenerator(t *testing.T, pool Pool) *PoolGenerator {
+	generator, err := New(pool, &seqGenerator{prefix: "pool"}, &seqGenerator{prefix: "inline"}, Config{
+		LowWatermark: 5,
+		BatchSize:    4,
+		Size:         10,
+		Interval:     time.Hour,
+	})
+	require.NoError(t, err)
+	return generator
+}
+
+func TestPoolGenerator(t *testing.T) {
+	t.Run("fallback when pool is empty", func(t *testing.T) {
+		generator := newPoolGenerator(t, &memPool{used: make(map[string]struct{})})
+
+		path, err := generator.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.Equal(t, "inline1", path)
+		require.Equal(t, "1", generator.fallbacks.String())
+	})
+
+	t.Run("fill up to size and claim", func(t *testing.T) {
+		pool := &memPool{used: make(map[string]struct{})}
+		generator := newPoolGenerator(t, pool)
+
+		require.NoError(t, generator.Fill(context.Background()))
+		size, err := pool.PoolSize(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 10, size)
+
+		path, err := generator.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.Equal(t, "pool1", path)
+		require.Equal(t, "1", generator.claimed.String())
+		require.Equal(t, "10", generator.filled.String())
+	})
+
+	t.Run("no refill above low watermark", func(t *testing.T) {
+		pool := &memPool{used: make(map[string]struct{})}
+		generator := newPoolGenerator(t, pool)
+
+		_, err := pool.FillPool(context.Background(), []string{"a", "b", "c", "d", "e"})
+		require.NoError(t, err)
+		require.NoError(t, generator.Fill(context.Background()))
+
+		size, err := pool.PoolSize(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 5, size)
+	})
+
+	t.Run("background refill after claims", func(t *testing.T) {
+		pool := &memPool{used: make(map[string]struct{})}
+		generator := newPoolGenerator(t, pool)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			generator.Run(ctx)
+			close(done)
+		}()
+
+		require.Eventually(t, func() bool {
+			size, _ := pool.PoolSize(context.Background())
+			return size == 10
+		}, time.Second, time.Millisecond)
+
+		for i := 0; i < 6; i++ {
+			_, err := generator.Generate(context.Background(), "")
+			require.NoError(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			size, _ := pool.PoolSize(context.Background())
+			return size == 10
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		<-done
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := New(nil, nil, nil, Config{LowWatermark: 10, BatchSize: 1, Size: 10, Interval: time.Second})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,87 @@
+// Package profanity finds denied words in generated paths.
+package profanity
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed deny.txt
+var denyList string
+
+// Default returns embedded deny list.
+func Default() []string {
+	return ParseList(denyList)
+}
+
+// ParseList parses list of words, one per line, '#' starts comment.
+func ParseList(list string) []string {
+	var words []string
+	for _, line := range strings.Split(list, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			words = append(words, line)
+		}
+	}
+	return words
+}
+
+// Filter matches denied words as substrings, ignoring case, separators
+// and leetspeak, so "F_u-C|<" and "5h1t" are matched too.
+type Filter struct {
+	words []string
+}
+
+// New creates filter of denied words.
+func New(words []string) *Filter {
+	f := &Filter{}
+	for _, word := range words {
+		if folded := fold(word); folded != "" {
+			f.words = append(f.words, folded)
+		}
+	}
+	return f
+}
+
+// Match returns first denied word found in s.
+func (f *Filter) Match(s string) (string, bool) {
+	folded := fold(s)
+	for _, word := range f.words {
+		if strings.Contains(folded, word) {
+			return word, true
+		}
+	}
+	return "", false
+}
+
+// leet maps lookalike symbols to one letter, so both denied words
+// and checked strings are folded the same way.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i', 'l': 'i', '!': 'i', '|': 'i',
+	'2': 'z',
+	'3': 'e',
+	'4': 'a', '@': 'a',
+	'5': 's', '$': 's',
+	'6': 'g', '9': 'g',
+	'7': 't', '+': 't',
+	'8': 'b',
+}
+
+// fold lowercases s, replaces lookalike symbols and drops everything but letters.
+func fold(s string) string {
+	s = strings.ReplaceAll(strings.ToLower(s), "|<", "k")
+
+	var sb strings.Builder
+	for _, r := range s {
+		if mapped, ok := leet[r]; ok {
+			r = mapped
+		}
+		if r >= 'a' && r <= 'z' {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,35 @@
+package profanity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	filter := New([]string{"shit", "fuck"})
+
+	cases := []struct {
+		name    string
+		s       string
+		matched bool
+	}{
+		{name: "plain", s: "xxshitxx", matched: true},
+		{name: "upper", s: "aSHiTb", matched: true},
+		{name: "leetspeak", s: "5h1t", matched: true},
+		{name: "separators", s: "F_u-C|<", matched: true},
+		{name: "clean", s: "brave-otter-42", matched: false},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			_, matched := filter.Match(tCase.s)
+			require.Equal(t, tCase.matched, matched)
+		})
+	}
+}
+
+func TestParseList(t *testing.T) {
+	require.Equal(t, []string{"a", "b"}, ParseList("# header\na\n\n  b # comment\n"))
+	require.NotEmpty(t, Default())
+}
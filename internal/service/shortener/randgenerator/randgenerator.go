@@ -1,30 +1,89 @@
 package randgenerator
 
 import (
-	"math/rand"
-	"time"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"sync"
+
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
 )
 
+// Type is name of generator in config.
+const Type = "random"
+
+func init() {
+	generator.Register(Type, func(params generator.Params, _ generator.Options) (generator.Generator, error) {
+		return New(params.Alphabet, params.ShortLen), nil
+	})
+}
+
 // RandGenerator implements Generator interface.
-// It uses random to generate path.
+// It uses random to generate path, by default random is crypto/rand,
+// so paths can't be predicted. It is safe for concurrent use.
 type RandGenerator struct {
-	rand     *rand.Rand
+	src      io.Reader
 	alphabet []byte
 	shortLen int
+	// limit is the largest multiple of len(alphabet) not greater than 256,
+	// bytes not less than limit are rejected, so every symbol is equally likely.
+	limit int
 }
 
 func New(alphabet []byte, shortLen int) *RandGenerator {
+	return newGenerator(rand.Reader, alphabet, shortLen)
+}
+
+// NewSeeded creates deterministic generator, it should be used only in tests.
+func NewSeeded(alphabet []byte, shortLen int, seed int64) *RandGenerator {
+	return newGenerator(&lockedReader{r: mathrand.New(mathrand.NewSource(seed))}, alphabet, shortLen)
+}
+
+func newGenerator(src io.Reader, alphabet []byte, shortLen int) *RandGenerator {
 	return &RandGenerator{
-		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		src:      src,
 		alphabet: alphabet,
 		shortLen: shortLen,
+		limit:    256 - 256%len(alphabet),
 	}
 }
 
-func (p *RandGenerator) Generate(_ string) string {
+func (p *RandGenerator) Generate(_ context.Context, _ string) (string, error) {
 	b := make([]byte, p.shortLen)
-	for i := range b {
-		b[i] = p.alphabet[p.rand.Intn(len(p.alphabet))]
+	// Few more random bytes than needed, so rejected ones rarely cause second read.
+	buf := make([]byte, p.shortLen+p.shortLen/2+1)
+
+	for i := 0; i < len(b); {
+		if _, err := io.ReadFull(p.src, buf); err != nil {
+			return "", fmt.Errorf("read random: %w", err)
+		}
+
+		for _, r := range buf {
+			if int(r) >= p.limit {
+				continue
+			}
+			b[i] = p.alphabet[int(r)%len(p.alphabet)]
+			i++
+			if i == len(b) {
+				break
+			}
+		}
 	}
-	return string(b)
+
+	return string(b), nil
+}
+
+// lockedReader makes math/rand.Rand safe for concurrent use.
+type lockedReader struct {
+	mu sync.Mutex
+	r  *mathrand.Rand
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Read(p)
 }
@@ -1,7 +1,8 @@
 package randgenerator
 
 import (
-	"math/rand"
+	"context"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -9,18 +10,17 @@ import (
 
 func TestRandGenerator(t *testing.T) {
 	length := 10
+	alphabet := []byte("abcdefghijklmnopqrstuvwxyz")
+
 	t.Run("uniques", func(t *testing.T) {
 		generated := make(map[string]struct{})
 
-		generator := RandGenerator{
-			alphabet: []byte("abcdefghijklmnopqrstuvwxyz"),
-			shortLen: length,
-			rand:     rand.New(rand.NewSource(42)),
-		}
+		generator := NewSeeded(alphabet, length, 42)
 
 		N := 10000
 		for i := 0; i < N; i++ {
-			res := generator.Generate("")
+			res, err := generator.Generate(context.Background(), "")
+			require.NoError(t, err)
 			require.Equal(t, length, len(res))
 			if _, ok := generated[res]; ok {
 				t.Errorf("generated %s twice", res)
@@ -28,4 +28,103 @@ func TestRandGenerator(t *testing.T) {
 			generated[res] = struct{}{}
 		}
 	})
+
+	t.Run("seeded is deterministic", func(t *testing.T) {
+		first := NewSeeded(alphabet, length, 42)
+		second := NewSeeded(alphabet, length, 42)
+
+		for i := 0; i < 100; i++ {
+			res1, err := first.Generate(context.Background(), "")
+			require.NoError(t, err)
+			res2, err := second.Generate(context.Background(), "")
+			require.NoError(t, err)
+			require.Equal(t, res1, res2)
+		}
+	})
+
+	t.Run("no modulo bias", func(t *testing.T) {
+		// 100 symbols: with plain modulo first 56 symbols would be 1.5 times more frequent.
+		biased := make([]byte, 100)
+		for i := range biased {
+			biased[i] = byte(i)
+		}
+		generator := New(biased, 100)
+
+		counts := make([]int, len(biased))
+		N := 2000
+		for i := 0; i < N; i++ {
+			res, err := generator.Generate(context.Background(), "")
+			require.NoError(t, err)
+			for j := 0; j < len(res); j++ {
+				counts[res[j]]++
+			}
+		}
+
+		low, high := 0, 0
+		for i, count := range counts {
+			if i < 56 {
+				low += count
+			} else {
+				high += count
+			}
+		}
+		// Unbiased: 56% of symbols are low ones, biased: about 66%.
+		ratio := float64(low) / float64(low+high)
+		require.InDelta(t, 0.56, ratio, 0.02)
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		for _, generator := range []*RandGenerator{
+			New(alphabet, length),
+			NewSeeded(alphabet, length, 42),
+		} {
+			var mu sync.Mutex
+			generated := make(map[string]struct{})
+
+			var wg sync.WaitGroup
+			for g := 0; g < 32; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 500; i++ {
+						res, err := generator.Generate(context.Background(), "")
+						require.NoError(t, err)
+						require.Len(t, res, length)
+
+						mu.Lock()
+						if _, ok := generated[res]; ok {
+							t.Errorf("generated %s twice", res)
+						}
+						generated[res] = struct{}{}
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+		}
+	})
+}
+
+func BenchmarkRandGenerator(b *testing.B) {
+	alphabet := []byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_")
+
+	b.Run("crypto", func(b *testing.B) {
+		generator := New(alphabet, 10)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = generator.Generate(context.Background(), "")
+			}
+		})
+	})
+
+	b.Run("seeded", func(b *testing.B) {
+		generator := NewSeeded(alphabet, 10, 42)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = generator.Generate(context.Background(), "")
+			}
+		})
+	})
 }
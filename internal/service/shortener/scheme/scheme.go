@@ -0,0 +1,162 @@
+package scheme
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrDenied is returned for schemes which are never allowed, e.g. javascript.
+	ErrDenied = errors.New("scheme is denied")
+)
+
+// Validator checks URL of specific scheme.
+type Validator func(u *url.URL) error
+
+var (
+	validators = map[string]Validator{
+		"http":   RequireHost,
+		"https":  RequireHost,
+		"mailto": Mailto,
+		"tel":    Phone,
+		"sms":    Phone,
+		"geo":    Geo,
+
+		// Executed by browser in context of page or leak local files.
+		"javascript": Deny,
+		"vbscript":   Deny,
+		"data":       Deny,
+		"file":       Deny,
+		"blob":       Deny,
+	}
+	mu sync.RWMutex
+)
+
+// Register sets validator for scheme, it replaces previously registered one.
+// It is intended to be called from init functions.
+func Register(scheme string, v Validator) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	validators[strings.ToLower(scheme)] = v
+}
+
+// Validate checks URL with validator of its scheme.
+// Schemes without registered validator are checked by Default.
+func Validate(u *url.URL) error {
+	mu.RLock()
+	v, ok := validators[strings.ToLower(u.Scheme)]
+	mu.RUnlock()
+
+	if !ok {
+		v = Default
+	}
+	return v(u)
+}
+
+// IsDenied reports whether scheme is denied by its validator.
+func IsDenied(scheme string) bool {
+	return errors.Is(Validate(&url.URL{Scheme: scheme}), ErrDenied)
+}
+
+// IsWeb reports whether scheme is opened by browser itself.
+func IsWeb(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	return scheme == "http" || scheme == "https"
+}
+
+// Deny rejects any URL.
+func Deny(_ *url.URL) error {
+	return ErrDenied
+}
+
+// RequireHost allows URLs with non-empty host.
+func RequireHost(u *url.URL) error {
+	if u.Host == "" {
+		return errors.New("empty host")
+	}
+	return nil
+}
+
+// Default allows app schemes like myapp://path or myapp:path, something must follow the scheme.
+func Default(u *url.URL) error {
+	if u.Host == "" && u.Opaque == "" && strings.Trim(u.Path, "/") == "" {
+		return errors.New("empty URL after scheme")
+	}
+	return nil
+}
+
+// Mailto allows mailto:addr[,addr...][?headers] with valid addresses.
+func Mailto(u *url.URL) error {
+	if u.Host != "" || u.Opaque == "" {
+		return errors.New("mailto must be mailto:address")
+	}
+
+	to, err := url.PathUnescape(u.Opaque)
+	if err != nil {
+		return fmt.Errorf("unescape address: %w", err)
+	}
+
+	for _, addr := range strings.Split(to, ",") {
+		parsed, err := mail.ParseAddress(addr)
+		if err != nil || parsed.Name != "" {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+	}
+	return nil
+}
+
+// Phone allows tel:number and sms:number with E.164-like numbers,
+// visual separators and ;parameters (RFC 3966) are allowed.
+func Phone(u *url.URL) error {
+	if u.Host != "" || u.Opaque == "" {
+		return fmt.Errorf("%s must be %s:number", u.Scheme, u.Scheme)
+	}
+
+	number, _, _ := strings.Cut(u.Opaque, ";")
+	number = strings.TrimPrefix(number, "+")
+
+	digits := 0
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune("-.() ", r):
+		default:
+			return fmt.Errorf("invalid phone number %q", u.Opaque)
+		}
+	}
+
+	if digits < 3 || digits > 15 {
+		return fmt.Errorf("phone number %q must have 3-15 digits", u.Opaque)
+	}
+	return nil
+}
+
+// Geo allows geo:lat,lon[,alt][;params] (RFC 5870).
+func Geo(u *url.URL) error {
+	if u.Host != "" || u.Opaque == "" {
+		return errors.New("geo must be geo:lat,lon")
+	}
+
+	coords, _, _ := strings.Cut(u.Opaque, ";")
+	parts := strings.Split(coords, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return fmt.Errorf("invalid coordinates %q", coords)
+	}
+
+	limits := []float64{90, 180, math.MaxFloat64}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || math.IsNaN(v) || math.Abs(v) > limits[i] {
+			return fmt.Errorf("invalid coordinates %q", coords)
+		}
+	}
+	return nil
+}
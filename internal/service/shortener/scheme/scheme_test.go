@@ -0,0 +1,60 @@
+package scheme
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		rawURL string
+		valid  bool
+	}{
+		{name: "http with host", rawURL: "http://google.com", valid: true},
+		{name: "https without host", rawURL: "https:/path", valid: false},
+		{name: "mailto", rawURL: "mailto:john@example.com", valid: true},
+		{name: "mailto several with subject", rawURL: "mailto:a@example.com,b@example.com?subject=hi", valid: true},
+		{name: "mailto escaped", rawURL: "mailto:john%40example.com", valid: true},
+		{name: "mailto invalid address", rawURL: "mailto:john", valid: false},
+		{name: "mailto with slashes", rawURL: "mailto://john@example.com", valid: false},
+		{name: "tel", rawURL: "tel:+1-201-555-0123", valid: true},
+		{name: "tel with ext", rawURL: "tel:+1-201-555-0123;ext=42", valid: true},
+		{name: "tel with letters", rawURL: "tel:call-me", valid: false},
+		{name: "tel too short", rawURL: "tel:12", valid: false},
+		{name: "sms with body", rawURL: "sms:+15105550101?body=hello", valid: true},
+		{name: "geo", rawURL: "geo:37.786971,-122.399677", valid: true},
+		{name: "geo with altitude and params", rawURL: "geo:37.78,-122.39,10;u=35", valid: true},
+		{name: "geo out of range", rawURL: "geo:91,0", valid: false},
+		{name: "app scheme", rawURL: "myapp://open/item/42", valid: true},
+		{name: "app scheme opaque", rawURL: "myapp:item", valid: true},
+		{name: "app scheme empty", rawURL: "myapp://", valid: false},
+		{name: "javascript", rawURL: "javascript:alert(1)", valid: false},
+		{name: "data", rawURL: "data:text/html,hi", valid: false},
+		{name: "file", rawURL: "file:///etc/passwd", valid: false},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			u, err := url.Parse(tCase.rawURL)
+			require.NoError(t, err)
+
+			err = Validate(u)
+			if tCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestIsDenied(t *testing.T) {
+	require.True(t, IsDenied("javascript"))
+	require.True(t, IsDenied("JavaScript"))
+	require.True(t, IsDenied("data"))
+	require.False(t, IsDenied("https"))
+	require.False(t, IsDenied("myapp"))
+}
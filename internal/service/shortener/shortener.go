@@ -2,20 +2,53 @@ package shortener
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/amanakin/shortener/internal/domain"
 	"github.com/amanakin/shortener/internal/repository"
 	"github.com/amanakin/shortener/internal/service"
+	"github.com/amanakin/shortener/internal/service/shortener/checkdigit"
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
 	"github.com/amanakin/shortener/internal/service/shortener/hashgenerator"
-	"github.com/amanakin/shortener/internal/service/shortener/randgenerator"
+	"github.com/amanakin/shortener/internal/service/shortener/homograph"
+	"github.com/amanakin/shortener/internal/service/shortener/poolgenerator"
+	"github.com/amanakin/shortener/internal/service/shortener/profanity"
+	"github.com/amanakin/shortener/internal/service/shortener/wordsgenerator"
+	"golang.org/x/exp/slog"
 )
 
 const (
 	defaultAlphabet      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_"
 	defaultShortLen      = 10
 	defaultScheme        = "https"
+	defaultMaxURLLen     = 8192
 	defaultHashGenerator = true
+	defaultMinKeyspace   = 1e6
+	defaultMinShortLen   = 4
+	defaultThreshold     = 0.1
+	defaultHomograph     = HomographFlag
+
+	defaultPoolLowWatermark = 1000
+	defaultPoolBatchSize    = 500
+	defaultPoolSize         = 5000
+	defaultPoolInterval     = 10 * time.Second
+
+	// maxDenied limits retries of paths rejected by slug filter.
+	maxDenied = 100
+)
+
+// Homograph policies, see homograph.Check.
+const (
+	// HomographAllow shortens suspicious hosts silently.
+	HomographAllow = "allow"
+	// HomographFlag shortens suspicious hosts and logs them for review.
+	HomographFlag = "flag"
+	// HomographBlock rejects suspicious hosts with service.ErrInvalidURL.
+	HomographBlock = "block"
 )
 
 var (
@@ -23,59 +56,170 @@ var (
 )
 
 type Config struct {
-	Alphabet       string   `yaml:"alphabet"`
-	ShortLen       int      `yaml:"short_len"`
-	DefaultScheme  string   `yaml:"default_scheme"`
-	AllowedSchemes []string `yaml:"allowed_schemes"`
-	HashGenerator  bool     `yaml:"hash_generator"`
+	Alphabet        string   `yaml:"alphabet"`
+	ShortLen        int      `yaml:"short_len"`
+	DefaultScheme   string   `yaml:"default_scheme"`
+	AllowedSchemes  []string `yaml:"allowed_schemes"`
+	MaxURLLen       int      `yaml:"max_url_len"`
+	HomographPolicy string   `yaml:"homograph_policy"`
+	// Generator is registered generator type with its options (see generator.Config).
+	Generator generator.Config `yaml:"generator"`
+	// HashGenerator chooses hash or random generator if Generator is not set.
+	// Deprecated: use Generator.
+	HashGenerator bool `yaml:"hash_generator"`
+	// MinKeyspace is min number of different paths generator must be able to make.
+	MinKeyspace float64 `yaml:"min_keyspace"`
+	// AdaptiveLength makes generator start with MinShortLen paths
+	// and move to longer ones up to ShortLen when collision rate crosses AdaptiveThreshold.
+	AdaptiveLength    bool    `yaml:"adaptive_length"`
+	MinShortLen       int     `yaml:"min_short_len"`
+	AdaptiveThreshold float64 `yaml:"adaptive_threshold"`
+	// SlugPool takes paths pre-generated in background, generator is used when pool is empty.
+	SlugPool poolgenerator.Config `yaml:"slug_pool"`
+	// SlugFilter rejects generated paths with denied words.
+	SlugFilter SlugFilterConfig `yaml:"slug_filter"`
+	// CheckDigit appends check symbol to generated paths,
+	// mistyped paths are resolved to ErrNotFound with suggestion (see service.MistypedError).
+	CheckDigit bool `yaml:"check_digit"`
+}
+
+type SlugFilterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Deny is extra words to embedded deny list (see profanity.Default).
+	Deny []string `yaml:"deny"`
 }
 
 func DefaultConfig() Config {
 	return Config{
-		Alphabet:       defaultAlphabet,
-		ShortLen:       defaultShortLen,
-		DefaultScheme:  defaultScheme,
-		AllowedSchemes: defaultAllowedSchemes,
-		HashGenerator:  defaultHashGenerator,
+		Alphabet:          defaultAlphabet,
+		ShortLen:          defaultShortLen,
+		DefaultScheme:     defaultScheme,
+		AllowedSchemes:    defaultAllowedSchemes,
+		MaxURLLen:         defaultMaxURLLen,
+		HomographPolicy:   defaultHomograph,
+		HashGenerator:     defaultHashGenerator,
+		MinKeyspace:       defaultMinKeyspace,
+		MinShortLen:       defaultMinShortLen,
+		AdaptiveThreshold: defaultThreshold,
+		SlugPool: poolgenerator.Config{
+			Enabled:      false,
+			LowWatermark: defaultPoolLowWatermark,
+			BatchSize:    defaultPoolBatchSize,
+			Size:         defaultPoolSize,
+			Interval:     defaultPoolInterval,
+		},
 	}
 }
 
 type Generator interface {
-	Generate(input string) string
+	Generate(ctx context.Context, input string) (string, error)
+}
+
+// Observer is implemented by generators which learn from collisions.
+type Observer interface {
+	// Observe is called with result of storing generated path.
+	Observe(path string, collided bool)
+}
+
+// Runner is implemented by generators which do background work.
+type Runner interface {
+	// Run blocks until ctx is done.
+	Run(ctx context.Context)
+}
+
+// Metered is implemented by generators which expose their state.
+type Metered interface {
+	Metrics() expvar.Var
+}
+
+// ReadOnly is implemented by repositories which reject links temporarily.
+type ReadOnly interface {
+	// ReadOnly reports whether Store returns service.ErrReadOnly now.
+	ReadOnly() bool
 }
 
 type Shortener struct {
 	repo           repository.ShortenerRepo
+	readOnly       ReadOnly
+	hosts          repository.UnicodeHosts
 	gen            Generator
 	defaultScheme  string
 	allowedSchemes []string
+	maxURLLen      int
+	homograph      string
+	filter         *profanity.Filter
+	check          *checkdigit.Alphabet
 }
 
-func NewService(repo repository.ShortenerRepo, config Config) *Shortener {
-	var gen Generator
-	if config.HashGenerator {
-		gen = hashgenerator.New([]byte(config.Alphabet), config.ShortLen)
-	} else {
-		gen = randgenerator.New([]byte(config.Alphabet), config.ShortLen)
+func NewService(repo repository.ShortenerRepo, config Config) (*Shortener, error) {
+	config.Alphabet = generator.Alphabet(config.Alphabet)
+
+	// Words are joined by separator, which has no check symbol, so every Shorten would fail.
+	if config.CheckDigit && generatorConfig(config).Type == wordsgenerator.Type {
+		return nil, errors.New("check digit doesn't work with words generator")
+	}
+	// Check symbol is appended to generated path, which may be MaxShortLen long.
+	if config.CheckDigit && config.ShortLen+1 > generator.MaxShortLen {
+		return nil, fmt.Errorf("short length with check digit must be at most %d", generator.MaxShortLen-1)
+	}
+	// Pool is filled without input, and claimed paths never collide, so hash generator
+	// would fill it with one path and adaptive length would never grow.
+	if config.SlugPool.Enabled && generatorConfig(config).Type == hashgenerator.Type {
+		return nil, errors.New("slug pool doesn't work with hash generator")
+	}
+	if config.SlugPool.Enabled && config.AdaptiveLength {
+		return nil, errors.New("slug pool doesn't work with adaptive length")
 	}
 
-	return &Shortener{
+	gen, err := newGenerator(repo, config)
+	if err != nil {
+		return nil, fmt.Errorf("generator: %w", err)
+	}
+
+	readOnly, _ := repository.As[ReadOnly](repo)
+	hosts, _ := repository.As[repository.UnicodeHosts](repo)
+	s := &Shortener{
 		repo:           repo,
+		readOnly:       readOnly,
+		hosts:          hosts,
 		gen:            gen,
 		defaultScheme:  config.DefaultScheme,
 		allowedSchemes: config.AllowedSchemes,
+		maxURLLen:      config.MaxURLLen,
+		homograph:      config.HomographPolicy,
+	}
+	if config.SlugFilter.Enabled {
+		s.filter = profanity.New(append(profanity.Default(), config.SlugFilter.Deny...))
+	}
+	if config.CheckDigit {
+		s.check = checkdigit.New(config.Alphabet)
 	}
+	return s, nil
 }
 
 func (s *Shortener) Shorten(ctx context.Context, original string) (domain.Link, bool, error) {
-	var err error
-	original, err = FixValidateURL(original, s.defaultScheme, s.allowedSchemes)
+	fixed, err := FixValidateURL(original, s.defaultScheme, s.allowedSchemes)
+	if err == nil {
+		err = validateURLLen(fixed, s.maxURLLen)
+	}
+	if err == nil {
+		err = s.checkHomograph(fixed)
+	}
 	if err != nil {
-		return domain.Link{}, false, fmt.Errorf("validating URL %q: %w", original, err)
+		return domain.Link{}, false, fmt.Errorf("validating URL: %w", err)
+	}
+	original = fixed
+
+	// Generators may use repository, so they aren't asked for paths which can't be stored.
+	if s.readOnly != nil && s.readOnly.ReadOnly() {
+		return domain.Link{}, false, service.ErrReadOnly
 	}
 
 	for {
-		shortened := s.gen.Generate(original)
+		generated, shortened, err := s.generate(ctx, original)
+		if err != nil {
+			return domain.Link{}, false, fmt.Errorf("generate: %w", err)
+		}
 		link := domain.Link{
 			OriginalURL:  original,
 			ShortenedURL: shortened,
@@ -85,8 +229,13 @@ func (s *Shortener) Shorten(ctx context.Context, original string) (domain.Link,
 		switch err {
 		case nil:
 			created := link.ShortenedURL == shortened
+			if created {
+				s.observe(generated, false)
+				s.storeUnicodeHost(ctx, link)
+			}
 			return link, created, nil
 		case service.ErrExist:
+			s.observe(generated, true)
 			continue
 		default:
 			return domain.Link{}, false, fmt.Errorf("repository store: %w", err)
@@ -94,10 +243,139 @@ func (s *Shortener) Shorten(ctx context.Context, original string) (domain.Link,
 	}
 }
 
+// storeUnicodeHost keeps Unicode form of IDN host of new link. Link is already stored,
+// so failure is only logged, then host is shown in form converted from punycode.
+func (s *Shortener) storeUnicodeHost(ctx context.Context, link domain.Link) {
+	if s.hosts == nil {
+		return
+	}
+	host := unicodeHost(link.OriginalURL)
+	if host == "" {
+		return
+	}
+	if err := s.hosts.StoreUnicodeHost(ctx, link.ShortenedURL, host); err != nil {
+		slog.Warn("store unicode host", slog.String("shortened", link.ShortenedURL),
+			slog.String("error", err.Error()))
+	}
+}
+
+// UnicodeHost returns Unicode form of IDN host kept for shortened URL.
+func (s *Shortener) UnicodeHost(ctx context.Context, shortened string) (string, error) {
+	if s.hosts == nil {
+		return "", service.ErrNotFound
+	}
+	host, err := s.hosts.UnicodeHost(ctx, shortened)
+	if err != nil {
+		return "", fmt.Errorf("repository unicode host: %w", err)
+	}
+	return host, nil
+}
+
+// generate returns generated path which passes slug filter, and shortened URL,
+// which is generated path with check symbol if it's enabled.
+func (s *Shortener) generate(ctx context.Context, original string) (string, string, error) {
+	input := original
+	for denied := 0; ; {
+		generated, err := s.gen.Generate(ctx, input)
+		if err != nil {
+			return "", "", err
+		}
+
+		if s.filter != nil {
+			if _, ok := s.filter.Match(generated); ok {
+				denied++
+				if denied == maxDenied {
+					return "", "", fmt.Errorf("%d paths in a row are denied by slug filter", denied)
+				}
+				// Input is changed, so deterministic generators make another path.
+				input = fmt.Sprintf("%s#%d", original, denied)
+				continue
+			}
+		}
+
+		if s.check == nil {
+			return generated, generated, nil
+		}
+		shortened, err := s.check.Append(generated)
+		if err != nil {
+			return "", "", fmt.Errorf("check symbol: %w", err)
+		}
+		return generated, shortened, nil
+	}
+}
+
+func (s *Shortener) observe(path string, collided bool) {
+	if observer, ok := s.gen.(Observer); ok {
+		observer.Observe(path, collided)
+	}
+}
+
+// Run does background work of generator until ctx is done.
+func (s *Shortener) Run(ctx context.Context) {
+	if runner, ok := s.gen.(Runner); ok {
+		runner.Run(ctx)
+	}
+}
+
+// Metrics returns generator state, nil if generator doesn't expose it.
+func (s *Shortener) Metrics() expvar.Var {
+	if metered, ok := s.gen.(Metered); ok {
+		return metered.Metrics()
+	}
+	return nil
+}
+
+// checkHomograph applies homograph policy to host of valid URL.
+func (s *Shortener) checkHomograph(original string) error {
+	if s.homograph == HomographAllow {
+		return nil
+	}
+
+	u, err := url.Parse(original)
+	if err != nil {
+		return fmt.Errorf("%w: %s", service.ErrInvalidURL, err)
+	}
+
+	res := homograph.Check(u.Hostname())
+	if !res.Suspicious {
+		return nil
+	}
+
+	if s.homograph == HomographBlock {
+		return fmt.Errorf("%w: suspicious host: %s", service.ErrInvalidURL, res.Reason)
+	}
+
+	slog.Warn("suspicious host flagged for review",
+		slog.String("url", original),
+		slog.String("host", homograph.Unicode(u.Hostname())),
+		slog.String("looks_like", res.LooksLike),
+		slog.String("reason", res.Reason))
+	return nil
+}
+
+// Resolve returns original URL of shortened. With check symbol unknown path with wrong one
+// is mistyped, but links created before check symbol was enabled are still resolved.
 func (s *Shortener) Resolve(ctx context.Context, shortened string) (string, error) {
 	original, err := s.repo.Get(ctx, shortened)
+	if errors.Is(err, service.ErrNotFound) && s.check != nil && !s.check.Valid(shortened) {
+		return "", s.mistyped(ctx, shortened)
+	}
 	if err != nil {
 		return "", fmt.Errorf("repository get: %w", err)
 	}
 	return original, nil
 }
+
+// mistyped looks for existing shortened URL which was probably meant instead of mistyped one.
+func (s *Shortener) mistyped(ctx context.Context, shortened string) error {
+	for _, suggestion := range s.check.Suggest(shortened) {
+		_, err := s.repo.Get(ctx, suggestion)
+		if err == nil {
+			return &service.MistypedError{Suggestion: suggestion}
+		}
+		if !errors.Is(err, service.ErrNotFound) {
+			return fmt.Errorf("repository get: %w", err)
+		}
+	}
+	return fmt.Errorf("%w: wrong check symbol", service.ErrNotFound)
+}
@@ -2,11 +2,17 @@ package shortener
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/amanakin/shortener/internal/domain"
 	"github.com/amanakin/shortener/internal/mocks"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
 	"github.com/amanakin/shortener/internal/service"
+	"github.com/amanakin/shortener/internal/service/shortener/checkdigit"
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
+	"github.com/amanakin/shortener/internal/service/shortener/poolgenerator"
+	"github.com/amanakin/shortener/internal/service/shortener/profanity"
 	"github.com/stretchr/testify/require"
 
 	"github.com/golang/mock/gomock"
@@ -40,8 +46,8 @@ func TestShortener(t *testing.T) {
 				second := mockRepo.EXPECT().Store(gomock.Any(), newLink).Return(newLink, nil)
 				gomock.InOrder(first, second)
 
-				first = mockGen.EXPECT().Generate(collisionLink.OriginalURL).Return(collisionLink.ShortenedURL).Times(2)
-				second = mockGen.EXPECT().Generate(collisionLink.OriginalURL).Return(newLink.ShortenedURL)
+				first = mockGen.EXPECT().Generate(gomock.Any(), collisionLink.OriginalURL).Return(collisionLink.ShortenedURL, nil).Times(2)
+				second = mockGen.EXPECT().Generate(gomock.Any(), collisionLink.OriginalURL).Return(newLink.ShortenedURL, nil)
 				gomock.InOrder(first, second)
 
 				link, created, err := shortener.Shorten(context.Background(), collisionLink.OriginalURL)
@@ -70,7 +76,7 @@ func TestShortener(t *testing.T) {
 				}
 
 				mockRepo.EXPECT().Store(gomock.Any(), wantedLink).Return(oldLink, nil)
-				mockGen.EXPECT().Generate(gomock.Any()).Return(wantedLink.ShortenedURL)
+				mockGen.EXPECT().Generate(gomock.Any(), gomock.Any()).Return(wantedLink.ShortenedURL, nil)
 
 				link, created, err := shortener.Shorten(context.Background(), wantedLink.OriginalURL)
 				require.NoError(t, err)
@@ -91,7 +97,64 @@ func TestShortener(t *testing.T) {
 				invalidURL := "invalid url"
 
 				_, _, err := shortener.Shorten(context.Background(), invalidURL)
-				require.Error(t, err)
+				require.ErrorIs(t, err, service.ErrInvalidURL)
+			},
+		},
+		{
+			name: "original url is too long",
+			fn: func(t *testing.T, mockRepo *mocks.MockShortenerRepo, mockGen *mocks.MockGenerator) {
+				shortener := Shortener{
+					repo:           mockRepo,
+					gen:            mockGen,
+					defaultScheme:  defaultScheme,
+					allowedSchemes: defaultAllowedSchemes,
+					maxURLLen:      255,
+				}
+
+				longURL := "https://google.com/?utm_source=" + strings.Repeat("a", 255)
+
+				_, _, err := shortener.Shorten(context.Background(), longURL)
+				require.ErrorIs(t, err, service.ErrURLTooLong)
+			},
+		},
+		{
+			name: "homograph host blocked",
+			fn: func(t *testing.T, mockRepo *mocks.MockShortenerRepo, mockGen *mocks.MockGenerator) {
+				shortener := Shortener{
+					repo:           mockRepo,
+					gen:            mockGen,
+					defaultScheme:  defaultScheme,
+					allowedSchemes: defaultAllowedSchemes,
+					homograph:      HomographBlock,
+				}
+
+				_, _, err := shortener.Shorten(context.Background(), "https://pаypal.com/login")
+				require.ErrorIs(t, err, service.ErrInvalidURL)
+			},
+		},
+		{
+			name: "homograph host flagged and stored in punycode",
+			fn: func(t *testing.T, mockRepo *mocks.MockShortenerRepo, mockGen *mocks.MockGenerator) {
+				shortener := Shortener{
+					repo:           mockRepo,
+					gen:            mockGen,
+					defaultScheme:  defaultScheme,
+					allowedSchemes: defaultAllowedSchemes,
+					homograph:      HomographFlag,
+				}
+
+				link := domain.Link{
+					OriginalURL:  "https://xn--pypal-4ve.com/login",
+					ShortenedURL: "abc",
+				}
+
+				mockGen.EXPECT().Generate(gomock.Any(), link.OriginalURL).Return(link.ShortenedURL, nil)
+				mockRepo.EXPECT().Store(gomock.Any(), link).Return(link, nil)
+
+				storedLink, created, err := shortener.Shorten(context.Background(), "https://pаypal.com/login")
+				require.NoError(t, err)
+				require.True(t, created)
+				require.Equal(t, link, storedLink)
 			},
 		},
 		{
@@ -109,7 +172,7 @@ func TestShortener(t *testing.T) {
 					ShortenedURL: "abcde",
 				}
 
-				mockGen.EXPECT().Generate(link.OriginalURL).Return(link.ShortenedURL)
+				mockGen.EXPECT().Generate(gomock.Any(), link.OriginalURL).Return(link.ShortenedURL, nil)
 				mockRepo.EXPECT().Store(gomock.Any(), link).Return(link, nil)
 				mockRepo.EXPECT().Get(gomock.Any(), link.ShortenedURL).Return(link.OriginalURL, nil)
 
@@ -137,3 +200,326 @@ func TestShortener(t *testing.T) {
 		})
 	}
 }
+
+type observedGenerator struct {
+	paths    []string
+	observed map[string]bool
+}
+
+func (g *observedGenerator) Generate(_ context.Context, _ string) (string, error) {
+	path := g.paths[0]
+	g.paths = g.paths[1:]
+	return path, nil
+}
+
+func (g *observedGenerator) Observe(path string, collided bool) {
+	g.observed[path] = collided
+}
+
+func TestShortenerObserve(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockShortenerRepo(ctrl)
+	gen := &observedGenerator{
+		paths:    []string{"abc", "def"},
+		observed: make(map[string]bool),
+	}
+	shortener := Shortener{
+		repo:           mockRepo,
+		gen:            gen,
+		defaultScheme:  defaultScheme,
+		allowedSchemes: defaultAllowedSchemes,
+	}
+
+	link := domain.Link{
+		OriginalURL:  "https://google.com",
+		ShortenedURL: "def",
+	}
+	first := mockRepo.EXPECT().Store(gomock.Any(), gomock.Any()).Return(domain.Link{}, service.ErrExist)
+	second := mockRepo.EXPECT().Store(gomock.Any(), link).Return(link, nil)
+	gomock.InOrder(first, second)
+
+	_, created, err := shortener.Shorten(context.Background(), link.OriginalURL)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, map[string]bool{"abc": true, "def": false}, gen.observed)
+}
+
+func TestNewServiceGenerator(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(config *Config)
+		valid  bool
+	}{
+		{name: "default", modify: func(config *Config) {}, valid: true},
+		{name: "random", modify: func(config *Config) { config.Generator.Type = "random" }, valid: true},
+		{name: "words", modify: func(config *Config) { config.Generator.Type = "words" }, valid: true},
+		{name: "unambiguous alphabet", modify: func(config *Config) { config.Alphabet = "unambiguous" }, valid: true},
+		{name: "deprecated hash_generator", modify: func(config *Config) { config.HashGenerator = false }, valid: true},
+		{name: "unknown type", modify: func(config *Config) { config.Generator.Type = "unknown" }, valid: false},
+		{
+			name: "check digit with words",
+			modify: func(config *Config) {
+				config.Generator.Type = "words"
+				config.CheckDigit = true
+			},
+			valid: false,
+		},
+		{
+			name: "check digit with max length",
+			modify: func(config *Config) {
+				config.ShortLen = generator.MaxShortLen
+				config.CheckDigit = true
+			},
+			valid: false,
+		},
+		{
+			name: "check digit with length below max",
+			modify: func(config *Config) {
+				config.ShortLen = generator.MaxShortLen - 1
+				config.CheckDigit = true
+			},
+			valid: true,
+		},
+		{
+			name: "slug pool with hash",
+			modify: func(config *Config) {
+				config.Generator.Type = "hash"
+				config.SlugPool.Enabled = true
+			},
+			valid: false,
+		},
+		{
+			name: "slug pool with adaptive length",
+			modify: func(config *Config) {
+				config.Generator.Type = "random"
+				config.AdaptiveLength = true
+				config.SlugPool.Enabled = true
+			},
+			valid: false,
+		},
+		{name: "repeated symbol", modify: func(config *Config) { config.Alphabet = "abcabc" }, valid: false},
+		{name: "too long", modify: func(config *Config) { config.ShortLen = 256 }, valid: false},
+		{name: "small keyspace", modify: func(config *Config) { config.ShortLen = 2 }, valid: false},
+		{
+			name: "adaptive min length out of range",
+			modify: func(config *Config) {
+				config.AdaptiveLength = true
+				config.MinShortLen = config.ShortLen + 1
+			},
+			valid: false,
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			config := DefaultConfig()
+			tCase.modify(&config)
+
+			_, err := NewService(mocks.NewMockShortenerRepo(ctrl), config)
+			if tCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestShortenerSlugPool(t *testing.T) {
+	ctx := context.Background()
+	repo := maprepo.New()
+	config := DefaultConfig()
+	config.Generator.Type = "words"
+	config.SlugPool.Enabled = true
+	shortener, err := NewService(repo, config)
+	require.NoError(t, err)
+
+	// Pool is filled by generator of configured type.
+	pool, ok := shortener.gen.(*poolgenerator.PoolGenerator)
+	require.True(t, ok)
+	require.NoError(t, pool.Fill(ctx))
+	path, err := repo.ClaimSlug(ctx)
+	require.NoError(t, err)
+	require.Contains(t, path, "-")
+}
+
+func TestShortenerSlugFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockShortenerRepo(ctrl)
+	mockGen := mocks.NewMockGenerator(ctrl)
+	shortener := Shortener{
+		repo:           mockRepo,
+		gen:            mockGen,
+		defaultScheme:  defaultScheme,
+		allowedSchemes: defaultAllowedSchemes,
+		filter:         profanity.New([]string{"shit"}),
+	}
+
+	link := domain.Link{
+		OriginalURL:  "https://google.com",
+		ShortenedURL: "abc",
+	}
+	first := mockGen.EXPECT().Generate(gomock.Any(), link.OriginalURL).Return("x5h1tx", nil)
+	second := mockGen.EXPECT().Generate(gomock.Any(), link.OriginalURL+"#1").Return(link.ShortenedURL, nil)
+	gomock.InOrder(first, second)
+	mockRepo.EXPECT().Store(gomock.Any(), link).Return(link, nil)
+
+	got, created, err := shortener.Shorten(context.Background(), link.OriginalURL)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, link, got)
+}
+
+func TestShortenerCheckDigit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockShortenerRepo(ctrl)
+	mockGen := mocks.NewMockGenerator(ctrl)
+	check := checkdigit.New(defaultAlphabet)
+	shortener := Shortener{
+		repo:           mockRepo,
+		gen:            mockGen,
+		defaultScheme:  defaultScheme,
+		allowedSchemes: defaultAllowedSchemes,
+		check:          check,
+	}
+
+	shortened, err := check.Append("abcO1xyz")
+	require.NoError(t, err)
+	link := domain.Link{
+		OriginalURL:  "https://google.com",
+		ShortenedURL: shortened,
+	}
+	mockGen.EXPECT().Generate(gomock.Any(), link.OriginalURL).Return("abcO1xyz", nil)
+	mockRepo.EXPECT().Store(gomock.Any(), link).Return(link, nil)
+
+	got, _, err := shortener.Shorten(context.Background(), link.OriginalURL)
+	require.NoError(t, err)
+	require.Equal(t, link, got)
+
+	mockRepo.EXPECT().Get(gomock.Any(), shortened).Return(link.OriginalURL, nil)
+	original, err := shortener.Resolve(context.Background(), shortened)
+	require.NoError(t, err)
+	require.Equal(t, link.OriginalURL, original)
+
+	mistyped := shortened[:3] + "0" + shortened[4:]
+	mockRepo.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, path string) (string, error) {
+		if path == shortened {
+			return link.OriginalURL, nil
+		}
+		return "", service.ErrNotFound
+	}).AnyTimes()
+	_, err = shortener.Resolve(context.Background(), mistyped)
+	require.ErrorIs(t, err, service.ErrNotFound)
+	var mistypedErr *service.MistypedError
+	require.ErrorAs(t, err, &mistypedErr)
+	require.Equal(t, shortened, mistypedErr.Suggestion)
+}
+
+func TestShortenerCheckDigitOldLinks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockShortenerRepo(ctrl)
+	shortener := Shortener{
+		repo:  mockRepo,
+		check: checkdigit.New(defaultAlphabet),
+	}
+
+	// Link created before check symbol was enabled.
+	old := "abcO1xyz"
+	require.False(t, shortener.check.Valid(old))
+	mockRepo.EXPECT().Get(gomock.Any(), old).Return("https://google.com", nil)
+
+	original, err := shortener.Resolve(context.Background(), old)
+	require.NoError(t, err)
+	require.Equal(t, "https://google.com", original)
+}
+
+type readOnlyRepo struct {
+	*mocks.MockShortenerRepo
+	readOnly bool
+}
+
+func (r readOnlyRepo) ReadOnly() bool {
+	return r.readOnly
+}
+
+func TestShortenerReadOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Neither generator nor repository is called.
+	repo := readOnlyRepo{MockShortenerRepo: mocks.NewMockShortenerRepo(ctrl), readOnly: true}
+	shortener := Shortener{
+		repo:           repo,
+		readOnly:       repo,
+		gen:            mocks.NewMockGenerator(ctrl),
+		defaultScheme:  defaultScheme,
+		allowedSchemes: defaultAllowedSchemes,
+	}
+
+	_, _, err := shortener.Shorten(context.Background(), "https://google.com")
+	require.ErrorIs(t, err, service.ErrReadOnly)
+}
+
+type hostsRepo struct {
+	*mocks.MockShortenerRepo
+	hosts map[string]string
+}
+
+func (r hostsRepo) StoreUnicodeHost(_ context.Context, shortened, host string) error {
+	r.hosts[shortened] = host
+	return nil
+}
+
+func (r hostsRepo) UnicodeHost(_ context.Context, shortened string) (string, error) {
+	if host, ok := r.hosts[shortened]; ok {
+		return host, nil
+	}
+	return "", service.ErrNotFound
+}
+
+func TestShortenerUnicodeHost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repo := hostsRepo{MockShortenerRepo: mocks.NewMockShortenerRepo(ctrl), hosts: make(map[string]string)}
+	mockGen := mocks.NewMockGenerator(ctrl)
+	shortener := Shortener{
+		repo:           repo,
+		hosts:          repo,
+		gen:            mockGen,
+		defaultScheme:  defaultScheme,
+		allowedSchemes: defaultAllowedSchemes,
+	}
+
+	idn := domain.Link{OriginalURL: "https://xn--e1afmkfd.xn--p1ai/path", ShortenedURL: "abc"}
+	mockGen.EXPECT().Generate(gomock.Any(), idn.OriginalURL).Return(idn.ShortenedURL, nil)
+	mockRepo := repo.MockShortenerRepo
+	mockRepo.EXPECT().Store(gomock.Any(), idn).Return(idn, nil)
+
+	_, _, err := shortener.Shorten(context.Background(), "https://Пример.рф/path")
+	require.NoError(t, err)
+	host, err := shortener.UnicodeHost(context.Background(), idn.ShortenedURL)
+	require.NoError(t, err)
+	require.Equal(t, "пример.рф", host)
+
+	// ASCII host has no other form.
+	ascii := domain.Link{OriginalURL: "https://google.com", ShortenedURL: "def"}
+	mockGen.EXPECT().Generate(gomock.Any(), ascii.OriginalURL).Return(ascii.ShortenedURL, nil)
+	mockRepo.EXPECT().Store(gomock.Any(), ascii).Return(ascii, nil)
+
+	_, _, err = shortener.Shorten(context.Background(), ascii.OriginalURL)
+	require.NoError(t, err)
+	_, err = shortener.UnicodeHost(context.Background(), ascii.ShortenedURL)
+	require.ErrorIs(t, err, service.ErrNotFound)
+}
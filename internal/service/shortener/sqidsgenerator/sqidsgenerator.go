@@ -0,0 +1,209 @@
+package sqidsgenerator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/service/shortener/countergenerator"
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
+)
+
+// Type is name of generator in config.
+const Type = "sqids"
+
+// Options are sqids generator options in config.
+type Options struct {
+	// Key is secret key, changing it changes all new paths.
+	Key       string `yaml:"key"`
+	RangeSize uint64 `yaml:"range_size"`
+}
+
+func init() {
+	generator.Register(Type, func(params generator.Params, options generator.Options) (generator.Generator, error) {
+		opts := Options{RangeSize: countergenerator.DefaultRangeSize}
+		if err := options.Decode(&opts); err != nil {
+			return nil, err
+		}
+
+		alloc, ok := repository.As[countergenerator.Allocator](params.Repo)
+		if !ok {
+			return nil, fmt.Errorf("repository %T can't allocate IDs", params.Repo)
+		}
+		return New(alloc, params.Alphabet, params.ShortLen, opts.RangeSize, []byte(opts.Key))
+	})
+}
+
+// rounds of Feistel network, 8 is enough to make neighbour IDs unrelated.
+const rounds = 8
+
+// SqidsGenerator implements Generator interface.
+// Like Sqids, it makes random-looking paths from sequential IDs and can decode them back.
+// ID is mapped by keyed Feistel permutation of [0, len(alphabet)^shortLen),
+// so paths never collide and have exactly shortLen symbols.
+type SqidsGenerator struct {
+	ids      *countergenerator.IDs
+	alphabet []byte
+	index    [256]int
+	shortLen int
+	key      []byte
+
+	// keyspace is split to hi in [0, hiSize) and lo in [0, loSize)
+	hiSize uint64
+	loSize uint64
+}
+
+func New(alloc countergenerator.Allocator, alphabet []byte, shortLen int, rangeSize uint64, key []byte) (*SqidsGenerator, error) {
+	if len(key) == 0 {
+		return nil, errors.New("key is required")
+	}
+	if len(alphabet) < 2 {
+		return nil, errors.New("alphabet must have at least 2 symbols")
+	}
+	if shortLen < 2 {
+		return nil, errors.New("short length must be at least 2")
+	}
+
+	g := &SqidsGenerator{
+		alphabet: alphabet,
+		shortLen: shortLen,
+		key:      key,
+	}
+
+	for i := range g.index {
+		g.index[i] = -1
+	}
+	for i, c := range alphabet {
+		if g.index[c] >= 0 {
+			return nil, fmt.Errorf("symbol %q repeats in alphabet", c)
+		}
+		g.index[c] = i
+	}
+
+	var ok bool
+	g.hiSize, ok = pow(uint64(len(alphabet)), shortLen/2)
+	if ok {
+		g.loSize, ok = pow(uint64(len(alphabet)), shortLen-shortLen/2)
+	}
+	if hi, _ := bits.Mul64(g.hiSize, g.loSize); !ok || hi != 0 {
+		return nil, fmt.Errorf("%d symbols of %d-symbol alphabet overflow uint64", shortLen, len(alphabet))
+	}
+
+	ids, err := countergenerator.NewIDs(alloc, rangeSize)
+	if err != nil {
+		return nil, err
+	}
+	g.ids = ids
+
+	return g, nil
+}
+
+// Keyspace returns number of different paths.
+func (g *SqidsGenerator) Keyspace() float64 {
+	return float64(g.size())
+}
+
+func (g *SqidsGenerator) size() uint64 {
+	return g.hiSize * g.loSize
+}
+
+func (g *SqidsGenerator) Generate(ctx context.Context, _ string) (string, error) {
+	id, err := g.ids.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return g.Encode(id)
+}
+
+// Encode maps ID to path, returns domain.ErrNoURLsLeft if ID is out of keyspace.
+func (g *SqidsGenerator) Encode(id uint64) (string, error) {
+	if id >= g.size() {
+		return "", domain.ErrNoURLsLeft
+	}
+
+	n := g.permute(id)
+
+	base := uint64(len(g.alphabet))
+	b := make([]byte, g.shortLen)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = g.alphabet[n%base]
+		n /= base
+	}
+	return string(b), nil
+}
+
+// Decode maps path back to ID, returns false if it's not a path of this generator.
+// Links are looked up by path, not by ID, see README.
+func (g *SqidsGenerator) Decode(path string) (uint64, bool) {
+	if len(path) != g.shortLen {
+		return 0, false
+	}
+
+	base := uint64(len(g.alphabet))
+	var n uint64
+	for i := 0; i < len(path); i++ {
+		digit := g.index[path[i]]
+		if digit < 0 {
+			return 0, false
+		}
+		n = n*base + uint64(digit)
+	}
+
+	return g.unpermute(n), true
+}
+
+// permute applies Feistel rounds, even rounds change hi half by lo half, odd rounds vice versa.
+// Every round is invertible, so permute is bijection for any hiSize and loSize.
+func (g *SqidsGenerator) permute(n uint64) uint64 {
+	hi, lo := n/g.loSize, n%g.loSize
+	for round := 0; round < rounds; round++ {
+		if round%2 == 0 {
+			hi = (hi + g.round(round, lo)%g.hiSize) % g.hiSize
+		} else {
+			lo = (lo + g.round(round, hi)%g.loSize) % g.loSize
+		}
+	}
+	return hi*g.loSize + lo
+}
+
+func (g *SqidsGenerator) unpermute(n uint64) uint64 {
+	hi, lo := n/g.loSize, n%g.loSize
+	for round := rounds - 1; round >= 0; round-- {
+		if round%2 == 0 {
+			hi = (hi + g.hiSize - g.round(round, lo)%g.hiSize) % g.hiSize
+		} else {
+			lo = (lo + g.loSize - g.round(round, hi)%g.loSize) % g.loSize
+		}
+	}
+	return hi*g.loSize + lo
+}
+
+// round is keyed round function: first 8 bytes of HMAC-SHA256(key, round || half).
+func (g *SqidsGenerator) round(round int, half uint64) uint64 {
+	var msg [9]byte
+	msg[0] = byte(round)
+	binary.BigEndian.PutUint64(msg[1:], half)
+
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+func pow(base uint64, exp int) (uint64, bool) {
+	res := uint64(1)
+	for i := 0; i < exp; i++ {
+		hi, lo := bits.Mul64(res, base)
+		if hi != 0 {
+			return 0, false
+		}
+		res = lo
+	}
+	return res, true
+}
@@ -0,0 +1,127 @@
+package sqidsgenerator
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/amanakin/shortener/internal/domain"
+	"github.com/stretchr/testify/require"
+)
+
+type counterAllocator struct {
+	next atomic.Uint64
+}
+
+func (a *counterAllocator) AllocateRange(_ context.Context, size uint64) (uint64, error) {
+	return a.next.Add(size) - size, nil
+}
+
+func TestSqidsGenerator(t *testing.T) {
+	alphabet := []byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_")
+	key := []byte("secret")
+
+	t.Run("bijection over whole keyspace", func(t *testing.T) {
+		for _, tCase := range []struct {
+			alphabet string
+			shortLen int
+		}{
+			{"abc", 2},
+			{"abc", 5},
+			{"0123456789", 3},
+			{"abcdefg", 4},
+		} {
+			generator, err := New(&counterAllocator{}, []byte(tCase.alphabet), tCase.shortLen, 10, key)
+			require.NoError(t, err)
+
+			generated := make(map[string]struct{})
+			for id := uint64(0); id < generator.size(); id++ {
+				path, err := generator.Encode(id)
+				require.NoError(t, err)
+				require.Len(t, path, tCase.shortLen)
+				if _, ok := generated[path]; ok {
+					t.Fatalf("alphabet %q, length %d: generated %s twice", tCase.alphabet, tCase.shortLen, path)
+				}
+				generated[path] = struct{}{}
+
+				decoded, ok := generator.Decode(path)
+				require.True(t, ok)
+				require.Equal(t, id, decoded)
+			}
+			require.Len(t, generated, int(generator.Keyspace()))
+
+			_, err = generator.Encode(generator.size())
+			require.ErrorIs(t, err, domain.ErrNoURLsLeft)
+		}
+	})
+
+	t.Run("decode inverts encode on large keyspace", func(t *testing.T) {
+		generator, err := New(&counterAllocator{}, alphabet, 10, 10, key)
+		require.NoError(t, err)
+
+		r := rand.New(rand.NewSource(42))
+		for i := 0; i < 10000; i++ {
+			id := r.Uint64() % generator.size()
+			path, err := generator.Encode(id)
+			require.NoError(t, err)
+
+			decoded, ok := generator.Decode(path)
+			require.True(t, ok)
+			require.Equal(t, id, decoded)
+		}
+	})
+
+	t.Run("sequential ids look random", func(t *testing.T) {
+		generator, err := New(&counterAllocator{}, alphabet, 10, 100, key)
+		require.NoError(t, err)
+
+		prev, err := generator.Generate(context.Background(), "")
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			path, err := generator.Generate(context.Background(), "")
+			require.NoError(t, err)
+
+			same := 0
+			for j := range path {
+				if path[j] == prev[j] {
+					same++
+				}
+			}
+			require.Less(t, same, 5, "%s follows %s", path, prev)
+			prev = path
+		}
+	})
+
+	t.Run("different keys give different paths", func(t *testing.T) {
+		first, err := New(&counterAllocator{}, alphabet, 10, 10, []byte("first"))
+		require.NoError(t, err)
+		second, err := New(&counterAllocator{}, alphabet, 10, 10, []byte("second"))
+		require.NoError(t, err)
+
+		path1, err := first.Encode(1)
+		require.NoError(t, err)
+		path2, err := second.Encode(1)
+		require.NoError(t, err)
+		require.NotEqual(t, path1, path2)
+	})
+
+	t.Run("decode rejects foreign paths", func(t *testing.T) {
+		generator, err := New(&counterAllocator{}, alphabet, 10, 10, key)
+		require.NoError(t, err)
+
+		_, ok := generator.Decode("short")
+		require.False(t, ok)
+		_, ok = generator.Decode("with-dash!")
+		require.False(t, ok)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, err := New(&counterAllocator{}, alphabet, 10, 10, nil)
+		require.Error(t, err)
+		_, err = New(&counterAllocator{}, []byte("abca"), 10, 10, key)
+		require.Error(t, err)
+		_, err = New(&counterAllocator{}, alphabet, 12, 10, key)
+		require.Error(t, err)
+	})
+}
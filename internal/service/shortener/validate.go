@@ -4,46 +4,68 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-)
 
-var ErrInvalidURL = errors.New("invalid URL")
+	"github.com/amanakin/shortener/internal/service"
+	"github.com/amanakin/shortener/internal/service/shortener/scheme"
+)
 
-// validateURL allows non-empty host and provided schemes.
-func validateURL(u *url.URL, allowedSchemes []string) bool {
+// validateURL allows provided schemes which pass scheme validator (see scheme.Validate).
+// Denied schemes (javascript, data, file, ...) are rejected even if allowed.
+func validateURL(u *url.URL, allowedSchemes []string) error {
 	if u == nil {
-		return false
-	}
-
-	if u.Host == "" {
-		return false
+		return service.ErrInvalidURL
 	}
 
+	allowed := false
 	for _, allowedScheme := range allowedSchemes {
 		if u.Scheme == allowedScheme {
-			return true
+			allowed = true
+			break
 		}
 	}
+	if !allowed {
+		return fmt.Errorf("%w: scheme %q is not allowed", service.ErrInvalidURL, u.Scheme)
+	}
+
+	if err := scheme.Validate(u); err != nil {
+		return fmt.Errorf("%w: %s: %s", service.ErrInvalidURL, u.Scheme, err)
+	}
 
-	return false
+	return nil
 }
 
 // FixValidateURL validates URL (see validateURL).
 // If raw URL not valid it tries to add defaultScheme and validate again.
+// Host of valid URL is normalized to ASCII (see normalizeHost).
 func FixValidateURL(rawURL string, defaultScheme string, allowedSchemes []string) (string, error) {
 	u, err := url.ParseRequestURI(rawURL)
-	if err == nil && validateURL(u, allowedSchemes) {
-		return rawURL, nil
+	if err == nil {
+		err = validateURL(u, allowedSchemes)
+		if err == nil {
+			return normalizeHost(rawURL, u)
+		}
 	}
 	// We got invalid URL, but it is already has schema
 	if u != nil && u.Scheme != "" {
-		return "", ErrInvalidURL
+		if !errors.Is(err, service.ErrInvalidURL) {
+			err = service.ErrInvalidURL
+		}
+		return "", err
 	}
 
 	rawURL = fmt.Sprintf("%s://%s", defaultScheme, rawURL)
 	u, err = url.ParseRequestURI(rawURL)
-	if err == nil && validateURL(u, allowedSchemes) {
-		return rawURL, nil
+	if err == nil && validateURL(u, allowedSchemes) == nil {
+		return normalizeHost(rawURL, u)
 	}
 
-	return "", ErrInvalidURL
+	return "", service.ErrInvalidURL
+}
+
+// validateURLLen checks that URL fits in maxLen bytes, zero maxLen means no limit.
+func validateURLLen(rawURL string, maxLen int) error {
+	if maxLen > 0 && len(rawURL) > maxLen {
+		return fmt.Errorf("%w: %d bytes, max is %d", service.ErrURLTooLong, len(rawURL), maxLen)
+	}
+	return nil
 }
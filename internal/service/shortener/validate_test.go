@@ -2,8 +2,10 @@ package shortener
 
 import (
 	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/amanakin/shortener/internal/service"
 	"github.com/stretchr/testify/require"
 )
 
@@ -38,6 +40,24 @@ func TestValidateURL(t *testing.T) {
 			allowedSchemes: []string{"http"},
 			valid:          false,
 		},
+		{
+			name:           "mailto address",
+			u:              &url.URL{Scheme: "mailto", Opaque: "john@example.com"},
+			allowedSchemes: []string{"http", "mailto"},
+			valid:          true,
+		},
+		{
+			name:           "app scheme",
+			u:              &url.URL{Scheme: "myapp", Host: "open", Path: "/item/42"},
+			allowedSchemes: []string{"myapp"},
+			valid:          true,
+		},
+		{
+			name:           "javascript is denied even if allowed",
+			u:              &url.URL{Scheme: "javascript", Opaque: "alert(1)"},
+			allowedSchemes: []string{"javascript"},
+			valid:          false,
+		},
 		{
 			name:           "no allowed schemes",
 			u:              &url.URL{Scheme: "http", Host: "google.com"},
@@ -48,8 +68,12 @@ func TestValidateURL(t *testing.T) {
 
 	for _, tCase := range cases {
 		t.Run(tCase.name, func(t *testing.T) {
-			valid := validateURL(tCase.u, tCase.allowedSchemes)
-			require.Equal(t, tCase.valid, valid)
+			err := validateURL(tCase.u, tCase.allowedSchemes)
+			if tCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, service.ErrInvalidURL)
+			}
 		})
 	}
 }
@@ -82,29 +106,47 @@ func TestFixValidateURL(t *testing.T) {
 			fixedURL: "http://google.com/some/path?param=1&param=2#anchor",
 			errExp:   nil,
 		},
+		{
+			name:     "unicode host converted to punycode",
+			rawURL:   "https://Пример.рф/путь?q=1",
+			fixedURL: "https://xn--e1afmkfd.xn--p1ai/путь?q=1",
+			errExp:   nil,
+		},
+		{
+			name:     "host lower-cased, userinfo and port kept",
+			rawURL:   "http://user@Google.COM:8080/Path",
+			fixedURL: "http://user@google.com:8080/Path",
+			errExp:   nil,
+		},
+		{
+			name:     "unicode host without schema",
+			rawURL:   "bücher.de",
+			fixedURL: "https://xn--bcher-kva.de",
+			errExp:   nil,
+		},
 		{
 			name:     "invalid schema",
 			rawURL:   "ftp://google.com/",
 			fixedURL: "",
-			errExp:   ErrInvalidURL,
+			errExp:   service.ErrInvalidURL,
 		},
 		{
 			name:     "empty url",
 			rawURL:   "",
 			fixedURL: "",
-			errExp:   ErrInvalidURL,
+			errExp:   service.ErrInvalidURL,
 		},
 		{
 			name:     "invalid url format",
 			rawURL:   "ht:::///google.com/some/path",
 			fixedURL: "",
-			errExp:   ErrInvalidURL,
+			errExp:   service.ErrInvalidURL,
 		},
 		{
 			name:     "empty host",
 			rawURL:   "/some/path",
 			fixedURL: "",
-			errExp:   ErrInvalidURL,
+			errExp:   service.ErrInvalidURL,
 		},
 	}
 
@@ -120,3 +162,102 @@ func TestFixValidateURL(t *testing.T) {
 		})
 	}
 }
+
+func TestFixValidateURLSchemes(t *testing.T) {
+	defaultScheme := "https"
+	allowedSchemes := []string{"http", "https", "mailto", "tel", "sms", "geo", "myapp", "javascript"}
+
+	cases := []struct {
+		name     string
+		rawURL   string
+		fixedURL string
+		errExp   error
+	}{
+		{
+			name:     "mailto",
+			rawURL:   "mailto:john@example.com?subject=hi",
+			fixedURL: "mailto:john@example.com?subject=hi",
+		},
+		{
+			name:   "mailto without address",
+			rawURL: "mailto:",
+			errExp: service.ErrInvalidURL,
+		},
+		{
+			name:     "tel",
+			rawURL:   "tel:+1-201-555-0123",
+			fixedURL: "tel:+1-201-555-0123",
+		},
+		{
+			name:     "geo",
+			rawURL:   "geo:37.786971,-122.399677",
+			fixedURL: "geo:37.786971,-122.399677",
+		},
+		{
+			name:     "app scheme",
+			rawURL:   "myapp://open/item/42",
+			fixedURL: "myapp://open/item/42",
+		},
+		{
+			name:   "javascript",
+			rawURL: "javascript:alert(document.cookie)",
+			errExp: service.ErrInvalidURL,
+		},
+		{
+			name:   "not allowed scheme",
+			rawURL: "ftp://example.com",
+			errExp: service.ErrInvalidURL,
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			fixedURL, err := FixValidateURL(tCase.rawURL, defaultScheme, allowedSchemes)
+			if tCase.errExp != nil {
+				require.ErrorIs(t, err, tCase.errExp)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tCase.fixedURL, fixedURL)
+			}
+		})
+	}
+}
+
+func TestValidateURLLen(t *testing.T) {
+	cases := []struct {
+		name   string
+		rawURL string
+		maxLen int
+		errExp error
+	}{
+		{
+			name:   "fits",
+			rawURL: "https://google.com",
+			maxLen: 18,
+			errExp: nil,
+		},
+		{
+			name:   "too long",
+			rawURL: "https://google.com/" + strings.Repeat("a", 300),
+			maxLen: 255,
+			errExp: service.ErrURLTooLong,
+		},
+		{
+			name:   "no limit",
+			rawURL: "https://google.com/" + strings.Repeat("a", 10000),
+			maxLen: 0,
+			errExp: nil,
+		},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			err := validateURLLen(tCase.rawURL, tCase.maxLen)
+			if tCase.errExp != nil {
+				require.ErrorIs(t, err, tCase.errExp)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
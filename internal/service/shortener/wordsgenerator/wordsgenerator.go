@@ -0,0 +1,228 @@
+package wordsgenerator
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+
+	"github.com/amanakin/shortener/internal/service/shortener/generator"
+	"github.com/amanakin/shortener/internal/service/shortener/profanity"
+)
+
+// Type is name of generator in config.
+const Type = "words"
+
+const (
+	DefaultWords     = 2
+	DefaultSeparator = "-"
+	DefaultDigits    = 2
+
+	maxWords  = 8
+	maxDigits = 9
+	// maxAttempts limits retries of paths rejected by profanity filter.
+	maxAttempts = 100
+)
+
+var (
+	//go:embed wordlists/adjectives.txt
+	adjectivesList string
+	//go:embed wordlists/nouns.txt
+	nounsList string
+)
+
+// Options of words generator in config.
+type Options struct {
+	// Words is number of words, all but the last are adjectives.
+	Words int `yaml:"words"`
+	// Separator is put between words and number, it may be empty.
+	Separator string `yaml:"separator"`
+	// Digits is length of numeric suffix, zero means no suffix.
+	Digits int `yaml:"digits"`
+	// Deny is extra words for profanity filter (see profanity.Filter).
+	Deny []string `yaml:"deny"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Words:     DefaultWords,
+		Separator: DefaultSeparator,
+		Digits:    DefaultDigits,
+	}
+}
+
+func init() {
+	generator.Register(Type, func(_ generator.Params, options generator.Options) (generator.Generator, error) {
+		opts := DefaultOptions()
+		if err := options.Decode(&opts); err != nil {
+			return nil, err
+		}
+		return New(opts)
+	})
+}
+
+// WordsGenerator implements Generator interface.
+// It makes human-readable paths like "brave-otter-42" of random words
+// from embedded lists. Alphabet and short length are not used.
+// It is safe for concurrent use.
+type WordsGenerator struct {
+	src        io.Reader
+	adjectives []string
+	nouns      []string
+	opts       Options
+	filter     *profanity.Filter
+}
+
+func New(opts Options) (*WordsGenerator, error) {
+	return newGenerator(rand.Reader, opts)
+}
+
+// NewSeeded creates deterministic generator, it should be used only in tests.
+func NewSeeded(opts Options, seed int64) (*WordsGenerator, error) {
+	return newGenerator(&lockedReader{r: mathrand.New(mathrand.NewSource(seed))}, opts)
+}
+
+func newGenerator(src io.Reader, opts Options) (*WordsGenerator, error) {
+	if opts.Words < 1 || opts.Words > maxWords {
+		return nil, fmt.Errorf("words %d is out of [1, %d]", opts.Words, maxWords)
+	}
+	if opts.Digits < 0 || opts.Digits > maxDigits {
+		return nil, fmt.Errorf("digits %d is out of [0, %d]", opts.Digits, maxDigits)
+	}
+	for _, r := range opts.Separator {
+		// Unreserved URL symbols which are not letters or digits.
+		if !strings.ContainsRune("-._~", r) {
+			return nil, fmt.Errorf("separator symbol %q is not one of \"-._~\"", r)
+		}
+	}
+
+	filter := profanity.New(append(profanity.Default(), opts.Deny...))
+	g := &WordsGenerator{
+		src:        src,
+		adjectives: allowedWords(profanity.ParseList(adjectivesList), filter),
+		nouns:      allowedWords(profanity.ParseList(nounsList), filter),
+		opts:       opts,
+		filter:     filter,
+	}
+	if len(g.adjectives) == 0 || len(g.nouns) == 0 {
+		return nil, errors.New("all words are denied")
+	}
+
+	if maxLen := g.maxLen(); maxLen > generator.MaxShortLen {
+		return nil, fmt.Errorf("paths may be %d symbols long, max is %d", maxLen, generator.MaxShortLen)
+	}
+
+	return g, nil
+}
+
+func allowedWords(words []string, filter *profanity.Filter) []string {
+	allowed := words[:0]
+	for _, word := range words {
+		if _, denied := filter.Match(word); !denied {
+			allowed = append(allowed, word)
+		}
+	}
+	return allowed
+}
+
+func (g *WordsGenerator) maxLen() int {
+	longest := func(words []string) int {
+		n := 0
+		for _, word := range words {
+			if len(word) > n {
+				n = len(word)
+			}
+		}
+		return n
+	}
+
+	n := (g.opts.Words-1)*longest(g.adjectives) + longest(g.nouns) + (g.opts.Words-1)*len(g.opts.Separator)
+	if g.opts.Digits > 0 {
+		n += len(g.opts.Separator) + g.opts.Digits
+	}
+	return n
+}
+
+// Generate returns random path, paths which contain denied words
+// across word boundaries are generated again.
+func (g *WordsGenerator) Generate(_ context.Context, _ string) (string, error) {
+	for i := 0; i < maxAttempts; i++ {
+		path, err := g.generate()
+		if err != nil {
+			return "", err
+		}
+		if _, denied := g.filter.Match(path); !denied {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("all %d paths are denied by profanity filter", maxAttempts)
+}
+
+func (g *WordsGenerator) generate() (string, error) {
+	parts := make([]string, 0, g.opts.Words+1)
+	for i := 0; i < g.opts.Words-1; i++ {
+		word, err := g.pick(g.adjectives)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, word)
+	}
+	noun, err := g.pick(g.nouns)
+	if err != nil {
+		return "", err
+	}
+	parts = append(parts, noun)
+
+	if g.opts.Digits > 0 {
+		num, err := g.intn(int64(math.Pow10(g.opts.Digits)))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("%0*d", g.opts.Digits, num))
+	}
+
+	return strings.Join(parts, g.opts.Separator), nil
+}
+
+func (g *WordsGenerator) pick(words []string) (string, error) {
+	i, err := g.intn(int64(len(words)))
+	if err != nil {
+		return "", err
+	}
+	return words[i], nil
+}
+
+// intn returns uniform random number in [0, n).
+func (g *WordsGenerator) intn(n int64) (int64, error) {
+	num, err := rand.Int(g.src, big.NewInt(n))
+	if err != nil {
+		return 0, fmt.Errorf("read random: %w", err)
+	}
+	return num.Int64(), nil
+}
+
+// Keyspace returns number of different paths.
+func (g *WordsGenerator) Keyspace() float64 {
+	keyspace := math.Pow(float64(len(g.adjectives)), float64(g.opts.Words-1)) * float64(len(g.nouns))
+	return keyspace * math.Pow10(g.opts.Digits)
+}
+
+// lockedReader makes math/rand.Rand safe for concurrent use.
+type lockedReader struct {
+	mu sync.Mutex
+	r  *mathrand.Rand
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Read(p)
+}
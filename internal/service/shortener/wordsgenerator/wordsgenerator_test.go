@@ -0,0 +1,127 @@
+package wordsgenerator
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	cases := []struct {
+		name    string
+		opts    Options
+		pattern string
+	}{
+		{name: "default", opts: DefaultOptions(), pattern: `^[a-z]+-[a-z]+-[0-9]{2}$`},
+		{name: "no suffix", opts: Options{Words: 3, Separator: "."}, pattern: `^[a-z]+\.[a-z]+\.[a-z]+$`},
+		{name: "no separator", opts: Options{Words: 1, Digits: 4}, pattern: `^[a-z]+[0-9]{4}$`},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			gen, err := NewSeeded(tCase.opts, 1)
+			require.NoError(t, err)
+
+			re := regexp.MustCompile(tCase.pattern)
+			for i := 0; i < 100; i++ {
+				path, err := gen.Generate(context.Background(), "")
+				require.NoError(t, err)
+				require.Regexp(t, re, path)
+			}
+		})
+	}
+}
+
+func TestSeeded(t *testing.T) {
+	first, err := NewSeeded(DefaultOptions(), 42)
+	require.NoError(t, err)
+	second, err := NewSeeded(DefaultOptions(), 42)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		a, err := first.Generate(context.Background(), "")
+		require.NoError(t, err)
+		b, err := second.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.Equal(t, a, b)
+	}
+}
+
+func TestDeny(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Deny = []string{"otter", "br4ve"}
+	gen, err := New(opts)
+	require.NoError(t, err)
+
+	require.NotContains(t, gen.nouns, "otter")
+	require.NotContains(t, gen.adjectives, "brave")
+	for i := 0; i < 1000; i++ {
+		path, err := gen.Generate(context.Background(), "")
+		require.NoError(t, err)
+		require.NotContains(t, path, "otter")
+		require.NotContains(t, path, "brave")
+	}
+
+	opts.Deny = []string{"a", "e", "i", "o", "u"}
+	_, err = New(opts)
+	require.Error(t, err)
+}
+
+func TestOptions(t *testing.T) {
+	cases := []struct {
+		name  string
+		opts  Options
+		valid bool
+	}{
+		{name: "default", opts: DefaultOptions(), valid: true},
+		{name: "zero words", opts: Options{Words: 0}, valid: false},
+		{name: "too many words", opts: Options{Words: maxWords + 1}, valid: false},
+		{name: "negative digits", opts: Options{Words: 2, Digits: -1}, valid: false},
+		{name: "too many digits", opts: Options{Words: 2, Digits: maxDigits + 1}, valid: false},
+		{name: "separator not in URL", opts: Options{Words: 2, Separator: "/"}, valid: false},
+	}
+
+	for _, tCase := range cases {
+		t.Run(tCase.name, func(t *testing.T) {
+			_, err := New(tCase.opts)
+			if tCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestKeyspace(t *testing.T) {
+	gen, err := New(Options{Words: 2, Separator: "-", Digits: 2})
+	require.NoError(t, err)
+	require.Equal(t, float64(len(gen.adjectives)*len(gen.nouns)*100), gen.Keyspace())
+
+	gen, err = New(Options{Words: 1})
+	require.NoError(t, err)
+	require.Equal(t, float64(len(gen.nouns)), gen.Keyspace())
+}
+
+func TestConcurrent(t *testing.T) {
+	gen, err := NewSeeded(DefaultOptions(), 1)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				path, err := gen.Generate(context.Background(), "")
+				require.NoError(t, err)
+				require.Len(t, strings.Split(path, "-"), 3)
+			}
+		}()
+	}
+	wg.Wait()
+}
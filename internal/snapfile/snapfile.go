@@ -0,0 +1,70 @@
+// Package snapfile writes snapshot files atomically and encodes snapshots as gob in gzip stream.
+package snapfile
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Write writes file at path by write. Data goes to temporary file, which is synced
+// and renamed over path, then directory is synced, so crash leaves old or new file.
+func Write(path string, write func(w io.Writer) error) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer file.Close()
+
+	if err = write(file); err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("rename snapshot: %w", err)
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// SyncDir makes created, renamed and removed files of dir durable.
+func SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	defer dir.Close()
+
+	if err = dir.Sync(); err != nil {
+		return fmt.Errorf("sync dir: %w", err)
+	}
+	return nil
+}
+
+// Encode writes v as gob in gzip stream.
+func Encode(w io.Writer, v any) error {
+	zw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(zw).Encode(v); err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	return zw.Close()
+}
+
+// Decode reads v written by Encode.
+func Decode(r io.Reader, v any) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("gzip: %w", err)
+	}
+	defer zr.Close()
+
+	if err = gob.NewDecoder(zr).Decode(v); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package snapfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	err := Write(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("old"))
+		return err
+	})
+	require.NoError(t, err)
+
+	// Failed write leaves old file.
+	failed := errors.New("failed")
+	err = Write(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		require.NoError(t, err)
+		return failed
+	})
+	require.ErrorIs(t, err, failed)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(data))
+}
+
+func TestEncode(t *testing.T) {
+	type snapshot struct {
+		Version int
+		Links   map[string]string
+	}
+	expected := snapshot{Version: 1, Links: map[string]string{"abc": "https://google.com"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, expected))
+
+	var snap snapshot
+	require.NoError(t, Decode(&buf, &snap))
+	require.Equal(t, expected, snap)
+
+	require.Error(t, Decode(bytes.NewReader([]byte("not gzip")), &snap))
+}
@@ -0,0 +1,132 @@
+// Package storage opens repository chosen by config, it's shared by shortener and its tools.
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amanakin/shortener/internal/repository"
+	"github.com/amanakin/shortener/internal/repository/filerepo"
+	"github.com/amanakin/shortener/internal/repository/maprepo"
+	"github.com/amanakin/shortener/internal/repository/migrate"
+	"github.com/amanakin/shortener/internal/repository/postgres"
+	"github.com/amanakin/shortener/internal/repository/redisrepo"
+	"github.com/amanakin/shortener/internal/repository/shardrepo"
+	"gopkg.in/yaml.v3"
+)
+
+// Storage types.
+const (
+	Postgres = "postgres"
+	Memory   = "memory"
+	File     = "file"
+	Redis    = "redis"
+	Sharded  = "sharded"
+)
+
+// Config selects repository, short form "storage: memory" is also allowed.
+// If Type is not set, it's postgres or memory by postgres.enabled.
+type Config struct {
+	Type    string           `yaml:"type"`
+	Memory  maprepo.Config   `yaml:"memory"`
+	File    filerepo.Config  `yaml:"file"`
+	Redis   redisrepo.Config `yaml:"redis"`
+	Sharded shardrepo.Config `yaml:"sharded"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Memory:  maprepo.DefaultConfig(),
+		File:    filerepo.DefaultConfig(),
+		Redis:   redisrepo.DefaultConfig(),
+		Sharded: shardrepo.DefaultConfig(),
+	}
+}
+
+func (c *Config) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Type = node.Value
+		return nil
+	}
+
+	type plain Config
+	return node.Decode((*plain)(c))
+}
+
+// Kind returns storage type, pg is used if Type is postgres or not set.
+func (c Config) Kind(pg postgres.Config) string {
+	if c.Type != "" {
+		return c.Type
+	}
+	if pg.Enabled {
+		return Postgres
+	}
+	return Memory
+}
+
+// Migration values of MigrationConfig.Primary.
+const (
+	PrimarySource = "source"
+	PrimaryTarget = "target"
+)
+
+const defaultPrimary = PrimarySource
+
+// MigrationConfig is storage links are migrated to, see migrate.Repo.
+// Storage being migrated from is source, its links are copied by cmd/migrate.
+type MigrationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Primary is source or target, its answers are returned and other storage is shadow-read.
+	Primary string `yaml:"primary"`
+	// Target is storage links are migrated to.
+	Target Config `yaml:"target"`
+	// Postgres is connection of target with postgres type.
+	Postgres       postgres.Config `yaml:"postgres"`
+	migrate.Config `yaml:",inline"`
+}
+
+func DefaultMigrationConfig() MigrationConfig {
+	target := DefaultConfig()
+	target.Type = Postgres
+	return MigrationConfig{
+		Primary:  defaultPrimary,
+		Target:   target,
+		Postgres: postgres.DefaultConfig(),
+		Config:   migrate.DefaultConfig(),
+	}
+}
+
+// Open creates repository of config, pg is used by postgres type.
+// Background work of repository (Run) isn't started.
+func Open(ctx context.Context, config Config, pg postgres.Config) (repository.ShortenerRepo, error) {
+	switch kind := config.Kind(pg); kind {
+	case Postgres:
+		return postgres.New(ctx, pg)
+	case Memory:
+		repo, err := maprepo.Open(config.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("memory storage: %w", err)
+		}
+		return repo, nil
+	case File:
+		repo, err := filerepo.New(config.File)
+		if err != nil {
+			return nil, fmt.Errorf("file storage: %w", err)
+		}
+		return repo, nil
+	case Redis:
+		repo, err := redisrepo.New(ctx, config.Redis)
+		if err != nil {
+			return nil, fmt.Errorf("redis storage: %w", err)
+		}
+		return repo, nil
+	case Sharded:
+		repo, err := shardrepo.New(ctx, config.Sharded)
+		if err != nil {
+			return nil, fmt.Errorf("sharded storage: %w", err)
+		}
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", kind)
+	}
+}
@@ -0,0 +1,17 @@
+-- Moves shortener.urls from VARCHAR(255) original_url to TEXT,
+-- uniqueness is kept by sha256 of original_url.
+-- Hash is computed the same way as in postgres.Repo: sha256 of UTF-8 bytes.
+BEGIN;
+
+ALTER TABLE shortener.urls ALTER COLUMN original_url TYPE TEXT;
+ALTER TABLE shortener.urls ADD COLUMN IF NOT EXISTS original_hash BYTEA;
+
+UPDATE shortener.urls
+SET original_hash = sha256(convert_to(original_url, 'UTF8'))
+WHERE original_hash IS NULL;
+
+ALTER TABLE shortener.urls ALTER COLUMN original_hash SET NOT NULL;
+ALTER TABLE shortener.urls ADD CONSTRAINT urls_original_hash_key UNIQUE (original_hash);
+ALTER TABLE shortener.urls DROP CONSTRAINT IF EXISTS urls_original_url_key;
+
+COMMIT;
@@ -0,0 +1,5 @@
+-- Adds counters for counter generator, see postgres.Repo.AllocateRange.
+CREATE TABLE IF NOT EXISTS shortener.id_ranges (
+    name VARCHAR(64) PRIMARY KEY,
+    next_id BIGINT NOT NULL
+);
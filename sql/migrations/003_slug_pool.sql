@@ -0,0 +1,4 @@
+-- Adds pool of pre-generated short URLs, see postgres.Repo.ClaimSlug.
+CREATE TABLE IF NOT EXISTS shortener.slug_pool (
+    short_url VARCHAR(255) PRIMARY KEY
+);
@@ -0,0 +1,3 @@
+-- Adds click counters flushed by cache, see postgres.Repo.AddClicks.
+ALTER TABLE shortener.urls ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS urls_clicks_idx ON shortener.urls (clicks DESC);
@@ -0,0 +1,16 @@
+-- Publishes changed short URLs to replicas caches, see postgres.Repo.Listen.
+CREATE OR REPLACE FUNCTION shortener.notify_urls() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM pg_notify('shortener_urls', OLD.short_url);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM pg_notify('shortener_urls', NEW.short_url);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS urls_notify ON shortener.urls;
+CREATE TRIGGER urls_notify AFTER INSERT OR UPDATE OR DELETE ON shortener.urls
+    FOR EACH ROW EXECUTE FUNCTION shortener.notify_urls();
@@ -0,0 +1,4 @@
+-- Click counters are updated on every flush, they don't change links.
+DROP TRIGGER IF EXISTS urls_notify ON shortener.urls;
+CREATE TRIGGER urls_notify AFTER INSERT OR UPDATE OF original_url, short_url OR DELETE ON shortener.urls
+    FOR EACH ROW EXECUTE FUNCTION shortener.notify_urls();
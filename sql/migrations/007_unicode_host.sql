@@ -0,0 +1,2 @@
+-- Keeps Unicode form of IDN hosts, see postgres.Repo.StoreUnicodeHost.
+ALTER TABLE shortener.urls ADD COLUMN IF NOT EXISTS unicode_host TEXT;
@@ -4,6 +4,43 @@ CREATE SCHEMA IF NOT EXISTS shortener;
 
 -- TODO: add ID and expiration date
 CREATE TABLE IF NOT EXISTS shortener.urls (
-    original_url VARCHAR(255) NOT NULL UNIQUE,
-    short_url VARCHAR(255) NOT NULL UNIQUE
-);
\ No newline at end of file
+    original_url TEXT NOT NULL,
+    -- sha256 of original_url, keeps uniqueness for URLs of any length
+    original_hash BYTEA NOT NULL UNIQUE,
+    short_url VARCHAR(255) NOT NULL UNIQUE,
+    -- number of resolves, flushed by cache, see postgres.Repo.AddClicks
+    clicks BIGINT NOT NULL DEFAULT 0,
+    -- Unicode form of IDN host, original_url has punycode one, see postgres.Repo.StoreUnicodeHost
+    unicode_host TEXT
+);
+
+CREATE INDEX IF NOT EXISTS urls_clicks_idx ON shortener.urls (clicks DESC);
+
+-- Publishes changed short URLs to replicas caches, see postgres.Repo.Listen
+CREATE OR REPLACE FUNCTION shortener.notify_urls() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        PERFORM pg_notify('shortener_urls', OLD.short_url);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        PERFORM pg_notify('shortener_urls', NEW.short_url);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS urls_notify ON shortener.urls;
+-- Click counters are updated on every flush, they don't change links
+CREATE TRIGGER urls_notify AFTER INSERT OR UPDATE OF original_url, short_url OR DELETE ON shortener.urls
+    FOR EACH ROW EXECUTE FUNCTION shortener.notify_urls();
+
+-- Counters leased by ranges, see postgres.Repo.AllocateRange
+CREATE TABLE IF NOT EXISTS shortener.id_ranges (
+    name VARCHAR(64) PRIMARY KEY,
+    next_id BIGINT NOT NULL
+);
+
+-- Pre-generated unused short URLs, see postgres.Repo.ClaimSlug
+CREATE TABLE IF NOT EXISTS shortener.slug_pool (
+    short_url VARCHAR(255) PRIMARY KEY
+);
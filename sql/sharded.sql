@@ -0,0 +1,20 @@
+-- Schema of every shard of sharded storage, see shardrepo package
+CREATE SCHEMA IF NOT EXISTS shortener;
+
+-- Links of buckets by shortened URL, bucket is kept for moving buckets between shards
+CREATE TABLE IF NOT EXISTS shortener.links (
+    short_url VARCHAR(255) PRIMARY KEY,
+    original_url TEXT NOT NULL,
+    bucket SMALLINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS links_bucket_idx ON shortener.links (bucket, short_url);
+
+-- Directory of originals by bucket of sha256(original_url), keeps original URLs unique
+CREATE TABLE IF NOT EXISTS shortener.originals (
+    original_hash BYTEA PRIMARY KEY,
+    short_url VARCHAR(255) NOT NULL,
+    bucket SMALLINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS originals_bucket_idx ON shortener.originals (bucket, original_hash);